@@ -0,0 +1,413 @@
+package mesh
+
+import (
+	"strings"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+// Named values associated with the vertices, faces and face corners of a mesh
+// which have no dedicated field on Vertex or Face, such as the extra
+// properties of a PLY file (confidence, quality, labels...), additional sets
+// of texture coordinates or colors, tangents or arbitrary scalar and vector
+// fields.
+// The texture coordinates of a mesh are the TexCoords of its faces and its
+// colors are the Colors of its vertices, which codecs read and write as the
+// texture coordinates and colors of each format. Attributes of the
+// TexCoordAttribute and ColorAttribute types are only ever read and written as
+// named data, and are never used in place of those fields.
+// Attributes are kept in the order they were added so that codecs can write
+// them back out in the order they were read. Values are keyed by the vertex,
+// face or corner they belong to, so they stay with it as the mesh's vertices
+// and faces are filtered or reordered. The values of vertices and faces
+// removed with Mesh.RemoveVertices or Mesh.RemoveFaces are dropped, but the
+// collections' own Filter and Remove methods leave them in place.
+type Attributes struct {
+	Vertex []*VertexAttribute
+	Face   []*FaceAttribute
+	Corner []*CornerAttribute
+}
+
+// The type of the values of an attribute, which determines how many
+// components each value has and how it's affected by transformations.
+type AttributeType int
+
+const (
+	// A single number, such as a confidence or curvature.
+	ScalarAttribute AttributeType = iota
+	// A single whole number, such as the id of a region.
+	LabelAttribute
+	// Two components, u and v.
+	TexCoordAttribute
+	// Three components giving a direction, which is transformed along with the
+	// mesh.
+	VectorAttribute
+	// Four components, RGBA in the range [0, 1].
+	ColorAttribute
+	// Four components, a direction which is transformed along with the mesh
+	// followed by a handedness of 1 or -1.
+	TangentAttribute
+)
+
+// Returns the number of components of each value of the type.
+func (t AttributeType) Components() int {
+	switch t {
+	case TexCoordAttribute:
+		return 2
+	case VectorAttribute:
+		return 3
+	case ColorAttribute, TangentAttribute:
+		return 4
+	}
+	return 1
+}
+
+// Returns the suffixes distinguishing the names of the components of the type,
+// for formats which store each component as a separate property.
+func (t AttributeType) componentSuffixes() []string {
+	switch t {
+	case TexCoordAttribute:
+		return []string{"_u", "_v"}
+	case VectorAttribute:
+		return []string{"_x", "_y", "_z"}
+	case ColorAttribute:
+		return []string{"_r", "_g", "_b", "_a"}
+	case TangentAttribute:
+		return []string{"_x", "_y", "_z", "_w"}
+	}
+	return []string{""}
+}
+
+// A corner of a face, identified by the face and the index (0, 1 or 2) of the
+// vertex at the corner.
+type Corner struct {
+	Face  FaceI
+	Index int
+}
+
+// Values of scalar and label attributes are kept in Values, while those of
+// attributes with several components are kept in Vectors. The Get and Set
+// methods work with either.
+type VertexAttribute struct {
+	Name    string
+	Type    AttributeType
+	Values  map[VertexI]float64
+	Vectors map[VertexI][]float64
+}
+
+type FaceAttribute struct {
+	Name    string
+	Type    AttributeType
+	Values  map[FaceI]float64
+	Vectors map[FaceI][]float64
+}
+
+type CornerAttribute struct {
+	Name    string
+	Type    AttributeType
+	Values  map[Corner]float64
+	Vectors map[Corner][]float64
+}
+
+// Returns the components of the value for the vertex, and whether it has one.
+func (attr *VertexAttribute) Get(v VertexI) ([]float64, bool) {
+	if attr.Type.Components() > 1 {
+		value, found := attr.Vectors[v]
+		return value, found
+	}
+	value, found := attr.Values[v]
+	return []float64{value}, found
+}
+
+// Sets the value for the vertex. Missing components are left as zero and
+// extra components are ignored.
+func (attr *VertexAttribute) Set(v VertexI, components ...float64) {
+	if attr.Type.Components() > 1 {
+		attr.Vectors[v] = fitComponents(attr.Type, components)
+	} else if len(components) > 0 {
+		attr.Values[v] = components[0]
+	} else {
+		attr.Values[v] = 0
+	}
+}
+
+func (attr *VertexAttribute) Delete(v VertexI) {
+	delete(attr.Values, v)
+	delete(attr.Vectors, v)
+}
+
+// Returns the components of the value for the face, and whether it has one.
+func (attr *FaceAttribute) Get(f FaceI) ([]float64, bool) {
+	if attr.Type.Components() > 1 {
+		value, found := attr.Vectors[f]
+		return value, found
+	}
+	value, found := attr.Values[f]
+	return []float64{value}, found
+}
+
+// Sets the value for the face. Missing components are left as zero and extra
+// components are ignored.
+func (attr *FaceAttribute) Set(f FaceI, components ...float64) {
+	if attr.Type.Components() > 1 {
+		attr.Vectors[f] = fitComponents(attr.Type, components)
+	} else if len(components) > 0 {
+		attr.Values[f] = components[0]
+	} else {
+		attr.Values[f] = 0
+	}
+}
+
+func (attr *FaceAttribute) Delete(f FaceI) {
+	delete(attr.Values, f)
+	delete(attr.Vectors, f)
+}
+
+// Returns the components of the value for the corner, and whether it has one.
+func (attr *CornerAttribute) Get(c Corner) ([]float64, bool) {
+	if attr.Type.Components() > 1 {
+		value, found := attr.Vectors[c]
+		return value, found
+	}
+	value, found := attr.Values[c]
+	return []float64{value}, found
+}
+
+// Sets the value for the corner. Missing components are left as zero and extra
+// components are ignored.
+func (attr *CornerAttribute) Set(c Corner, components ...float64) {
+	if attr.Type.Components() > 1 {
+		attr.Vectors[c] = fitComponents(attr.Type, components)
+	} else if len(components) > 0 {
+		attr.Values[c] = components[0]
+	} else {
+		attr.Values[c] = 0
+	}
+}
+
+func (attr *CornerAttribute) Delete(c Corner) {
+	delete(attr.Values, c)
+	delete(attr.Vectors, c)
+}
+
+// Returns a copy of components with exactly as many as the type has.
+func fitComponents(t AttributeType, components []float64) []float64 {
+	result := make([]float64, t.Components())
+	copy(result, components)
+	return result
+}
+
+// Returns the vertex attribute with the given name, or nil if there is none.
+func (a *Attributes) GetVertexAttribute(name string) *VertexAttribute {
+	for _, attr := range a.Vertex {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// Returns the vertex attribute with the given name, creating it with the given
+// type (or as a scalar attribute) if necessary. An existing attribute is
+// returned whatever its type.
+func (a *Attributes) AddVertexAttribute(name string, types ...AttributeType) *VertexAttribute {
+	if attr := a.GetVertexAttribute(name); attr != nil {
+		return attr
+	}
+	attr := &VertexAttribute{Name: name, Values: make(map[VertexI]float64),
+		Vectors: make(map[VertexI][]float64)}
+	if len(types) > 0 {
+		attr.Type = types[0]
+	}
+	a.Vertex = append(a.Vertex, attr)
+	return attr
+}
+
+// Returns the face attribute with the given name, or nil if there is none.
+func (a *Attributes) GetFaceAttribute(name string) *FaceAttribute {
+	for _, attr := range a.Face {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// Returns the face attribute with the given name, creating it with the given
+// type (or as a scalar attribute) if necessary. An existing attribute is
+// returned whatever its type.
+func (a *Attributes) AddFaceAttribute(name string, types ...AttributeType) *FaceAttribute {
+	if attr := a.GetFaceAttribute(name); attr != nil {
+		return attr
+	}
+	attr := &FaceAttribute{Name: name, Values: make(map[FaceI]float64),
+		Vectors: make(map[FaceI][]float64)}
+	if len(types) > 0 {
+		attr.Type = types[0]
+	}
+	a.Face = append(a.Face, attr)
+	return attr
+}
+
+// Returns the corner attribute with the given name, or nil if there is none.
+func (a *Attributes) GetCornerAttribute(name string) *CornerAttribute {
+	for _, attr := range a.Corner {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// Returns the corner attribute with the given name, creating it with the given
+// type (or as a scalar attribute) if necessary. An existing attribute is
+// returned whatever its type.
+func (a *Attributes) AddCornerAttribute(name string, types ...AttributeType) *CornerAttribute {
+	if attr := a.GetCornerAttribute(name); attr != nil {
+		return attr
+	}
+	attr := &CornerAttribute{Name: name, Values: make(map[Corner]float64),
+		Vectors: make(map[Corner][]float64)}
+	if len(types) > 0 {
+		attr.Type = types[0]
+	}
+	a.Corner = append(a.Corner, attr)
+	return attr
+}
+
+// Gives vprime the values of vsec for any vertex attributes it has no value
+// for, and forgets the values of vsec.
+func (a *Attributes) mergeVertex(vprime, vsec VertexI) {
+	for _, attr := range a.Vertex {
+		if value, found := attr.Get(vsec); found {
+			if _, found = attr.Get(vprime); !found {
+				attr.Set(vprime, value...)
+			}
+			attr.Delete(vsec)
+		}
+	}
+}
+
+// Forgets the values of a vertex.
+func (a *Attributes) forgetVertex(v VertexI) {
+	for _, attr := range a.Vertex {
+		attr.Delete(v)
+	}
+}
+
+// Forgets the values of a face and its corners.
+func (a *Attributes) forgetFace(f FaceI) {
+	for _, attr := range a.Face {
+		attr.Delete(f)
+	}
+	for _, attr := range a.Corner {
+		for i := 0; i < 3; i++ {
+			attr.Delete(Corner{f, i})
+		}
+	}
+}
+
+// Applies a transformation to the directions of the vector and tangent
+// attributes of the given vertices, or of all vertices, faces and corners if
+// vertices is nil.
+func (a *Attributes) transform(t tr.Transformation, vertices []VertexI) {
+	origin := []float64{0, 0, 0}
+	t.Apply(origin)
+	transformDirection := func(value []float64) {
+		end := []float64{value[0], value[1], value[2]}
+		t.Apply(end)
+		for i := range end {
+			value[i] = end[i] - origin[i]
+		}
+	}
+	isDirection := func(t AttributeType) bool {
+		return t == VectorAttribute || t == TangentAttribute
+	}
+
+	for _, attr := range a.Vertex {
+		if !isDirection(attr.Type) {
+			continue
+		}
+		if vertices == nil {
+			for _, value := range attr.Vectors {
+				transformDirection(value)
+			}
+			continue
+		}
+		for _, v := range vertices {
+			if value, found := attr.Vectors[v]; found {
+				transformDirection(value)
+			}
+		}
+	}
+	if vertices != nil {
+		return
+	}
+	for _, attr := range a.Face {
+		if isDirection(attr.Type) {
+			for _, value := range attr.Vectors {
+				transformDirection(value)
+			}
+		}
+	}
+	for _, attr := range a.Corner {
+		if isDirection(attr.Type) {
+			for _, value := range attr.Vectors {
+				transformDirection(value)
+			}
+		}
+	}
+}
+
+// Returns the names of the components of an attribute, for formats which store
+// each component as a separate property.
+func attributeComponentNames(name string, t AttributeType) []string {
+	suffixes := t.componentSuffixes()
+	names := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		names[i] = name + suffix
+	}
+	return names
+}
+
+// Groups the names of separately stored components into attributes, with
+// consecutive names such as "flow_x", "flow_y" and "flow_z" making up a single
+// attribute of the type with those component suffixes. Returns the indices of
+// the names in each attribute, along with its name and type.
+func groupAttributeComponents(names []string) (groups [][]int, attr_names []string, types []AttributeType) {
+	grouped := []AttributeType{
+		TangentAttribute, VectorAttribute, ColorAttribute, TexCoordAttribute,
+	}
+	for i := 0; i < len(names); i++ {
+		found := false
+		for _, t := range grouped {
+			suffixes := t.componentSuffixes()
+			if i+len(suffixes) > len(names) ||
+				!strings.HasSuffix(names[i], suffixes[0]) {
+				continue
+			}
+			prefix := strings.TrimSuffix(names[i], suffixes[0])
+			found = prefix != ""
+			for j, suffix := range suffixes {
+				found = found && names[i+j] == prefix+suffix
+			}
+			if found {
+				group := make([]int, len(suffixes))
+				for j := range group {
+					group[j] = i + j
+				}
+				groups = append(groups, group)
+				attr_names = append(attr_names, prefix)
+				types = append(types, t)
+				i += len(suffixes) - 1
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []int{i})
+			attr_names = append(attr_names, names[i])
+			types = append(types, ScalarAttribute)
+		}
+	}
+	return
+}
@@ -0,0 +1,133 @@
+package mesh
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+// Tests for Attributes
+
+func TestAttributeValues(t *testing.T) {
+	type attributeTestParams struct {
+		t        AttributeType
+		set      []float64
+		expected []float64
+	}
+	m, verts := testTetrahedron()
+	for i, params := range []attributeTestParams{
+		{ScalarAttribute, []float64{0.5}, []float64{0.5}},
+		{LabelAttribute, []float64{3, 4}, []float64{3}},
+		{TexCoordAttribute, []float64{0.25}, []float64{0.25, 0}},
+		{ColorAttribute, []float64{1, 0, 0, 1}, []float64{1, 0, 0, 1}},
+	} {
+		attr := m.Attributes.AddVertexAttribute("attr"+strconv.Itoa(i), params.t)
+		attr.Set(verts[1], params.set...)
+		value, found := attr.Get(verts[1])
+		if !found || len(value) != len(params.expected) {
+			t.Error("For", params.t, "expected", params.expected, "got", value)
+			continue
+		}
+		for i := range value {
+			if value[i] != params.expected[i] {
+				t.Error("For", params.t, "expected", params.expected, "got", value)
+			}
+		}
+		if attr.Type != params.t {
+			t.Error("For", params.t, "expected a new attribute, got", attr.Type)
+		}
+		if _, found = attr.Get(verts[0]); found {
+			t.Error("For", params.t, "expected no value for another vertex")
+		}
+	}
+	if m.Attributes.AddVertexAttribute("attr0", VectorAttribute).Type != ScalarAttribute {
+		t.Error("Expected existing attribute to be returned")
+	}
+}
+
+func TestAttributesFollowElements(t *testing.T) {
+	m, verts := testTetrahedron()
+	height := m.Attributes.AddVertexAttribute("height")
+	flow := m.Attributes.AddVertexAttribute("flow", VectorAttribute)
+	region := m.Attributes.AddFaceAttribute("region", LabelAttribute)
+	uv := m.Attributes.AddCornerAttribute("uv", TexCoordAttribute)
+	for i, v := range verts {
+		height.Set(v, float64(i))
+	}
+	flow.Set(verts[3], 1, 0, 0)
+	faces := m.Faces.GetAll()
+	for i, f := range faces {
+		region.Set(f, float64(i))
+		uv.Set(Corner{f, 1}, float64(i), 1)
+	}
+
+	// values stay with their elements as the mesh changes
+	m.RemoveFaces(faces[0])
+	m.Vertices.Remove(0)
+	m.ReindexVerticesAndFaces()
+	if height.Values[verts[2]] != 2 || region.Values[faces[3]] != 3 {
+		t.Error("Expected values to follow their vertices and faces")
+	}
+	if _, found := region.Get(faces[0]); found {
+		t.Error("Expected values of removed face to be forgotten")
+	}
+	if _, found := uv.Get(Corner{faces[0], 1}); found {
+		t.Error("Expected corner values of removed face to be forgotten")
+	}
+
+	// merged vertices keep their own values, or take the secondary's
+	twin := m.AddVertex(0, 0, 1)
+	height.Set(twin, 7)
+	flow.Set(twin, 0, 1, 0)
+	m.AddFace(verts[1], twin, verts[2])
+	if err := MergeSharedVertices(verts[3], twin); err != nil {
+		t.Fatal("Expected no error merging vertices, got", err)
+	}
+	if value, _ := flow.Get(verts[3]); height.Values[verts[3]] != 3 || value[0] != 1 {
+		t.Error("Expected primary to keep its values, got", height.Values[verts[3]], value)
+	}
+	if _, found := height.Get(twin); found {
+		t.Error("Expected values of merged vertex to be forgotten")
+	}
+	height.Delete(verts[1])
+	MergeSharedVertices(verts[1], m.AddVertex(1, 0, 0))
+	if _, found := height.Get(verts[1]); found {
+		t.Error("Expected no value where neither vertex had one")
+	}
+
+	// directions are rotated, while other attributes are left alone
+	m.Transform(tr.Rotation(math.Pi/2, 0, 0, 1))
+	if value, _ := flow.Get(verts[3]); math.Abs(value[0]) > 1e-12 ||
+		math.Abs(math.Abs(value[1])-1) > 1e-12 || value[2] != 0 {
+		t.Error("Expected flow to be rotated about z, got", value)
+	}
+	if value, _ := uv.Get(Corner{faces[2], 1}); value[0] != 2 || value[1] != 1 {
+		t.Error("Expected tex coords to be left alone, got", value)
+	}
+	m.Transform(tr.Translation(5, 5, 5))
+	if value, _ := flow.Get(verts[3]); math.Abs(math.Abs(value[1])-1) > 1e-12 {
+		t.Error("Expected flow to be unaffected by translation, got", value)
+	}
+
+	// removing vertices drops their values, and those of their faces
+	m, verts = testTetrahedron()
+	height = m.Attributes.AddVertexAttribute("height")
+	region = m.Attributes.AddFaceAttribute("region", LabelAttribute)
+	height.Set(verts[0], 1)
+	height.Set(verts[1], 2)
+	m.Faces.Each(func(f FaceI) { region.Set(f, 1) })
+	m.RemoveVertices(verts[0])
+	if m.Vertices.Len() != 3 || m.Faces.Len() != 1 || verts[0].OccursInMesh(m) ||
+		verts[1].GetLocationInMesh(m) != 0 {
+		t.Error("Expected vertex and its faces to be removed, got",
+			m.Vertices.Len(), "vertices and", m.Faces.Len(), "faces")
+	}
+	if _, found := height.Get(verts[0]); found || height.Values[verts[1]] != 2 {
+		t.Error("Expected only the values of the removed vertex to be forgotten")
+	}
+	if len(region.Values) != 1 {
+		t.Error("Expected values of removed faces to be forgotten, got", region.Values)
+	}
+}
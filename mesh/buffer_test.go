@@ -0,0 +1,234 @@
+package mesh
+
+import (
+	"testing"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+// Tests for UseBuffers and UseSlices
+
+func TestUseBuffers(t *testing.T) {
+	m, verts := testTetrahedron()
+	original := m.Clone()
+	m.Attributes.AddVertexAttribute("flow", VectorAttribute).Set(verts[1], 1, 0, 0)
+	m.Attributes.AddFaceAttribute("label", LabelAttribute).Set(m.Faces.Get(3)[0], 7)
+
+	m.UseBuffers()
+	vb, ok := m.Vertices.(*VertexBuffer)
+	if !ok {
+		t.Fatal("Expected vertices to be a VertexBuffer, got", m.Vertices.ToString())
+	}
+	fb, ok := m.Faces.(*FaceBuffer)
+	if !ok {
+		t.Fatal("Expected faces to be a FaceBuffer, got", m.Faces.ToString())
+	}
+	if !m.Equal(original) {
+		t.Error("Expected buffered mesh to equal the original")
+	}
+	expected_positions := []float64{0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1}
+	if !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("For positions expected", expected_positions, "got", vb.Positions.Buffer)
+	}
+	expected_triangles := []int{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3}
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+	m.Vertices.EachWithIndex(func(i int, v VertexI) {
+		if v.GetLocationInMesh(m) != i || v.OccursInMesh(original) || len(v.(*BufferVertex).Meshes) != 1 {
+			t.Error("Expected vertex", i, "to occur only in the mesh at", i)
+		}
+	})
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		f_mesh, f_i := f.GetMeshLocation()
+		if f_mesh != m || f_i != i {
+			t.Error("Expected face", i, "to be located in the mesh at", i)
+		}
+		f.EachVertex(func(v VertexI) {
+			if !v.ReferencesFace(f) {
+				t.Error("Expected face", i, "to be registered with its vertices")
+			}
+		})
+	})
+	if value, _ := m.Attributes.GetVertexAttribute("flow").Get(m.Vertices.Get(1)[0]); value == nil || value[0] != 1 {
+		t.Error("Expected vertex attribute to be kept, got", value)
+	}
+	if value, _ := m.Attributes.GetFaceAttribute("label").Get(m.Faces.Get(3)[0]); value[0] != 7 {
+		t.Error("Expected face attribute to be kept, got", value)
+	}
+
+	// changes to the vertices are made in the buffer
+	m.Vertices.Get(3)[0].SetZ(2)
+	m.Transform(tr.Translation(1, 0, 0))
+	expected_positions = []float64{1, 0, 0, 2, 0, 0, 1, 1, 0, 1, 0, 2}
+	if !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("For positions expected", expected_positions, "got", vb.Positions.Buffer)
+	}
+	m.AddFace(m.Vertices.Get(3)[0], m.Vertices.Get(2)[0], m.Vertices.Get(0)[0])
+	expected_triangles = append(expected_triangles, 3, 2, 0)
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+	m.Faces.Remove(4)
+
+	m.UseSlices()
+	if _, ok = m.Vertices.(*VertexSlice); !ok {
+		t.Error("Expected vertices to be a VertexSlice, got", m.Vertices.ToString())
+	}
+	if _, ok = m.Faces.(*FaceSlice); !ok {
+		t.Error("Expected faces to be a FaceSlice, got", m.Faces.ToString())
+	}
+	original.Vertices.Get(3)[0].SetZ(2)
+	original.Transform(tr.Translation(1, 0, 0))
+	if !m.Equal(original) {
+		t.Error("Expected converted mesh to equal the original")
+	}
+	if value, _ := m.Attributes.GetVertexAttribute("flow").Get(m.Vertices.Get(1)[0]); value == nil || value[0] != 1 {
+		t.Error("Expected vertex attribute to be kept, got", value)
+	}
+}
+
+// Tests for removing vertices and faces from buffers
+
+func TestBufferRemove(t *testing.T) {
+	m, _ := testTetrahedron()
+	m.UseBuffers()
+	vb := m.Vertices.(*VertexBuffer)
+	fb := m.Faces.(*FaceBuffer)
+	removed_vertex := vb.Get(1)[0].(*BufferVertex)
+	removed_face := fb.Get(1)[0].(*BufferFace)
+	kept_face := fb.Get(3)[0]
+
+	fb.Remove(1)
+	vb.Filter(func(v VertexI) bool { return v != removed_vertex })
+	expected_positions := []float64{0, 0, 0, 0, 1, 0, 0, 0, 1}
+	if !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("For positions expected", expected_positions, "got", vb.Positions.Buffer)
+	}
+	expected_triangles := []int{0, 1, -1, 0, 2, 1, -1, 1, 2}
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+	if kept_face.GetA() != nil || kept_face.GetB() != vb.Get(1)[0] {
+		t.Error("Expected kept face to reference the moved vertices")
+	}
+
+	// removed vertices and faces keep their values
+	if removed_vertex.BufferIndex() != -1 || removed_vertex.GetX() != 1 {
+		t.Error("Expected removed vertex to keep its position, got", removed_vertex.ToString())
+	}
+	if removed_face.GetA() != vb.Get(0)[0] || removed_face.GetB() != removed_vertex {
+		t.Error("Expected removed face to keep its vertices")
+	}
+	removed_vertex.SetX(3)
+	vb.Append(removed_vertex)
+	expected_positions = append(expected_positions, 3, 0, 0)
+	if removed_vertex.BufferIndex() != 3 || !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("For positions expected", expected_positions, "got", vb.Positions.Buffer)
+	}
+	fb.Append(removed_face)
+	expected_triangles = append(expected_triangles, 0, 3, 2)
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+}
+
+func TestBufferUpdate(t *testing.T) {
+	vb := NewVertexBuffer()
+	a := vb.NewVertex(1, 1, 1)
+	b := vb.NewVertex(2, 2, 2)
+	c := vb.NewVertex(3, 3, 3)
+	fb := NewFaceBuffer(vb)
+	f := fb.NewFace(a, b, c)
+	g := fb.NewFace(c, b, a)
+
+	vb.Remove(1)
+	vb.Update(0, b)
+	if a.BufferIndex() != -1 || a.GetX() != 1 {
+		t.Error("Expected replaced vertex to keep its position, got", a.ToString())
+	}
+	if b.BufferIndex() != 0 || b.GetX() != 2 {
+		t.Error("Expected updated vertex to be at 0, got", b.ToString())
+	}
+	b.SetX(9)
+	expected_positions := []float64{9, 2, 2, 3, 3, 3}
+	if !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("For positions expected", expected_positions, "got", vb.Positions.Buffer)
+	}
+	a.SetX(4)
+	if !floatsEqual(vb.Positions.Buffer, expected_positions) {
+		t.Error("Expected replaced vertex not to change the buffer, got", vb.Positions.Buffer)
+	}
+
+	// a vertex which occurs at another index keeps that one
+	vb.Append(b)
+	vb.Update(0, c)
+	if b.BufferIndex() != 2 || b.GetX() != 9 || c.BufferIndex() != 1 {
+		t.Error("Expected vertices to be at their remaining indices, got", b.BufferIndex(), c.BufferIndex())
+	}
+
+	fb.Update(0, g)
+	if f.buffer != nil || f.GetA() != nil || f.GetC() != c {
+		t.Error("Expected replaced face to keep its vertices")
+	}
+	expected_triangles := []int{1, -1, -1, 1, -1, -1}
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+	fb.Remove(1)
+	fb.Update(0, f)
+	if f.buffer != fb || f.index != 0 || g.buffer != nil || g.GetA() != c {
+		t.Error("Expected faces to swap places")
+	}
+	f.SetB(b)
+	expected_triangles = []int{-1, 2, 1}
+	if !intsEqual(fb.Triangles.Buffer, expected_triangles) {
+		t.Error("For triangles expected", expected_triangles, "got", fb.Triangles.Buffer)
+	}
+}
+
+func TestBufferForeignElements(t *testing.T) {
+	buffered, _ := testTetrahedron()
+	buffered.UseBuffers()
+	other, other_verts := testTetrahedron()
+	for name, add := range map[string]func(){
+		"vertex": func() { buffered.Vertices.Append(other_verts[0]) },
+		"face":   func() { buffered.Faces.Append(other.Faces.Get(0)[0]) },
+		"face with foreign vertex": func() {
+			buffered.AddFace(other_verts[0], other_verts[1], other_verts[2])
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("For", name, "expected a panic")
+				}
+			}()
+			add()
+		}()
+	}
+}
+
+func floatsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
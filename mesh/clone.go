@@ -0,0 +1,282 @@
+package mesh
+
+import (
+	"github.com/nat-n/geom"
+	"math"
+	"sort"
+)
+
+// Returns an independent copy of the mesh, with its own vertices, faces,
+// normals, colors, tex coords, materials and attributes.
+func (m *Mesh) Clone() *Mesh {
+	clone := New(m.Name)
+	clone.appendCopy(m)
+	if m.Materials != nil {
+		clone.Materials.Files = append([]string{}, m.Materials.Files...)
+		for _, mat := range m.Materials.Materials {
+			mat_copy := *mat
+			mat_copy.Other = append([]string(nil), mat.Other...)
+			clone.Materials.Materials = append(clone.Materials.Materials, &mat_copy)
+		}
+	}
+	return clone
+}
+
+// Adds a vertex at the position of v, with copies of its normal and color.
+func (m *Mesh) AddVertexCopy(v VertexI) VertexI {
+	new_v := m.AddVertex(v.GetX(), v.GetY(), v.GetZ())
+	new_v.SetNormal(copyVec3(v.GetNormal()))
+	if c := v.GetColor(); c != nil {
+		color := *c
+		new_v.SetColor(&color)
+	}
+	return new_v
+}
+
+// Adds a face joining the given vertices, with copies of the normal, tex
+// coords and group of f.
+func (m *Mesh) AddFaceCopy(f FaceI, a, b, c VertexI) FaceI {
+	new_f := m.AddFace(a, b, c)
+	new_f.SetNormal(copyVec3(f.GetNormal()))
+	var tex_coords [3]*geom.Vec3
+	for i, vt := range f.GetTexCoords() {
+		tex_coords[i] = copyVec3(vt)
+	}
+	new_f.SetTexCoords(tex_coords)
+	new_f.SetGroup(f.GetGroup())
+	return new_f
+}
+
+// Appends copies of the vertices and faces of src to the mesh, along with
+// their attribute values. Faces of the copy reference the copied vertices.
+func (m *Mesh) appendCopy(src *Mesh) {
+	vertex_lookup := make(map[VertexI]VertexI, src.Vertices.Len())
+	src.Vertices.Each(func(v VertexI) {
+		vertex_lookup[v] = m.AddVertexCopy(v)
+	})
+	face_lookup := make(map[FaceI]FaceI, src.Faces.Len())
+	src.Faces.Each(func(f FaceI) {
+		face_lookup[f] = m.AddFaceCopy(f, vertex_lookup[f.GetA()],
+			vertex_lookup[f.GetB()], vertex_lookup[f.GetC()])
+	})
+	if src.Attributes == nil {
+		return
+	}
+
+	for _, attr := range src.Attributes.Vertex {
+		new_attr := m.Attributes.AddVertexAttribute(attr.Name, attr.Type)
+		src.Vertices.Each(func(v VertexI) {
+			if value, found := attr.Get(v); found {
+				new_attr.Set(vertex_lookup[v], value...)
+			}
+		})
+	}
+	for _, attr := range src.Attributes.Face {
+		new_attr := m.Attributes.AddFaceAttribute(attr.Name, attr.Type)
+		src.Faces.Each(func(f FaceI) {
+			if value, found := attr.Get(f); found {
+				new_attr.Set(face_lookup[f], value...)
+			}
+		})
+	}
+	for _, attr := range src.Attributes.Corner {
+		new_attr := m.Attributes.AddCornerAttribute(attr.Name, attr.Type)
+		src.Faces.Each(func(f FaceI) {
+			for i := 0; i < 3; i++ {
+				if value, found := attr.Get(Corner{f, i}); found {
+					new_attr.Set(Corner{face_lookup[f], i}, value...)
+				}
+			}
+		})
+	}
+}
+
+// Returns a copy of the vector, or nil.
+func copyVec3(v *geom.Vec3) *geom.Vec3 {
+	if v == nil {
+		return nil
+	}
+	result := *v
+	return &result
+}
+
+// Reports whether two meshes have the same vertex positions and the same faces
+// joining them, regardless of the order of their vertices and faces or which
+// corner each face starts from. Normals, colors and attributes aren't
+// compared.
+func (m *Mesh) Equal(other *Mesh) bool {
+	return m.ApproxEqual(other, 0)
+}
+
+// Reports whether two meshes are equal as for Equal, except that vertices are
+// taken to be in the same position if they are no more than tolerance apart.
+func (m *Mesh) ApproxEqual(other *Mesh, tolerance float64) bool {
+	if m.Vertices.Len() != other.Vertices.Len() || m.Faces.Len() != other.Faces.Len() {
+		return false
+	}
+	return matchVertices(m, other, tolerance) != nil
+}
+
+// Returns the vertex indices of a face starting from the lowest, so that faces
+// with the same winding have the same key whichever corner they start from.
+func faceKey(a, b, c int) [3]int {
+	if b < a && b <= c {
+		return [3]int{b, c, a}
+	} else if c < a && c < b {
+		return [3]int{c, a, b}
+	}
+	return [3]int{a, b, c}
+}
+
+// Pairs each vertex of m with a distinct vertex of other which is no more than
+// tolerance away and used by as many faces, such that the faces of m pair with
+// the faces of other. Candidates are tried in order of their index, and the
+// search backtracks whenever a face can't be paired, so that coincident
+// vertices are told apart by the faces which use them. Returns the index in
+// other of the vertex paired with each vertex of m, or nil if they can't all
+// be paired.
+func matchVertices(m, other *Mesh, tolerance float64) []int {
+	vertices, others := m.Vertices.GetAll(), other.Vertices.GetAll()
+	indices := make(map[VertexI]int, len(vertices))
+	for i, v := range vertices {
+		indices[v] = i
+	}
+	other_indices := make(map[VertexI]int, len(others))
+	for i, v := range others {
+		other_indices[v] = i
+	}
+	index := func(lookup map[VertexI]int, v VertexI) int {
+		if i, found := lookup[v]; found {
+			return i
+		}
+		return -1
+	}
+
+	// the faces of other are counted by key, and the faces of m are listed by
+	// the last of their vertices, after which they can be paired
+	other_faces := make(map[[3]int]int, len(others))
+	other_degrees := make([]int, len(others))
+	other.Faces.Each(func(f FaceI) {
+		face := [3]int{index(other_indices, f.GetA()), index(other_indices, f.GetB()),
+			index(other_indices, f.GetC())}
+		other_faces[faceKey(face[0], face[1], face[2])]++
+		for _, i := range face {
+			if i >= 0 {
+				other_degrees[i]++
+			}
+		}
+	})
+	degrees := make([]int, len(vertices))
+	completed := make([][][3]int, len(vertices)+1)
+	m.Faces.Each(func(f FaceI) {
+		face := [3]int{index(indices, f.GetA()), index(indices, f.GetB()),
+			index(indices, f.GetC())}
+		last := -1
+		for _, i := range face {
+			if i >= 0 {
+				degrees[i]++
+			}
+			if i > last {
+				last = i
+			}
+		}
+		completed[last+1] = append(completed[last+1], face)
+	})
+
+	// others are bucketed into cells as large as the tolerance, so that only
+	// the neighbouring cells need to be searched
+	cell := func(v VertexI) [3]float64 {
+		if tolerance == 0 {
+			return [3]float64{v.GetX(), v.GetY(), v.GetZ()}
+		}
+		return [3]float64{math.Floor(v.GetX() / tolerance),
+			math.Floor(v.GetY() / tolerance), math.Floor(v.GetZ() / tolerance)}
+	}
+	offsets := []float64{0}
+	if tolerance > 0 {
+		offsets = []float64{-1, 0, 1}
+	}
+	cells := make(map[[3]float64][]int)
+	for i, v := range others {
+		key := cell(v)
+		cells[key] = append(cells[key], i)
+	}
+	candidates := make([][]int, len(vertices))
+	for k, v := range vertices {
+		key := cell(v)
+		for _, dx := range offsets {
+			for _, dy := range offsets {
+				for _, dz := range offsets {
+					for _, i := range cells[[3]float64{key[0] + dx, key[1] + dy, key[2] + dz}] {
+						d := v.Subtract(others[i])
+						if other_degrees[i] == degrees[k] && d.Magnitude() <= tolerance {
+							candidates[k] = append(candidates[k], i)
+						}
+					}
+				}
+			}
+		}
+		if len(candidates[k]) == 0 {
+			return nil
+		}
+		sort.Ints(candidates[k])
+	}
+
+	pairs := make([]int, len(vertices))
+	paired := func(i int) int {
+		if i < 0 {
+			return -1
+		}
+		return pairs[i]
+	}
+	unpairFaces := func(faces [][3]int) {
+		for _, face := range faces {
+			other_faces[faceKey(paired(face[0]), paired(face[1]), paired(face[2]))]++
+		}
+	}
+	// pairs the faces completed by pairing vertex k-1, or returns false with
+	// none of them paired
+	pairFaces := func(k int) bool {
+		for j, face := range completed[k] {
+			key := faceKey(paired(face[0]), paired(face[1]), paired(face[2]))
+			if other_faces[key] == 0 {
+				unpairFaces(completed[k][:j])
+				return false
+			}
+			other_faces[key]--
+		}
+		return true
+	}
+	if !pairFaces(0) {
+		return nil
+	}
+
+	used := make([]bool, len(others))
+	// the position in its candidates of the next one to try for each vertex
+	next := make([]int, len(vertices))
+	for k := 0; k < len(vertices); {
+		found := false
+		for !found && next[k] < len(candidates[k]) {
+			i := candidates[k][next[k]]
+			next[k]++
+			if !used[i] {
+				pairs[k] = i
+				found = pairFaces(k + 1)
+				used[i] = found
+			}
+		}
+		if found {
+			k++
+			continue
+		}
+		// no candidate is left, so try the next one for the previous vertex
+		next[k] = 0
+		k--
+		if k < 0 {
+			return nil
+		}
+		unpairFaces(completed[k+1])
+		used[pairs[k]] = false
+	}
+	return pairs
+}
@@ -0,0 +1,145 @@
+package mesh
+
+import (
+	"github.com/nat-n/geom"
+	"testing"
+)
+
+// Tests for Clone
+
+func TestClone(t *testing.T) {
+	m, verts := testTetrahedron()
+	verts[0].SetNormal(&geom.Vec3{0, 0, -1})
+	m.Faces.Get(0)[0].SetGroup(FaceGroup{Material: "red"})
+	m.Materials.Add(NewMaterial("red"))
+	m.Attributes.AddVertexAttribute("flow", VectorAttribute).Set(verts[1], 1, 0, 0)
+	m.Attributes.AddCornerAttribute("uv", TexCoordAttribute).Set(
+		Corner{m.Faces.Get(2)[0], 1}, 0.5, 0.5)
+
+	clone := m.Clone()
+	if clone.Name != m.Name || !clone.Equal(m) {
+		t.Fatal("Expected clone to equal the original")
+	}
+	clone.Vertices.EachWithIndex(func(i int, v VertexI) {
+		if v == verts[i] || v.GetLocationInMesh(clone) != i || v.OccursInMesh(m) {
+			t.Error("Expected vertex", i, "to be copied into the clone")
+		}
+	})
+	clone.Faces.EachWithIndex(func(i int, f FaceI) {
+		f_mesh, f_i := f.GetMeshLocation()
+		if f == m.Faces.Get(i)[0] || f_mesh != clone || f_i != i {
+			t.Error("Expected face", i, "to be copied into the clone")
+		}
+		f.EachVertex(func(v VertexI) {
+			if !v.OccursInMesh(clone) || !v.ReferencesFace(f) {
+				t.Error("Expected face", i, "to reference the clone's vertices")
+			}
+		})
+	})
+	if clone.Faces.Get(0)[0].GetGroup().Material != "red" || clone.Materials.Get("red") == nil {
+		t.Error("Expected face groups and materials to be copied")
+	}
+
+	// changing the clone leaves the original alone
+	clone_v := clone.Vertices.Get(0)[0]
+	clone_v.SetX(10)
+	clone_v.GetNormal().SetZ(1)
+	clone.Materials.Get("red").Diffuse[0] = 0
+	flow := clone.Attributes.GetVertexAttribute("flow")
+	if value, _ := flow.Get(clone.Vertices.Get(1)[0]); value == nil || value[0] != 1 {
+		t.Error("Expected attribute to be copied, got", value)
+	} else {
+		value[0] = 2
+	}
+	if verts[0].GetX() != 0 || verts[0].GetNormal().GetZ() != -1 ||
+		m.Materials.Get("red").Diffuse[0] != 0.8 ||
+		m.Attributes.GetVertexAttribute("flow").Vectors[verts[1]][0] != 1 {
+		t.Error("Expected original to be unchanged by changes to the clone")
+	}
+	uv := clone.Attributes.GetCornerAttribute("uv")
+	if _, found := uv.Get(Corner{clone.Faces.Get(2)[0], 1}); !found {
+		t.Error("Expected corner attribute to be copied")
+	}
+	if clone.Equal(m) {
+		t.Error("Expected moved vertex to make the meshes unequal")
+	}
+}
+
+// Tests for Equal and ApproxEqual
+
+func TestEqual(t *testing.T) {
+	type equalTestParams struct {
+		name      string
+		other     func() *Mesh
+		tolerance float64
+		expected  bool
+	}
+	// the tetrahedron with its vertices and faces in other orders
+	reordered := func(offset float64, faces ...[3]int) func() *Mesh {
+		return func() *Mesh {
+			m := New("other")
+			verts := []VertexI{
+				m.AddVertex(0, 0, 1), m.AddVertex(0, 1, 0),
+				m.AddVertex(1, 0, 0), m.AddVertex(offset, offset, -offset),
+			}
+			for _, f := range faces {
+				m.AddFace(verts[f[0]], verts[f[1]], verts[f[2]])
+			}
+			return m
+		}
+	}
+	faces := [][3]int{{2, 0, 3}, {1, 2, 3}, {1, 0, 2}, {0, 1, 3}}
+	flipped := [][3]int{{2, 0, 3}, {1, 2, 3}, {0, 1, 2}, {0, 1, 3}}
+	for _, params := range []equalTestParams{
+		{"reordered", reordered(0, faces...), 0, true},
+		{"moved", reordered(1e-6, faces...), 0, false},
+		{"moved within tolerance", reordered(1e-6, faces...), 1e-5, true},
+		{"moved beyond tolerance", reordered(1e-4, faces...), 1e-5, false},
+		{"flipped face", reordered(0, flipped...), 0, false},
+		{"missing face", reordered(0, faces[:3]...), 0, false},
+		{"duplicated face", reordered(0, faces[0], faces[1], faces[2], faces[2]), 0, false},
+	} {
+		m, _ := testTetrahedron()
+		if result := m.ApproxEqual(params.other(), params.tolerance); result != params.expected {
+			t.Error("For", params.name, "expected", params.expected, "got", result)
+		}
+	}
+}
+
+func TestEqualCoincidentVertices(t *testing.T) {
+	// two triangles which meet along an edge with a seam of coincident
+	// vertices, which are added in the given order
+	seam := func(order ...int) *Mesh {
+		m := New("seam")
+		positions := [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0},
+			{1, 0, 0}, {0, 1, 0}}
+		verts := make([]VertexI, len(positions))
+		for _, i := range order {
+			verts[i] = m.AddVertex(positions[i][0], positions[i][1], positions[i][2])
+		}
+		m.AddFace(verts[0], verts[1], verts[2])
+		m.AddFace(verts[0], verts[2], verts[5])
+		m.AddFace(verts[3], verts[5], verts[4])
+		return m
+	}
+	m := seam(0, 1, 2, 3, 4, 5)
+	for _, order := range [][]int{{0, 4, 5, 3, 1, 2}, {5, 4, 3, 2, 1, 0}} {
+		if !m.Equal(seam(order...)) {
+			t.Error("For vertex order", order, "expected the meshes to be equal")
+		}
+		if !m.ApproxEqual(seam(order...), 0.1) {
+			t.Error("For vertex order", order, "expected the meshes to be approximately equal")
+		}
+	}
+
+	// a matching within the tolerance is found even if the nearest vertices
+	// don't match
+	near := seam(0, 1, 2, 3, 4, 5)
+	near.Vertices.Get(4)[0].SetX(0.95)
+	if !m.ApproxEqual(near, 0.1) {
+		t.Error("Expected meshes with moved seam vertex to be approximately equal")
+	}
+	if m.ApproxEqual(near, 0.01) {
+		t.Error("Expected meshes with moved seam vertex not to be approximately equal")
+	}
+}
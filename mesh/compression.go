@@ -0,0 +1,205 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A compression scheme which mesh files may be stored with. Compressed files
+// are recognised by their magic number when reading, and compressed according
+// to their extension when writing.
+// A scheme registered without NewReader or NewWriter is still recognised, but
+// reading or writing it reports an error.
+type Compression struct {
+	Name string
+	// Extensions of files compressed with this scheme, including the leading
+	// dot, e.g. ".gz" for "mesh.obj.gz".
+	Extensions []string
+	Magic      []byte
+	NewReader  func(io.Reader) (io.ReadCloser, error)
+	NewWriter  func(io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	compressionsLock sync.RWMutex
+	compressions     = make([]*Compression, 0)
+)
+
+// Registers a compression scheme for the file level readers and writers. A
+// scheme registered with the same name as an existing one replaces it, so
+// for example a zstd implementation can be plugged in with:
+//
+//	mesh.RegisterCompression(&mesh.Compression{
+//		Name:       "zstd",
+//		Extensions: []string{".zst"},
+//		Magic:      []byte{0x28, 0xb5, 0x2f, 0xfd},
+//		NewReader:  ...,
+//		NewWriter:  ...,
+//	})
+func RegisterCompression(c *Compression) {
+	compressionsLock.Lock()
+	defer compressionsLock.Unlock()
+	for i, existing := range compressions {
+		if existing.Name == c.Name {
+			compressions[i] = c
+			return
+		}
+	}
+	compressions = append(compressions, c)
+}
+
+// Returns the registered compression scheme for the extension of the given
+// path, or nil.
+func compressionForPath(path string) *Compression {
+	ext := strings.ToLower(filepath.Ext(path))
+	compressionsLock.RLock()
+	defer compressionsLock.RUnlock()
+	for _, c := range compressions {
+		for _, c_ext := range c.Extensions {
+			if ext == c_ext {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the path without the extension of any compression scheme, so that
+// "mesh.obj.gz" becomes "mesh.obj".
+func trimCompressionExt(path string) string {
+	if compressionForPath(path) != nil {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// Returns the path's file name without its extension (or extensions, for a
+// compressed file), so that "dir/mesh.obj.gz" becomes "mesh".
+func baseName(path string) string {
+	path = filepath.Base(trimCompressionExt(path))
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// Closes several closers in order, returning the first error.
+type multiCloser struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+func (mc *multiCloser) Close() (err error) {
+	for _, c := range mc.closers {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// Opens a file for reading, transparently decompressing it if it begins with
+// the magic number of a registered compression scheme.
+func openFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	header, _ := buffered.Peek(16)
+
+	compressionsLock.RLock()
+	var compression *Compression
+	for _, c := range compressions {
+		if len(c.Magic) > 0 && bytes.HasPrefix(header, c.Magic) {
+			compression = c
+			break
+		}
+	}
+	compressionsLock.RUnlock()
+
+	if compression == nil {
+		return &multiCloser{Reader: buffered, closers: []io.Closer{file}}, nil
+	}
+	if compression.NewReader == nil {
+		file.Close()
+		return nil, errors.New("Cannot read " + compression.Name +
+			" compressed file: no decompressor registered")
+	}
+	decompressed, err := compression.NewReader(buffered)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &multiCloser{
+		Reader:  decompressed,
+		closers: []io.Closer{decompressed, file},
+	}, nil
+}
+
+// Creates a file for writing, transparently compressing it if its extension
+// is that of a registered compression scheme.
+// The returned writer must be closed to flush any compressed data.
+func createFile(path string) (io.WriteCloser, error) {
+	compression := compressionForPath(path)
+	if compression != nil && compression.NewWriter == nil {
+		return nil, errors.New("Cannot write " + compression.Name +
+			" compressed file: no compressor registered")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if compression == nil {
+		return &multiCloser{Writer: file, closers: []io.Closer{file}}, nil
+	}
+	compressed, err := compression.NewWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &multiCloser{
+		Writer:  compressed,
+		closers: []io.Closer{compressed, file},
+	}, nil
+}
+
+// Writes to a new (possibly compressed) file with the given function, making
+// sure that errors from closing the file are reported.
+func writeFile(path string, write func(io.Writer) error) (err error) {
+	output_file, err := createFile(path)
+	if err != nil {
+		return
+	}
+	err = write(output_file)
+	if closeErr := output_file.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+func init() {
+	RegisterCompression(&Compression{
+		Name:       "gzip",
+		Extensions: []string{".gz"},
+		Magic:      []byte{0x1f, 0x8b},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	})
+	// zstd isn't available in the standard library, but is recognised so that
+	// a clear error is given unless an implementation is registered.
+	RegisterCompression(&Compression{
+		Name:       "zstd",
+		Extensions: []string{".zst", ".zstd"},
+		Magic:      []byte{0x28, 0xb5, 0x2f, 0xfd},
+	})
+}
@@ -0,0 +1,59 @@
+package mesh
+
+import (
+	cb "github.com/nat-n/gomesh/cuboid"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests for reading and writing compressed files
+
+var compressedFileNames = []string{
+	"cube.obj.gz", "cube.stl.gz", "cube.ply.gz", "cube.gltf.gz", "cube.glb.gz",
+}
+
+func TestCompressedRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFromCuboid(*cb.New(0, 0, 0, 1, 2, 3))
+	for _, name := range compressedFileNames {
+		path := filepath.Join(dir, name)
+		if err := m.WriteFile(path); err != nil {
+			t.Error("For", name, "expected no error writing, got", err)
+			continue
+		}
+		data, _ := os.ReadFile(path)
+		if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+			t.Error("For", name, "expected gzip compressed file")
+		}
+		m2, err := ReadFile(path)
+		if err != nil {
+			t.Error("For", name, "expected no error reading, got", err)
+			continue
+		}
+		if m2.Vertices.Len() != 8 || m2.Faces.Len() != 12 {
+			t.Error("For", name, "expected 8 vertices and 12 faces, got",
+				m2.Vertices.Len(), m2.Faces.Len())
+		}
+	}
+
+	// compressed files are recognised by their contents, not their extension
+	unnamed := filepath.Join(dir, "unnamed.dat")
+	data, _ := os.ReadFile(filepath.Join(dir, "cube.ply.gz"))
+	os.WriteFile(unnamed, data, 0644)
+	if _, err := ReadFile(unnamed); err != nil {
+		t.Error("Expected compressed PLY to be sniffed, got", err)
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cube.obj.zst")
+	if err := New("").WriteFile(path); err == nil {
+		t.Error("Expected error writing zstd without a compressor")
+	}
+	os.WriteFile(path, []byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0, 0, 0}, 0644)
+	if _, err := ReadFile(path); err == nil {
+		t.Error("Expected error reading zstd without a decompressor")
+	}
+}
@@ -0,0 +1,215 @@
+package mesh
+
+import (
+	"math"
+)
+
+// An edge of a mesh, with the faces which share it.
+type Edge struct {
+	// The vertices joined by the edge, in the winding order of its first face.
+	V1, V2 VertexI
+	// The faces using the edge: one on a boundary, two on the interior of a
+	// manifold, or more at non-manifold edges.
+	Faces []FaceI
+}
+
+func (e *Edge) Length() float64 {
+	d := e.V1.Subtract(e.V2)
+	return d.Magnitude()
+}
+
+func (e *Edge) IsBoundary() bool {
+	return len(e.Faces) == 1
+}
+
+// Returns the angle in radians between the normals of the edge's two faces,
+// which is zero where they're coplanar, positive where they fold away from
+// each other (a convex edge) and negative where they fold towards each other.
+// Returns NaN for edges without exactly two faces.
+func (e *Edge) DihedralAngle() float64 {
+	if len(e.Faces) != 2 {
+		return math.NaN()
+	}
+	t1, t2 := e.Faces[0].AsTriangle(), e.Faces[1].AsTriangle()
+	n1, n2 := t1.Normal(), t2.Normal()
+	cross := n1.CrossProd(&n2)
+	angle := math.Atan2(cross.Magnitude(), n1.DotProd(&n2))
+
+	// the second face's far corner is below the first's plane on a convex edge
+	var far VertexI
+	e.Faces[1].EachVertex(func(v VertexI) {
+		if v != e.V1 && v != e.V2 {
+			far = v
+		}
+	})
+	if far != nil {
+		offset := far.Subtract(e.V1)
+		if n1.DotProd(&offset) > 0 {
+			angle = -angle
+		}
+	}
+	return angle
+}
+
+func (e *Edge) ToString() string {
+	return "{Edge " + e.V1.ToString() + " " + e.V2.ToString() + "}"
+}
+
+// The unique edges of a mesh's faces.
+type EdgeCollection interface {
+	Len() int
+	GetAll() []*Edge
+	Each(func(*Edge))
+	Filter(func(*Edge) bool) []*Edge
+	Between(v1, v2 VertexI) *Edge
+	IsEmpty() bool
+}
+
+// An EdgeCollection derived on demand from a FaceCollection, and from the
+// faces each vertex records that it's used by, so that it always reflects the
+// faces as they are.
+type FaceEdges struct {
+	faces FaceCollection
+}
+
+func NewFaceEdges(faces FaceCollection) *FaceEdges {
+	return &FaceEdges{faces}
+}
+
+// Returns the edges in the order their first face is found, with the faces of
+// each in the same order.
+func (fe *FaceEdges) GetAll() []*Edge {
+	edges := make([]*Edge, 0, fe.faces.Len()*3/2)
+	lookup := make(map[VertexPair]*Edge, fe.faces.Len()*3/2)
+	fe.faces.Each(func(f FaceI) {
+		corners := [3]VertexI{f.GetA(), f.GetB(), f.GetC()}
+		for i, a := range corners {
+			b := corners[(i+1)%3]
+			if a == b {
+				continue
+			}
+			edge, found := lookup[VertexPair{a, b}]
+			if !found {
+				edge, found = lookup[VertexPair{b, a}]
+			}
+			if !found {
+				edge = &Edge{V1: a, V2: b}
+				lookup[VertexPair{a, b}] = edge
+				edges = append(edges, edge)
+			}
+			if len(edge.Faces) == 0 || edge.Faces[len(edge.Faces)-1] != f {
+				edge.Faces = append(edge.Faces, f)
+			}
+		}
+	})
+	return edges
+}
+
+// Counts the edges without collecting their faces.
+func (fe *FaceEdges) Len() int {
+	seen := make(map[VertexPair]bool, fe.faces.Len()*3/2)
+	fe.faces.Each(func(f FaceI) {
+		corners := [3]VertexI{f.GetA(), f.GetB(), f.GetC()}
+		for i, a := range corners {
+			b := corners[(i+1)%3]
+			if a != b && !seen[VertexPair{b, a}] {
+				seen[VertexPair{a, b}] = true
+			}
+		}
+	})
+	return len(seen)
+}
+
+func (fe *FaceEdges) IsEmpty() bool {
+	return fe.faces.IsEmpty()
+}
+
+func (fe *FaceEdges) Each(cb func(*Edge)) {
+	for _, edge := range fe.GetAll() {
+		cb(edge)
+	}
+}
+
+// Returns the edges for which cb returns true.
+func (fe *FaceEdges) Filter(cb func(*Edge) bool) (edges []*Edge) {
+	fe.Each(func(e *Edge) {
+		if cb(e) {
+			edges = append(edges, e)
+		}
+	})
+	return
+}
+
+// Returns the edge joining the given vertices, in either order, or nil if no
+// face uses both. Only the faces of v1 are searched.
+func (fe *FaceEdges) Between(v1, v2 VertexI) *Edge {
+	if v1 == v2 {
+		return nil
+	}
+	var edge *Edge
+	v1.EachFace(func(f FaceI) {
+		corners := [3]VertexI{f.GetA(), f.GetB(), f.GetC()}
+		for i, a := range corners {
+			b := corners[(i+1)%3]
+			if (a == v1 && b == v2) || (a == v2 && b == v1) {
+				if edge == nil {
+					edge = &Edge{V1: a, V2: b}
+				}
+				edge.Faces = append(edge.Faces, f)
+				return
+			}
+		}
+	})
+	return edge
+}
+
+// Returns the mesh's edges, derived from its faces whenever they're used so
+// they stay in sync as faces are added and removed.
+func (m *Mesh) GetEdges() EdgeCollection {
+	return NewFaceEdges(m.Faces)
+}
+
+// Removes faces from the mesh, and from the vertices which use them, along
+// with their attribute values.
+func (m *Mesh) RemoveFaces(faces ...FaceI) {
+	removed := make(map[FaceI]bool, len(faces))
+	for _, f := range faces {
+		removed[f] = true
+		if m.Attributes != nil {
+			m.Attributes.forgetFace(f)
+		}
+		f.EachVertex(func(v VertexI) {
+			if v.ReferencesFace(f) {
+				v.RemoveFace(f)
+			}
+		})
+	}
+	m.Faces.Filter(func(f FaceI) bool { return !removed[f] })
+	m.Faces.EachWithIndex(func(i int, f FaceI) { f.SetMeshLocation(m, i) })
+}
+
+// Removes vertices from the mesh along with the faces of the mesh which use
+// them, and the attribute values of both.
+func (m *Mesh) RemoveVertices(vertices ...VertexI) {
+	removed := make(map[VertexI]bool, len(vertices))
+	removed_faces := make(map[FaceI]bool)
+	faces := make([]FaceI, 0)
+	for _, v := range vertices {
+		removed[v] = true
+		v.EachFace(func(f FaceI) {
+			if f_mesh, _ := f.GetMeshLocation(); f_mesh == m && !removed_faces[f] {
+				removed_faces[f] = true
+				faces = append(faces, f)
+			}
+		})
+	}
+	m.RemoveFaces(faces...)
+	for _, v := range vertices {
+		if m.Attributes != nil {
+			m.Attributes.forgetVertex(v)
+		}
+		v.ForgetLocationInMesh(m)
+	}
+	m.Vertices.Filter(func(v VertexI) bool { return !removed[v] })
+	m.Vertices.EachWithIndex(func(i int, v VertexI) { v.SetLocationInMesh(m, i) })
+}
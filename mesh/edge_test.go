@@ -0,0 +1,92 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns a tetrahedron with outward facing faces, and its vertices.
+func testTetrahedron() (*Mesh, []VertexI) {
+	m := New("tetrahedron")
+	verts := []VertexI{
+		m.AddVertex(0, 0, 0), m.AddVertex(1, 0, 0),
+		m.AddVertex(0, 1, 0), m.AddVertex(0, 0, 1),
+	}
+	m.AddFace(verts[0], verts[2], verts[1])
+	m.AddFace(verts[0], verts[1], verts[3])
+	m.AddFace(verts[0], verts[3], verts[2])
+	m.AddFace(verts[1], verts[2], verts[3])
+	return m, verts
+}
+
+// Tests for GetEdges
+
+func TestEdges(t *testing.T) {
+	m, verts := testTetrahedron()
+	edges := m.GetEdges()
+	if edges.Len() != 6 || edges.IsEmpty() {
+		t.Error("Expected 6 edges, got", edges.Len())
+	}
+	edges.Each(func(e *Edge) {
+		if len(e.Faces) != 2 || e.IsBoundary() {
+			t.Error("Expected", e.ToString(), "to have two faces, got", len(e.Faces))
+		}
+		if angle := e.DihedralAngle(); angle <= 0 {
+			t.Error("Expected", e.ToString(), "to be convex, got", angle)
+		}
+	})
+
+	e := edges.Between(verts[1], verts[0])
+	if e == nil || e.V1 != verts[1] || e.V2 != verts[0] || len(e.Faces) != 2 {
+		t.Fatal("Expected edge between vertices 1 and 0, got", e)
+	}
+	if e.Length() != 1 || math.Abs(e.DihedralAngle()-math.Pi/2) > 1e-12 {
+		t.Error("Expected length 1 and dihedral angle pi/2, got", e.Length(),
+			e.DihedralAngle())
+	}
+	diagonal := edges.Between(verts[1], verts[2])
+	if diagonal == nil || math.Abs(diagonal.Length()-math.Sqrt2) > 1e-12 {
+		t.Error("Expected diagonal edge of length sqrt 2, got", diagonal)
+	}
+	if edges.Between(verts[0], verts[0]) != nil {
+		t.Error("Expected no edge from a vertex to itself")
+	}
+
+	// edges stay in sync as faces are removed and added
+	m.RemoveFaces(m.Faces.Get(3)[0])
+	boundary := edges.Filter(func(e *Edge) bool { return e.IsBoundary() })
+	if edges.Len() != 6 || len(boundary) != 3 {
+		t.Error("Expected 3 boundary edges after removing a face, got", len(boundary))
+	}
+	if math.IsNaN(e.DihedralAngle()) || !math.IsNaN(boundary[0].DihedralAngle()) {
+		t.Error("Expected only edges with two faces to have dihedral angles")
+	}
+	if len(verts[3].(*Vertex).Faces) != 2 {
+		t.Error("Expected removed face to be forgotten by its vertices")
+	}
+	extra := m.AddVertex(1, 1, 1)
+	m.AddFace(verts[1], verts[2], extra)
+	if edges.Len() != 8 || edges.Between(extra, verts[2]) == nil {
+		t.Error("Expected added face's edges, got", edges.Len())
+	}
+}
+
+func TestDihedralAngleSign(t *testing.T) {
+	type dihedralTestParams struct {
+		z     float64
+		angle float64
+	}
+	// two triangles sharing the y axis, with their far corners raised to z
+	for _, params := range []dihedralTestParams{
+		{0, 0}, {1, -math.Pi / 2}, {-1, math.Pi / 2},
+	} {
+		m := New("fold")
+		a, b := m.AddVertex(0, 0, 0), m.AddVertex(0, 1, 0)
+		m.AddFace(a, m.AddVertex(1, 0, params.z), b)
+		m.AddFace(b, m.AddVertex(-1, 0, params.z), a)
+		angle := m.GetEdges().Between(a, b).DihedralAngle()
+		if math.Abs(angle-params.angle) > 1e-12 {
+			t.Error("For z", params.z, "expected", params.angle, "got", angle)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package mesh
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// An error in the contents of a file being read, locating the problem so that
+// it can be reported or, with errors.As, inspected.
+type ParseError struct {
+	// The file format, such as "OBJ".
+	Format string
+	// The one based line number, or zero if it isn't known.
+	Line int
+	// The one based column of Token within the line, or zero if it isn't known.
+	Column int
+	// The malformed statement or value, if known.
+	Token string
+	// The underlying error, if any.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	message := "Error parsing " + e.Format + " file"
+	if e.Line > 0 {
+		message += " on line " + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			message += ", column " + strconv.Itoa(e.Column)
+		}
+	}
+	if e.Token != "" {
+		message += " at " + strconv.Quote(e.Token)
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func newParseError(format string, line_no int) error {
+	return &ParseError{Format: format, Line: line_no}
+}
+
+// Returns a ParseError for a malformed token on the given line, which is
+// located to find its column. If no token is given, the value a strconv error
+// failed to parse is used.
+func newTokenError(format string, line_no int, line, token string, cause error) error {
+	var num_err *strconv.NumError
+	if token == "" && errors.As(cause, &num_err) {
+		token = num_err.Num
+	}
+	column := 0
+	if token != "" {
+		column = strings.Index(line, token) + 1
+	}
+	return &ParseError{
+		Format: format, Line: line_no, Column: column, Token: token, Err: cause,
+	}
+}
+
+// Options controlling how text formats are read.
+type ParseOptions struct {
+	// Skip malformed lines rather than failing, recording each one as a
+	// warning. Skipping a vertex, texture coordinate or normal doesn't shift
+	// the indices of those which follow it, and faces which reference skipped
+	// or undefined elements are also skipped. Only OBJ and MTL files can be
+	// read leniently.
+	Lenient bool
+	// If given, receives the warnings of a lenient read.
+	Report *ParseReport
+}
+
+// The problems skipped over by a lenient read.
+type ParseReport struct {
+	Warnings []*ParseError
+}
+
+// Returns nil after recording err as a warning if it's a ParseError and
+// parsing is lenient, or err otherwise.
+func (o *ParseOptions) tolerate(err error) error {
+	var parse_err *ParseError
+	if !o.Lenient || !errors.As(err, &parse_err) {
+		return err
+	}
+	if o.Report != nil {
+		o.Report.Warnings = append(o.Report.Warnings, parse_err)
+	}
+	return nil
+}
+
+// The most values of a single array or list which readers accept from a file,
+// so that a corrupt count can't exhaust memory before the data runs out.
+const maxReadValues = 1 << 26
+
+// The number of values readers allocate for at a time while reading an array,
+// so that memory is only allocated for values which are actually present.
+const readChunkValues = 1 << 16
+
+// Returns the number of values making up count elements of the given number of
+// components, and whether it's no more than maxReadValues.
+func readValueCount(count, components int) (int, bool) {
+	if count < 0 || components < 0 ||
+		(components > 0 && count > maxReadValues/components) {
+		return 0, false
+	}
+	return count * components, true
+}
+
+// Returns how many of the remaining values of an array to read next.
+func readChunkSize(remaining int) int {
+	if remaining > readChunkValues {
+		return readChunkValues
+	}
+	return remaining
+}
@@ -0,0 +1,144 @@
+package mesh
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type parseErrorTestParams struct {
+	input  string
+	line   int
+	column int
+	token  string
+}
+
+var parseErrorTests = []parseErrorTestParams{
+	{"v 0 0 0\nv 1 x 0\n", 2, 5, "x"},
+	{"# comment\n\nv 0 0\n", 3, 1, "v"},
+	{"v 0 0 0\nv 1 0 0\nv 1 1 0\n  f 1 2 x/\\\n 3\n", 4, 9, "x/"},
+	{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3 4/-1\nbogus\n", 4, 9, "4/-1"},
+	{"bogus 1 2 3\n", 1, 1, "bogus"},
+}
+
+// Tests for ParseError
+
+func TestParseErrorLocation(t *testing.T) {
+	for _, params := range parseErrorTests {
+		r := io.Reader(strings.NewReader(params.input))
+		_, err := LoadOBJ(&r)
+		var parse_err *ParseError
+		if !errors.As(err, &parse_err) {
+			t.Error("For OBJ", params.input, "expected a ParseError, got", err)
+			continue
+		}
+		if parse_err.Format != "OBJ" || parse_err.Line != params.line ||
+			parse_err.Column != params.column || parse_err.Token != params.token {
+			t.Error("For OBJ", params.input, "expected", params.line, params.column,
+				params.token, "got", parse_err.Line, parse_err.Column, parse_err.Token)
+		}
+	}
+
+	r := io.Reader(strings.NewReader("v 0 0 1e999\n"))
+	_, err := LoadOBJ(&r)
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Error("Expected ParseError to wrap strconv.ErrRange, got", err)
+	}
+	expected := `Error parsing OBJ file on line 1, column 7 at "1e999": ` +
+		`strconv.ParseFloat: parsing "1e999": value out of range`
+	if err.Error() != expected {
+		t.Error("Expected", expected, "got", err.Error())
+	}
+
+	r = io.Reader(strings.NewReader("OFF\n3 1 0\n0 0 0\n1 0 x\n"))
+	_, err = LoadOFF(&r)
+	var parse_err *ParseError
+	if !errors.As(err, &parse_err) || parse_err.Line != 4 {
+		t.Error("Expected OFF error on line 4, got", err)
+	}
+}
+
+// Tests for lenient parsing
+
+func TestLenientOBJ(t *testing.T) {
+	input := `v 0 0 0
+v 1 0 0
+v 1 1 0
+junk from the scanner
+v 0 1 nan?
+vn 0 0
+f 1 2 3
+f 1 3 9
+usemtl
+f 1 2
+`
+	r := io.Reader(strings.NewReader(input))
+	if _, err := LoadOBJ(&r); err == nil {
+		t.Error("Expected an error reading strictly")
+	}
+
+	report := ParseReport{}
+	r = io.Reader(strings.NewReader(input))
+	m, err := LoadOBJ(&r, ParseOptions{Lenient: true, Report: &report})
+	if err != nil {
+		t.Error("Expected no error reading leniently, got", err)
+		return
+	}
+	if m.Vertices.Len() != 3 || m.Faces.Len() != 1 {
+		t.Error("Expected 3 vertices and 1 face, got", m.Vertices.Len(), m.Faces.Len())
+	}
+	expected_lines := []int{4, 5, 6, 9, 10, 0}
+	if len(report.Warnings) != len(expected_lines) {
+		t.Error("Expected", len(expected_lines), "warnings, got", report.Warnings)
+		return
+	}
+	for i, warning := range report.Warnings {
+		if warning.Line != expected_lines[i] {
+			t.Error("For warning", warning, "expected line", expected_lines[i])
+		}
+	}
+
+	// skipped elements keep their indices, and faces using them are skipped
+	input = `v 0 0 0
+v 1 0 x
+v 1 1 0
+v 0 1 0
+vn 0 0 1
+vn 0 0
+vn 0 0 1
+f 1 3 4
+f 1 2 3
+f 1//1 3//3 4//3
+f 1//2 3//3 4//3
+`
+	report = ParseReport{}
+	r = io.Reader(strings.NewReader(input))
+	m, err = LoadOBJ(&r, ParseOptions{Lenient: true, Report: &report})
+	if err != nil || m.Vertices.Len() != 3 || m.Faces.Len() != 2 {
+		t.Error("Expected 3 vertices and 2 faces, got", m.Vertices.Len(), m.Faces.Len(), err)
+		return
+	}
+	if b := m.Faces.Get(0)[0].GetB(); b.GetX() != 1 || b.GetY() != 1 {
+		t.Error("Expected face to reference the vertex it names, got", b.ToString())
+	}
+	expected_lines = []int{2, 6, 9, 11}
+	if len(report.Warnings) != len(expected_lines) {
+		t.Error("Expected", len(expected_lines), "warnings, got", report.Warnings)
+		return
+	}
+	for i, warning := range report.Warnings {
+		if warning.Line != expected_lines[i] {
+			t.Error("For warning", warning, "expected line", expected_lines[i])
+		}
+	}
+
+	r = io.Reader(strings.NewReader("Kd 1 0 0\nnewmtl a\nKd 1 x 0\nNs 10\n"))
+	report = ParseReport{}
+	mats, err := LoadMTL(&r, ParseOptions{Lenient: true, Report: &report})
+	if err != nil || len(mats) != 1 || mats[0].Shininess != 10 ||
+		len(report.Warnings) != 2 || report.Warnings[1].Token != "x" {
+		t.Error("Expected lenient MTL to skip two lines, got", mats, report.Warnings, err)
+	}
+}
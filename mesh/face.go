@@ -12,19 +12,37 @@ type FaceI interface {
 	SetA(v VertexI)
 	SetB(v VertexI)
 	SetC(v VertexI)
-	GetMeshLocation() (Mesh, int)
-	SetMeshLocation(Mesh, int)
+	GetMeshLocation() (*Mesh, int)
+	SetMeshLocation(*Mesh, int)
 	AsTriangle() geom.Triangle
+	GetNormal() *geom.Vec3
+	SetNormal(*geom.Vec3)
+	GetTexCoords() [3]*geom.Vec3
+	SetTexCoords([3]*geom.Vec3)
+	GetGroup() FaceGroup
+	SetGroup(FaceGroup)
 	ReferencesVertex(VertexI) bool
 	EachVertex(func(VertexI))
 	ReplaceVertex(VertexI, VertexI)
 	ToString() string
 }
 
+// Describes the part of a mesh a face belongs to, in terms of the object,
+// group and material statements of an OBJ file.
+type FaceGroup struct {
+	Object   string
+	Group    string
+	Material string
+}
+
 type Face struct {
 	Vertices [3]VertexI
-	Mesh     Mesh
+	Mesh     *Mesh
 	Index    int
+	Normal   *geom.Vec3
+	// Texture coordinates of each corner of the face, where known.
+	TexCoords [3]*geom.Vec3
+	Group     FaceGroup
 }
 
 func (f *Face) GetA() VertexI { return f.Vertices[0] }
@@ -35,8 +53,8 @@ func (f *Face) SetA(v VertexI) { f.Vertices[0] = v }
 func (f *Face) SetB(v VertexI) { f.Vertices[1] = v }
 func (f *Face) SetC(v VertexI) { f.Vertices[2] = v }
 
-func (f *Face) GetMeshLocation() (Mesh, int) { return f.Mesh, f.Index }
-func (f *Face) SetMeshLocation(m Mesh, i int) {
+func (f *Face) GetMeshLocation() (*Mesh, int) { return f.Mesh, f.Index }
+func (f *Face) SetMeshLocation(m *Mesh, i int) {
 	f.Mesh = m
 	f.Index = i
 }
@@ -49,6 +67,15 @@ func (f *Face) AsTriangle() geom.Triangle {
 	}
 }
 
+func (f *Face) GetNormal() *geom.Vec3  { return f.Normal }
+func (f *Face) SetNormal(n *geom.Vec3) { f.Normal = n }
+
+func (f *Face) GetTexCoords() [3]*geom.Vec3  { return f.TexCoords }
+func (f *Face) SetTexCoords(t [3]*geom.Vec3) { f.TexCoords = t }
+
+func (f *Face) GetGroup() FaceGroup  { return f.Group }
+func (f *Face) SetGroup(g FaceGroup) { f.Group = g }
+
 func (f *Face) ReferencesVertex(v VertexI) bool {
 	return f.Vertices[0] == v || f.Vertices[1] == v || f.Vertices[2] == v
 }
@@ -77,3 +104,48 @@ func (f *Face) ToString() string {
 		strconv.Itoa(f.Vertices[1].GetLocationInMesh(f.Mesh)) + " " +
 		strconv.Itoa(f.Vertices[2].GetLocationInMesh(f.Mesh)) + "}"
 }
+
+// Returns the texture coordinates of each of the vertices, taken from the first
+// corner of the faces using it which has any, for formats which store them per
+// vertex. Returns nil if no face has texture coordinates.
+func vertexTexCoords(vertices []VertexI, faces FaceCollection) []*geom.Vec3 {
+	indices := make(map[VertexI]int, len(vertices))
+	for i, v := range vertices {
+		indices[v] = i
+	}
+	var tex_coords []*geom.Vec3
+	faces.Each(func(f FaceI) {
+		vts := f.GetTexCoords()
+		corner := 0
+		f.EachVertex(func(v VertexI) {
+			if i, found := indices[v]; found && vts[corner] != nil {
+				if tex_coords == nil {
+					tex_coords = make([]*geom.Vec3, len(vertices))
+				}
+				if tex_coords[i] == nil {
+					tex_coords[i] = vts[corner]
+				}
+			}
+			corner++
+		})
+	})
+	return tex_coords
+}
+
+// Gives the corners of the faces of each vertex the texture coordinates of the
+// vertex, for formats which store them per vertex.
+func setVertexTexCoords(vertices []VertexI, tex_coords []*geom.Vec3) {
+	for i, v := range vertices {
+		v.EachFace(func(f FaceI) {
+			vts := f.GetTexCoords()
+			corner := 0
+			f.EachVertex(func(corner_vertex VertexI) {
+				if corner_vertex == v {
+					vts[corner] = tex_coords[i]
+				}
+				corner++
+			})
+			f.SetTexCoords(vts)
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package mesh
+
+import (
+	"github.com/nat-n/geom"
+	"strconv"
+)
+
+import tb "github.com/nat-n/gomesh/triplebuffer"
+
+// A FaceCollection which stores the vertex indices of its faces contiguously
+// in a triplebuffer.TriangleBuffer, in the order of the collection, as
+// indices into a VertexBuffer.
+// It can only hold BufferFace views of its own, which are created with NewFace
+// (or Mesh.AddFace) from vertices of its VertexBuffer. Normals, tex coords,
+// groups and mesh locations are kept on the views.
+type FaceBuffer struct {
+	Triangles tb.TriangleBuffer
+	vertices  *VertexBuffer
+	faces     []*BufferFace
+}
+
+// Constructs a FaceBuffer for faces between the vertices of the given buffer,
+// which keeps the triangles up to date as its vertices are removed.
+func NewFaceBuffer(vertices *VertexBuffer) *FaceBuffer {
+	fb := &FaceBuffer{Triangles: tb.NewTriangleBuffer(), vertices: vertices}
+	vertices.faces = append(vertices.faces, fb)
+	return fb
+}
+
+// Appends a new face joining the given vertices, and returns it. The face
+// isn't registered with its vertices.
+func (fb *FaceBuffer) NewFace(a, b, c VertexI) *BufferFace {
+	f := &BufferFace{buffer: fb, owner: fb, index: len(fb.faces)}
+	fb.Triangles.Append(fb.vertexIndex(a), fb.vertexIndex(b), fb.vertexIndex(c))
+	fb.faces = append(fb.faces, f)
+	return f
+}
+
+// Returns the index of a vertex of the vertex buffer.
+func (fb *FaceBuffer) vertexIndex(v VertexI) int {
+	return fb.vertices.own(v).index
+}
+
+// Returns f as one of the buffer's own faces, or panics.
+func (fb *FaceBuffer) own(f FaceI) *BufferFace {
+	bf, ok := f.(*BufferFace)
+	if !ok || (bf.buffer != fb && (bf.buffer != nil || bf.owner != fb)) {
+		panic("FaceBuffer can only hold faces created by its NewFace method")
+	}
+	return bf
+}
+
+// Updates the vertex indices of the triangles, given where each vertex index
+// has moved to (or -1 where the vertex was removed).
+func (fb *FaceBuffer) moveVertices(moved []int) {
+	for i, index := range fb.Triangles.Buffer {
+		if index >= 0 && index < len(moved) {
+			fb.Triangles.Buffer[i] = moved[index]
+		}
+	}
+}
+
+func (fb *FaceBuffer) Len() int {
+	return len(fb.faces)
+}
+
+func (fb *FaceBuffer) Get(indices ...int) (r []FaceI) {
+	for _, i := range indices {
+		r = append(r, fb.faces[i])
+	}
+	return
+}
+
+// Puts the face at index i, in place of the face there. A face which already
+// occurs in the buffer keeps its vertices at its existing index. The face
+// replaced keeps its vertices itself unless it occurs elsewhere in the buffer.
+func (fb *FaceBuffer) Update(i int, f FaceI) {
+	bf := fb.own(f)
+	old := fb.faces[i]
+	if old == bf {
+		return
+	}
+	a, b, c := bf.indices()
+	if old.buffer == fb && old.index == i {
+		other := -1
+		for j, g := range fb.faces {
+			if g == old && j != i {
+				other = j
+				break
+			}
+		}
+		if other >= 0 {
+			old.index = other
+		} else {
+			old.Vertices = [3]VertexI{old.GetA(), old.GetB(), old.GetC()}
+			old.buffer = nil
+		}
+	}
+	fb.faces[i] = bf
+	fb.Triangles.UpdateOne(i, a, b, c)
+	if bf.buffer == nil {
+		bf.buffer, bf.index = fb, i
+	}
+}
+
+func (fb *FaceBuffer) GetAll() []FaceI {
+	r := make([]FaceI, len(fb.faces), len(fb.faces))
+	for i, f := range fb.faces {
+		r[i] = f
+	}
+	return r
+}
+
+// Appends faces of the buffer again, such as ones which have been removed.
+func (fb *FaceBuffer) Append(faces ...FaceI) {
+	for _, f := range faces {
+		bf := fb.own(f)
+		a, b, c := bf.indices()
+		fb.Triangles.Append(a, b, c)
+		if bf.buffer == nil {
+			bf.buffer, bf.index = fb, len(fb.faces)
+		}
+		fb.faces = append(fb.faces, bf)
+	}
+}
+
+// Removes the faces at each index in turn, as FaceSlice does.
+func (fb *FaceBuffer) Remove(indices ...int) {
+	kept := append([]*BufferFace{}, fb.faces...)
+	for _, i := range indices {
+		kept = append(kept[:i], kept[i+1:]...)
+	}
+	fb.reindex(kept)
+}
+
+func (fb *FaceBuffer) Filter(cb func(FaceI) bool) {
+	kept := make([]*BufferFace, 0)
+	for _, f := range fb.faces {
+		if cb(f) {
+			kept = append(kept, f)
+		}
+	}
+	fb.reindex(kept)
+}
+
+// Rebuilds the buffer to hold the given faces in order, updating their
+// indices. Faces which are no longer in the buffer keep their vertices
+// themselves.
+func (fb *FaceBuffer) reindex(faces []*BufferFace) {
+	triangles := make([]int, 0, len(faces)*3)
+	new_indices := make(map[*BufferFace]int, len(faces))
+	for i, f := range faces {
+		a, b, c := f.indices()
+		triangles = append(triangles, a, b, c)
+		if _, found := new_indices[f]; !found {
+			new_indices[f] = i
+		}
+	}
+	for _, f := range fb.faces {
+		if _, found := new_indices[f]; !found && f.buffer == fb {
+			f.Vertices = [3]VertexI{f.GetA(), f.GetB(), f.GetC()}
+			f.buffer = nil
+		}
+	}
+	fb.Triangles.Buffer = triangles
+	fb.faces = faces
+	for f, i := range new_indices {
+		f.index = i
+	}
+}
+
+func (fb *FaceBuffer) Each(cb func(FaceI)) {
+	for _, f := range fb.faces {
+		cb(f)
+	}
+}
+
+func (fb *FaceBuffer) EachWithIndex(cb func(int, FaceI)) {
+	for i, f := range fb.faces {
+		cb(i, f)
+	}
+}
+
+func (fb *FaceBuffer) IsEmpty() bool {
+	return len(fb.faces) == 0
+}
+
+func (fb *FaceBuffer) ToString() string {
+	return "{FaceBuffer " + fb.Triangles.ToString() + "}"
+}
+
+func (fb *FaceBuffer) IndicesAsCSV() string {
+	return (&FaceSlice{fb.GetAll()}).IndicesAsCSV()
+}
+
+// A face of a FaceBuffer, whose vertices are stored as indices in the buffer
+// rather than in the embedded Face, which holds everything else. Once removed
+// from the buffer, its vertices are kept in the embedded Face instead.
+type BufferFace struct {
+	Face
+	// the buffer holding the vertex indices, or nil once removed from it
+	buffer *FaceBuffer
+	owner  *FaceBuffer
+	index  int
+}
+
+// Returns the indices in the vertex buffer of the face's vertices, or -1 for
+// vertices which aren't in it.
+func (f *BufferFace) indices() (a, b, c int) {
+	if f.buffer != nil {
+		t := f.buffer.Triangles.Buffer[f.index*3:]
+		return t[0], t[1], t[2]
+	}
+	index := func(v VertexI) int {
+		if bv, ok := v.(*BufferVertex); ok && bv.buffer == f.owner.vertices {
+			return bv.index
+		}
+		return -1
+	}
+	return index(f.Vertices[0]), index(f.Vertices[1]), index(f.Vertices[2])
+}
+
+func (f *BufferFace) vertex(i int) VertexI {
+	if f.buffer == nil {
+		return f.Vertices[i]
+	}
+	index := f.buffer.Triangles.Buffer[f.index*3+i]
+	if index < 0 {
+		return nil
+	}
+	return f.buffer.vertices.vertices[index]
+}
+
+func (f *BufferFace) setVertex(i int, v VertexI) {
+	if f.buffer == nil {
+		f.Vertices[i] = v
+		return
+	}
+	f.buffer.Triangles.Buffer[f.index*3+i] = f.buffer.vertexIndex(v)
+}
+
+func (f *BufferFace) GetA() VertexI { return f.vertex(0) }
+func (f *BufferFace) GetB() VertexI { return f.vertex(1) }
+func (f *BufferFace) GetC() VertexI { return f.vertex(2) }
+
+func (f *BufferFace) SetA(v VertexI) { f.setVertex(0, v) }
+func (f *BufferFace) SetB(v VertexI) { f.setVertex(1, v) }
+func (f *BufferFace) SetC(v VertexI) { f.setVertex(2, v) }
+
+func (f *BufferFace) AsTriangle() geom.Triangle {
+	return geom.Triangle{f.GetA(), f.GetB(), f.GetC()}
+}
+
+func (f *BufferFace) ReferencesVertex(v VertexI) bool {
+	return f.GetA() == v || f.GetB() == v || f.GetC() == v
+}
+
+func (f *BufferFace) EachVertex(cb func(VertexI)) {
+	cb(f.GetA())
+	cb(f.GetB())
+	cb(f.GetC())
+}
+
+func (f *BufferFace) ReplaceVertex(old_vert, new_vert VertexI) {
+	for i := 0; i < 3; i++ {
+		if f.vertex(i) == old_vert {
+			f.setVertex(i, new_vert)
+			return
+		}
+	}
+	panic("didn't find old_vert to replace in face")
+}
+
+func (f *BufferFace) ToString() string {
+	return "{Face " +
+		strconv.Itoa(f.GetA().GetLocationInMesh(f.Mesh)) + " " +
+		strconv.Itoa(f.GetB().GetLocationInMesh(f.Mesh)) + " " +
+		strconv.Itoa(f.GetC().GetLocationInMesh(f.Mesh)) + "}"
+}
@@ -0,0 +1,313 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A mesh file format which ReadFile, WriteFile and Load can dispatch to.
+// Formats are identified by the extension of a file's path, or failing that by
+// sniffing the first bytes of its contents.
+type Format struct {
+	Name string
+	// Extensions of files in this format, including the leading dot.
+	Extensions []string
+	// Reports whether the leading bytes of a file (up to sniffLength of them)
+	// look like this format. May be nil if the format can't be recognised.
+	Sniff func([]byte) bool
+	Read  func(io.Reader) (*Mesh, error)
+	Write func(*Mesh, io.Writer) error
+	// Optional variants of Read and Write taking a path, which ReadFile and
+	// WriteFile use in preference so that formats can handle companion files.
+	ReadFile  func(string) (*Mesh, error)
+	WriteFile func(*Mesh, string) error
+}
+
+// The number of leading bytes of a file passed to Format.Sniff.
+const sniffLength = 512
+
+var (
+	formatsLock sync.RWMutex
+	formats     = make([]*Format, 0)
+)
+
+// Registers a format for use by ReadFile, WriteFile and Load. A format
+// registered with the same name as an existing format replaces it.
+func RegisterFormat(f *Format) {
+	formatsLock.Lock()
+	defer formatsLock.Unlock()
+	for i, existing := range formats {
+		if existing.Name == f.Name {
+			formats[i] = f
+			return
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Returns the registered format with the given name, or nil.
+func LookupFormat(name string) *Format {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	for _, f := range formats {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the registered format for the extension of the given path, or nil.
+// The extension of any compression scheme is ignored.
+func FormatForPath(path string) *Format {
+	ext := strings.ToLower(filepath.Ext(trimCompressionExt(path)))
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	for _, f := range formats {
+		for _, f_ext := range f.Extensions {
+			if ext == strings.ToLower(f_ext) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the first registered format which recognises the given leading
+// bytes of a file, or nil.
+func SniffFormat(header []byte) *Format {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	for _, f := range formats {
+		if f.Sniff != nil && f.Sniff(header) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Read a mesh from a file in any registered format.
+func ReadFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	buffered := bufio.NewReader(input_file)
+	format := FormatForPath(input_path)
+	if format == nil {
+		header, _ := buffered.Peek(sniffLength)
+		format = SniffFormat(header)
+	}
+	if format == nil {
+		err = errors.New("Unrecognised mesh file format: " + input_path)
+		return
+	}
+
+	if format.ReadFile != nil {
+		return format.ReadFile(input_path)
+	}
+	if format.Read == nil {
+		err = errors.New("Reading " + format.Name + " files is not supported")
+		return
+	}
+	return format.Read(buffered)
+}
+
+// Read a mesh in any registered format which can be recognised by sniffing.
+func Load(mesh_reader *io.Reader) (m *Mesh, err error) {
+	buffered := bufio.NewReader(*mesh_reader)
+	header, _ := buffered.Peek(sniffLength)
+	format := SniffFormat(header)
+	if format == nil {
+		err = errors.New("Unrecognised mesh format")
+		return
+	}
+	if format.Read == nil {
+		err = errors.New("Reading " + format.Name + " is not supported")
+		return
+	}
+	return format.Read(buffered)
+}
+
+// Write this mesh to a file in the registered format for its extension.
+func (m *Mesh) WriteFile(output_path string) (err error) {
+	format := FormatForPath(output_path)
+	if format == nil {
+		return errors.New("No mesh format registered for " + output_path)
+	}
+	if format.WriteFile != nil {
+		return format.WriteFile(m, output_path)
+	}
+	if format.Write == nil {
+		return errors.New("Writing " + format.Name + " files is not supported")
+	}
+
+	err = writeFile(output_path, func(w io.Writer) error {
+		return format.Write(m, w)
+	})
+	return
+}
+
+// Returns the first line of the header which isn't blank or a comment.
+func firstStatement(header []byte, comment string) []byte {
+	for _, line := range bytes.Split(header, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && !bytes.HasPrefix(line, []byte(comment)) {
+			return line
+		}
+	}
+	return nil
+}
+
+func sniffOBJ(header []byte) bool {
+	words := bytes.Fields(firstStatement(header, "#"))
+	if len(words) == 0 {
+		return false
+	}
+	switch string(words[0]) {
+	case "v", "vt", "vn", "f", "o", "g", "s", "mtllib", "usemtl":
+		return true
+	}
+	return false
+}
+
+func sniffSTL(header []byte) bool {
+	return isASCIISTL(bufio.NewReader(bytes.NewReader(header)))
+}
+
+func sniffPLY(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("ply\n")) ||
+		bytes.HasPrefix(header, []byte("ply\r\n"))
+}
+
+func sniffGLB(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("glTF"))
+}
+
+func sniffGLTF(header []byte) bool {
+	trimmed := bytes.TrimSpace(header)
+	return bytes.HasPrefix(trimmed, []byte("{")) &&
+		bytes.Contains(trimmed, []byte(`"asset"`))
+}
+
+// Reads a glTF document as a single mesh, combining multiple meshes.
+func loadCombinedGLTF(r io.Reader) (*Mesh, error) {
+	meshes, err := LoadGLTF(&r)
+	if err != nil {
+		return nil, err
+	}
+	return combineMeshes(meshes), nil
+}
+
+func readCombinedGLTFFile(input_path string) (*Mesh, error) {
+	meshes, err := ReadGLTFFile(input_path)
+	if err != nil {
+		return nil, err
+	}
+	return combineMeshes(meshes), nil
+}
+
+// Copies the vertices, faces, materials and attributes of several meshes into
+// a single new mesh, which takes the name of the first.
+func combineMeshes(meshes []*Mesh) *Mesh {
+	if len(meshes) == 1 {
+		return meshes[0]
+	}
+	name := ""
+	if len(meshes) > 0 {
+		name = meshes[0].Name
+	}
+	combined := New(name)
+	for _, m := range meshes {
+		combined.appendCopy(m)
+		if m.Materials != nil {
+			combined.Materials.Add(m.Materials.Materials...)
+		}
+	}
+	return combined
+}
+
+func init() {
+	RegisterFormat(&Format{
+		Name:       "obj",
+		Extensions: []string{".obj"},
+		Sniff:      sniffOBJ,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadOBJ(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WriteOBJ(w) },
+		ReadFile:   func(path string) (*Mesh, error) { return ReadOBJFile(path) },
+		WriteFile:  func(m *Mesh, path string) error { return m.WriteOBJFile(path) },
+	})
+	RegisterFormat(&Format{
+		Name:       "stl",
+		Extensions: []string{".stl"},
+		Sniff:      sniffSTL,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadSTLFrom(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WriteSTLTo(w) },
+	})
+	RegisterFormat(&Format{
+		Name:       "ply",
+		Extensions: []string{".ply"},
+		Sniff:      sniffPLY,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadPLY(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WritePLY(w) },
+	})
+	RegisterFormat(&Format{
+		Name:       "glb",
+		Extensions: []string{".glb"},
+		Sniff:      sniffGLB,
+		Read:       loadCombinedGLTF,
+		Write:      (*Mesh).WriteGLB,
+		ReadFile:   readCombinedGLTFFile,
+	})
+	RegisterFormat(&Format{
+		Name:       "gltf",
+		Extensions: []string{".gltf"},
+		Sniff:      sniffGLTF,
+		Read:       loadCombinedGLTF,
+		Write:      (*Mesh).WriteGLTF,
+		ReadFile:   readCombinedGLTFFile,
+		WriteFile:  (*Mesh).WriteGLTFFile,
+	})
+	RegisterFormat(&Format{
+		Name:       "off",
+		Extensions: []string{".off"},
+		Sniff:      sniffOFF,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadOFF(&r) },
+		Write:      (*Mesh).WriteOFF,
+	})
+	RegisterFormat(&Format{
+		Name:       "vtk",
+		Extensions: []string{".vtk"},
+		Sniff:      sniffVTK,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadVTK(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WriteVTK(w) },
+	})
+	RegisterFormat(&Format{
+		Name:       "vtp",
+		Extensions: []string{".vtp"},
+		Sniff:      sniffVTP,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadVTP(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WriteVTP(w) },
+	})
+	RegisterFormat(&Format{
+		Name:       "threejs",
+		Extensions: []string{".json"},
+		Sniff:      sniffThreeJS,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadThreeJS(&r) },
+		Write:      func(m *Mesh, w io.Writer) error { return m.WriteThreeJS(w) },
+	})
+	RegisterFormat(&Format{
+		Name:       "gomesh",
+		Extensions: []string{".gomesh"},
+		Sniff:      sniffNative,
+		Read:       func(r io.Reader) (*Mesh, error) { return LoadNative(&r) },
+		Write:      (*Mesh).WriteNative,
+	})
+}
@@ -0,0 +1,74 @@
+package mesh
+
+import (
+	cb "github.com/nat-n/gomesh/cuboid"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests for ReadFile and WriteFile
+
+var formatFileNames = []string{
+	"cube.obj", "cube.stl", "cube.ply", "cube.glb", "cube.gltf", "cube.gomesh",
+	"cube.off", "cube.vtk", "cube.vtp", "cube.json",
+	"CUBE.PLY",
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFromCuboid(*cb.New(0, 0, 0, 1, 2, 3))
+	for _, name := range formatFileNames {
+		path := filepath.Join(dir, name)
+		if err := m.WriteFile(path); err != nil {
+			t.Error("For", name, "expected no error writing, got", err)
+			continue
+		}
+		m2, err := ReadFile(path)
+		if err != nil {
+			t.Error("For", name, "expected no error reading, got", err)
+			continue
+		}
+		if m2.Vertices.Len() != 8 || m2.Faces.Len() != 12 {
+			t.Error("For", name, "expected 8 vertices and 12 faces, got",
+				m2.Vertices.Len(), m2.Faces.Len())
+		}
+
+		// the same file should be recognised from its contents alone
+		unnamed := filepath.Join(dir, "unnamed.dat")
+		data, _ := os.ReadFile(path)
+		os.WriteFile(unnamed, data, 0644)
+		if filepath.Ext(name) == ".stl" {
+			// binary STL has no magic number
+			continue
+		}
+		if _, err = ReadFile(unnamed); err != nil {
+			t.Error("For", name, "expected format to be sniffed, got", err)
+		}
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	read := false
+	RegisterFormat(&Format{
+		Name:       "test",
+		Extensions: []string{".testmesh"},
+		Read: func(r io.Reader) (*Mesh, error) {
+			read = true
+			return New("test"), nil
+		},
+	})
+	path := filepath.Join(t.TempDir(), "a.testmesh")
+	os.WriteFile(path, []byte("anything"), 0644)
+	m, err := ReadFile(path)
+	if err != nil || !read || m.Name != "test" {
+		t.Error("Expected registered format to be used, got", m, err)
+	}
+	if err = New("").WriteFile(path); err == nil {
+		t.Error("Expected error writing format without a writer")
+	}
+	if LookupFormat("test") == nil {
+		t.Error("Expected to look up registered format by name")
+	}
+}
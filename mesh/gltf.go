@@ -0,0 +1,1024 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+// Constants of the glTF 2.0 specification used when reading and writing.
+const (
+	gltfArrayBuffer        = 34962
+	gltfElementArrayBuffer = 34963
+	gltfUnsignedShort      = 5123
+	gltfUnsignedInt        = 5125
+	gltfFloat              = 5126
+	gltfTriangles          = 4
+	glbMagic               = 0x46546C67 // "glTF"
+	glbJSONChunk           = 0x4E4F534A // "JSON"
+	glbBINChunk            = 0x004E4942 // "BIN\x00"
+)
+
+// The subset of the glTF 2.0 document structure used by gomesh.
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       *int             `json:"scene,omitempty"`
+	Scenes      []gltfScene      `json:"scenes,omitempty"`
+	Nodes       []gltfNode       `json:"nodes,omitempty"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+	Name  string `json:"name,omitempty"`
+	Nodes []int  `json:"nodes,omitempty"`
+}
+
+type gltfNode struct {
+	Name        string    `json:"name,omitempty"`
+	Mesh        *int      `json:"mesh,omitempty"`
+	Children    []int     `json:"children,omitempty"`
+	Matrix      []float64 `json:"matrix,omitempty"`
+	Translation []float64 `json:"translation,omitempty"`
+	Rotation    []float64 `json:"rotation,omitempty"`
+	Scale       []float64 `json:"scale,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices,omitempty"`
+	Material   *int           `json:"material,omitempty"`
+	Mode       *int           `json:"mode,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name                 string                    `json:"name,omitempty"`
+	PBRMetallicRoughness *gltfPBRMetallicRoughness `json:"pbrMetallicRoughness,omitempty"`
+	AlphaMode            string                    `json:"alphaMode,omitempty"`
+	DoubleSided          bool                      `json:"doubleSided,omitempty"`
+}
+
+type gltfPBRMetallicRoughness struct {
+	BaseColorFactor []float64 `json:"baseColorFactor,omitempty"`
+	MetallicFactor  *float64  `json:"metallicFactor,omitempty"`
+	RoughnessFactor *float64  `json:"roughnessFactor,omitempty"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int      `json:"bufferView,omitempty"`
+	ByteOffset    int       `json:"byteOffset,omitempty"`
+	ComponentType int       `json:"componentType"`
+	Normalized    bool      `json:"normalized,omitempty"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Max           []float64 `json:"max,omitempty"`
+	Min           []float64 `json:"min,omitempty"`
+	// Sparse accessors aren't supported, but must be detected when reading.
+	Sparse json.RawMessage `json:"sparse,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int  `json:"buffer"`
+	ByteOffset int  `json:"byteOffset,omitempty"`
+	ByteLength int  `json:"byteLength"`
+	ByteStride *int `json:"byteStride,omitempty"`
+	Target     int  `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri,omitempty"`
+	ByteLength int    `json:"byteLength"`
+}
+
+// Accumulates the binary buffer of a glTF document along with the buffer views
+// and accessors describing it.
+type gltfBuilder struct {
+	doc    gltfDocument
+	buffer bytes.Buffer
+}
+
+// Appends data to the buffer as a new buffer view and returns its index.
+// Every view is aligned to four bytes, which satisfies the alignment
+// requirements of all component types.
+func (b *gltfBuilder) addBufferView(data []byte, target int) int {
+	for b.buffer.Len()%4 != 0 {
+		b.buffer.WriteByte(0)
+	}
+	b.doc.BufferViews = append(b.doc.BufferViews, gltfBufferView{
+		Buffer:     0,
+		ByteOffset: b.buffer.Len(),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	b.buffer.Write(data)
+	return len(b.doc.BufferViews) - 1
+}
+
+// Adds an accessor for a new buffer view of the given float32 values.
+func (b *gltfBuilder) addFloatAccessor(values []float32, accessor_type string, components int, min, max []float64) int {
+	data := make([]byte, len(values)*4)
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(value))
+	}
+	view := b.addBufferView(data, gltfArrayBuffer)
+	b.doc.Accessors = append(b.doc.Accessors, gltfAccessor{
+		BufferView:    &view,
+		ComponentType: gltfFloat,
+		Count:         len(values) / components,
+		Type:          accessor_type,
+		Min:           min,
+		Max:           max,
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+// Adds an accessor for a new buffer view of vertex indices, using 16-bit
+// indices where vertex_count permits.
+func (b *gltfBuilder) addIndexAccessor(indices []int, vertex_count int) int {
+	var data []byte
+	component_type := gltfUnsignedInt
+	if vertex_count <= math.MaxUint16 {
+		component_type = gltfUnsignedShort
+		data = make([]byte, len(indices)*2)
+		for i, index := range indices {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(index))
+		}
+	} else {
+		data = make([]byte, len(indices)*4)
+		for i, index := range indices {
+			binary.LittleEndian.PutUint32(data[i*4:], uint32(index))
+		}
+	}
+	view := b.addBufferView(data, gltfElementArrayBuffer)
+	b.doc.Accessors = append(b.doc.Accessors, gltfAccessor{
+		BufferView:    &view,
+		ComponentType: component_type,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+// A vertex as written to glTF, where a mesh vertex is split if its faces give
+// it different texture coordinates.
+type gltfVertexKey struct {
+	vertex    VertexI
+	tex_coord [2]float64
+}
+
+// Build a glTF document describing this mesh, with one primitive per distinct
+// FaceGroup, and return it along with its binary buffer.
+func (m *Mesh) buildGLTF() (doc gltfDocument, buffer []byte, err error) {
+	if m.Faces.IsEmpty() {
+		err = errors.New("Cannot write glTF for a mesh without faces")
+		return
+	}
+
+	has_tex_coords := false
+	has_colors := false
+	m.Faces.Each(func(f FaceI) {
+		has_tex_coords = has_tex_coords || f.GetTexCoords()[0] != nil
+	})
+	m.Vertices.Each(func(v VertexI) {
+		has_colors = has_colors || v.GetColor() != nil
+	})
+
+	// Assign output vertices and collect indices per group
+	vertex_lookup := make(map[gltfVertexKey]int)
+	vertices := make([]gltfVertexKey, 0, m.Vertices.Len())
+	groups := make([]FaceGroup, 0)
+	group_indices := make(map[FaceGroup][]int)
+	m.Faces.Each(func(f FaceI) {
+		group := f.GetGroup()
+		if _, seen := group_indices[group]; !seen {
+			groups = append(groups, group)
+		}
+		tex_coords := f.GetTexCoords()
+		i := 0
+		f.EachVertex(func(v VertexI) {
+			key := gltfVertexKey{vertex: v}
+			if tex_coords[i] != nil {
+				key.tex_coord = [2]float64{tex_coords[i].X, tex_coords[i].Y}
+			}
+			index, found := vertex_lookup[key]
+			if !found {
+				index = len(vertices)
+				vertex_lookup[key] = index
+				vertices = append(vertices, key)
+			}
+			group_indices[group] = append(group_indices[group], index)
+			i++
+		})
+	})
+
+	positions := make([]float32, 0, len(vertices)*3)
+	normals := make([]float32, 0, len(vertices)*3)
+	tex_coords := make([]float32, 0, len(vertices)*2)
+	colors := make([]float32, 0, len(vertices)*4)
+	for _, key := range vertices {
+		v := key.vertex
+		positions = append(positions,
+			float32(v.GetX()), float32(v.GetY()), float32(v.GetZ()))
+
+		// missing normals are calculated without setting them on the vertex
+		var n geom.Vec3
+		if v.GetNormal() != nil {
+			n = v.GetNormal().Normalized()
+		} else {
+			average := averageFaceNormal(v)
+			n = average.Normalized()
+		}
+		if math.IsNaN(n.X) || math.IsNaN(n.Y) || math.IsNaN(n.Z) {
+			n.X, n.Y, n.Z = 0, 0, 1
+		}
+		normals = append(normals, float32(n.X), float32(n.Y), float32(n.Z))
+
+		if has_tex_coords {
+			// glTF texture coordinates have their origin at the top left
+			tex_coords = append(tex_coords,
+				float32(key.tex_coord[0]), float32(1-key.tex_coord[1]))
+		}
+		if has_colors {
+			c := v.GetColor()
+			if c == nil {
+				c = &Color{1, 1, 1, 1}
+			}
+			colors = append(colors,
+				float32(c[0]), float32(c[1]), float32(c[2]), float32(c[3]))
+		}
+	}
+
+	b := &gltfBuilder{}
+	b.doc.Asset = gltfAsset{Version: "2.0", Generator: "gomesh"}
+
+	// the bounds of the positions as written, which only include vertices
+	// used by faces
+	position_min := []float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	position_max := []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for i, value := range positions {
+		position_min[i%3] = math.Min(position_min[i%3], float64(value))
+		position_max[i%3] = math.Max(position_max[i%3], float64(value))
+	}
+	attributes := map[string]int{
+		"POSITION": b.addFloatAccessor(positions, "VEC3", 3, position_min, position_max),
+		"NORMAL":   b.addFloatAccessor(normals, "VEC3", 3, nil, nil),
+	}
+	if has_tex_coords {
+		attributes["TEXCOORD_0"] = b.addFloatAccessor(tex_coords, "VEC2", 2, nil, nil)
+	}
+	if has_colors {
+		attributes["COLOR_0"] = b.addFloatAccessor(colors, "VEC4", 4, nil, nil)
+	}
+
+	material_indices := make(map[string]int)
+	mesh := gltfMesh{Name: m.Name}
+	for _, group := range groups {
+		indices := b.addIndexAccessor(group_indices[group], len(vertices))
+		mode := gltfTriangles
+		primitive := gltfPrimitive{
+			Attributes: attributes,
+			Indices:    &indices,
+			Mode:       &mode,
+		}
+		if group.Material != "" {
+			material, found := material_indices[group.Material]
+			if !found {
+				material = len(b.doc.Materials)
+				material_indices[group.Material] = material
+				b.doc.Materials = append(b.doc.Materials,
+					m.gltfMaterial(group.Material))
+			}
+			primitive.Material = &material
+		}
+		mesh.Primitives = append(mesh.Primitives, primitive)
+	}
+
+	mesh_index := 0
+	scene_index := 0
+	b.doc.Meshes = []gltfMesh{mesh}
+	b.doc.Nodes = []gltfNode{gltfNode{Name: m.Name, Mesh: &mesh_index}}
+	b.doc.Scenes = []gltfScene{gltfScene{Nodes: []int{0}}}
+	b.doc.Scene = &scene_index
+
+	for b.buffer.Len()%4 != 0 {
+		b.buffer.WriteByte(0)
+	}
+	b.doc.Buffers = []gltfBuffer{gltfBuffer{ByteLength: b.buffer.Len()}}
+	return b.doc, b.buffer.Bytes(), nil
+}
+
+// Describes the named material from the mesh's material library as a glTF
+// PBR material.
+func (m *Mesh) gltfMaterial(name string) gltfMaterial {
+	mat := NewMaterial(name)
+	if m.Materials != nil && m.Materials.Get(name) != nil {
+		mat = m.Materials.Get(name)
+	}
+	metallic := 0.0
+	roughness := 1.0
+	result := gltfMaterial{
+		Name: name,
+		PBRMetallicRoughness: &gltfPBRMetallicRoughness{
+			BaseColorFactor: []float64{
+				mat.Diffuse[0], mat.Diffuse[1], mat.Diffuse[2], mat.Opacity,
+			},
+			MetallicFactor:  &metallic,
+			RoughnessFactor: &roughness,
+		},
+	}
+	if mat.Opacity < 1 {
+		result.AlphaMode = "BLEND"
+	}
+	return result
+}
+
+// Write this mesh as a self-contained glTF 2.0 JSON document, with its binary
+// buffer embedded as a base64 data URI.
+func (m *Mesh) WriteGLTF(gltf_writer io.Writer) (err error) {
+	doc, buffer, err := m.buildGLTF()
+	if err != nil {
+		return
+	}
+	doc.Buffers[0].URI = "data:application/octet-stream;base64," +
+		base64.StdEncoding.EncodeToString(buffer)
+	err = json.NewEncoder(gltf_writer).Encode(doc)
+	return
+}
+
+// Write this mesh as a glTF 2.0 JSON document, with its binary buffer in a
+// .bin file of the same name alongside it.
+func (m *Mesh) WriteGLTFFile(output_path string) (err error) {
+	doc, buffer, err := m.buildGLTF()
+	if err != nil {
+		return
+	}
+	bin_file := baseName(output_path) + ".bin"
+	doc.Buffers[0].URI = bin_file
+
+	err = os.WriteFile(filepath.Join(filepath.Dir(output_path), bin_file),
+		buffer, 0644)
+	if err != nil {
+		return
+	}
+
+	err = writeFile(output_path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(doc)
+	})
+	return
+}
+
+// Write this mesh as a binary glTF 2.0 (GLB) file.
+func (m *Mesh) WriteGLB(glb_writer io.Writer) (err error) {
+	doc, buffer, err := m.buildGLTF()
+	if err != nil {
+		return
+	}
+	json_chunk, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	// the JSON chunk is padded with spaces, the BIN chunk with zeros
+	for len(json_chunk)%4 != 0 {
+		json_chunk = append(json_chunk, ' ')
+	}
+
+	header := make([]byte, 20)
+	binary.LittleEndian.PutUint32(header[0:], glbMagic)
+	binary.LittleEndian.PutUint32(header[4:], 2)
+	binary.LittleEndian.PutUint32(header[8:],
+		uint32(12+8+len(json_chunk)+8+len(buffer)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(json_chunk)))
+	binary.LittleEndian.PutUint32(header[16:], glbJSONChunk)
+	bin_header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(bin_header[0:], uint32(len(buffer)))
+	binary.LittleEndian.PutUint32(bin_header[4:], glbBINChunk)
+
+	for _, chunk := range [][]byte{header, json_chunk, bin_header, buffer} {
+		if _, err = glb_writer.Write(chunk); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *Mesh) WriteGLBFile(output_path string) (err error) {
+	err = writeFile(output_path, m.WriteGLB)
+	return
+}
+
+// Component types of glTF accessors not otherwise needed for writing.
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+)
+
+var gltfComponentSizes = map[int]int{
+	gltfByte: 1, gltfUnsignedByte: 1, gltfShort: 2, gltfUnsignedShort: 2,
+	gltfUnsignedInt: 4, gltfFloat: 4,
+}
+
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16,
+}
+
+// A parsed glTF document along with the contents of its buffers.
+type gltfReader struct {
+	doc     gltfDocument
+	buffers [][]byte
+}
+
+// Read the meshes of a glTF 2.0 document, given either as JSON or as GLB.
+// Buffers must be embedded as data URIs or in the GLB binary chunk, see
+// ReadGLTFFile for documents with external buffers.
+// A mesh is returned for every node of the default scene which references a
+// mesh, with the transforms of the node and its ancestors baked into its
+// vertices. Each primitive's material is recorded as the material of its
+// faces, and primitives which aren't made of triangles are skipped.
+func LoadGLTF(gltf_reader *io.Reader) (meshes []*Mesh, err error) {
+	return loadGLTF(*gltf_reader, "")
+}
+
+// Read the meshes of a glTF 2.0 (.gltf or .glb) file, resolving external
+// buffers relative to the file.
+func ReadGLTFFile(input_path string) (meshes []*Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+	meshes, err = loadGLTF(input_file, filepath.Dir(input_path))
+	return
+}
+
+func loadGLTF(gltf_reader io.Reader, base_dir string) (meshes []*Mesh, err error) {
+	data, err := io.ReadAll(gltf_reader)
+	if err != nil {
+		return
+	}
+
+	r := &gltfReader{}
+	var bin_chunk []byte
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		data, bin_chunk, err = splitGLB(data)
+		if err != nil {
+			return
+		}
+	}
+	if err = json.Unmarshal(data, &r.doc); err != nil {
+		err = errors.New("Error parsing glTF JSON: " + err.Error())
+		return
+	}
+	if !strings.HasPrefix(r.doc.Asset.Version, "2.") {
+		err = errors.New("Unsupported glTF version: " + r.doc.Asset.Version)
+		return
+	}
+
+	for i, buffer := range r.doc.Buffers {
+		var contents []byte
+		switch {
+		case buffer.URI == "" && i == 0 && bin_chunk != nil:
+			contents = bin_chunk
+		case strings.HasPrefix(buffer.URI, "data:"):
+			comma := strings.Index(buffer.URI, ",")
+			if comma < 0 || !strings.HasSuffix(buffer.URI[:comma], ";base64") {
+				err = errors.New("Unsupported glTF data URI for buffer " +
+					strconv.Itoa(i))
+				return
+			}
+			contents, err = base64.StdEncoding.DecodeString(buffer.URI[comma+1:])
+		case buffer.URI != "" && base_dir != "":
+			var uri string
+			uri, err = url.PathUnescape(buffer.URI)
+			if err == nil {
+				contents, err = os.ReadFile(filepath.Join(base_dir, uri))
+			}
+		default:
+			err = errors.New("Cannot resolve glTF buffer " + strconv.Itoa(i))
+		}
+		if err != nil {
+			return
+		}
+		if len(contents) < buffer.ByteLength {
+			err = errors.New("glTF buffer " + strconv.Itoa(i) +
+				" is shorter than its byteLength")
+			return
+		}
+		r.buffers = append(r.buffers, contents)
+	}
+
+	// Collect the root nodes of the default scene, or of the whole document if
+	// it has no scenes, or fall back to every mesh if there are no nodes.
+	var roots []int
+	if len(r.doc.Scenes) > 0 {
+		scene := 0
+		if r.doc.Scene != nil {
+			scene = *r.doc.Scene
+		}
+		if scene < 0 || scene >= len(r.doc.Scenes) {
+			err = errors.New("glTF default scene doesn't exist")
+			return
+		}
+		roots = r.doc.Scenes[scene].Nodes
+	} else if len(r.doc.Nodes) > 0 {
+		is_child := make(map[int]bool)
+		for _, node := range r.doc.Nodes {
+			for _, child := range node.Children {
+				is_child[child] = true
+			}
+		}
+		for i := range r.doc.Nodes {
+			if !is_child[i] {
+				roots = append(roots, i)
+			}
+		}
+	} else {
+		for i := range r.doc.Meshes {
+			var m *Mesh
+			m, err = r.buildMesh(i, "", tr.Scale(1))
+			if err != nil {
+				return
+			}
+			meshes = append(meshes, m)
+		}
+		return
+	}
+
+	for _, root := range roots {
+		meshes, err = r.collectNodeMeshes(root, tr.Scale(1), meshes, 0)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Separates the JSON and BIN chunks of a GLB file.
+func splitGLB(data []byte) (json_chunk, bin_chunk []byte, err error) {
+	if binary.LittleEndian.Uint32(data[4:]) != 2 {
+		err = errors.New("Unsupported GLB version")
+		return
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		err = errors.New("GLB file is truncated")
+		return
+	}
+	offset := 12
+	for offset+8 <= length {
+		chunk_length := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunk_type := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if offset+chunk_length > length {
+			err = errors.New("GLB chunk is truncated")
+			return
+		}
+		switch chunk_type {
+		case glbJSONChunk:
+			json_chunk = data[offset : offset+chunk_length]
+		case glbBINChunk:
+			bin_chunk = data[offset : offset+chunk_length]
+		}
+		offset += chunk_length
+	}
+	if json_chunk == nil {
+		err = errors.New("GLB file has no JSON chunk")
+	}
+	return
+}
+
+// Walks the node hierarchy from the given node, building a mesh for every
+// node which references one.
+func (r *gltfReader) collectNodeMeshes(index int, parent tr.Transformation, meshes []*Mesh, depth int) ([]*Mesh, error) {
+	if index < 0 || index >= len(r.doc.Nodes) || depth > len(r.doc.Nodes) {
+		return meshes, errors.New("Invalid glTF node hierarchy")
+	}
+	node := r.doc.Nodes[index]
+	t := parent.Multiply(gltfNodeTransformation(node))
+	if node.Mesh != nil {
+		m, err := r.buildMesh(*node.Mesh, node.Name, t)
+		if err != nil {
+			return meshes, err
+		}
+		meshes = append(meshes, m)
+	}
+	for _, child := range node.Children {
+		var err error
+		meshes, err = r.collectNodeMeshes(child, t, meshes, depth+1)
+		if err != nil {
+			return meshes, err
+		}
+	}
+	return meshes, nil
+}
+
+// Calculates the local transformation of a node from either its matrix, or its
+// translation, rotation and scale.
+func gltfNodeTransformation(node gltfNode) tr.Transformation {
+	if len(node.Matrix) == 16 {
+		// glTF matrices are column major
+		t := tr.Transformation{}
+		for col := 0; col < 4; col++ {
+			for row := 0; row < 4; row++ {
+				t[row*4+col] = node.Matrix[col*4+row]
+			}
+		}
+		return t
+	}
+	t := tr.Scale(1)
+	if len(node.Translation) == 3 {
+		t = t.Multiply(tr.Translation(
+			node.Translation[0], node.Translation[1], node.Translation[2]))
+	}
+	if len(node.Rotation) == 4 {
+		x, y, z, w := node.Rotation[0], node.Rotation[1], node.Rotation[2],
+			node.Rotation[3]
+		t = t.Multiply(tr.Transformation{
+			1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w), 0,
+			2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w), 0,
+			2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y), 0,
+			0, 0, 0, 1,
+		})
+	}
+	if len(node.Scale) == 3 {
+		t = t.Multiply(tr.ScaleDimensions(node.Scale[0], node.Scale[1], node.Scale[2]))
+	}
+	return t
+}
+
+// Builds a new mesh from the triangle primitives of a glTF mesh, transformed
+// by t. Primitives with identical vertex attributes share vertices.
+func (r *gltfReader) buildMesh(index int, name string, t tr.Transformation) (m *Mesh, err error) {
+	if index < 0 || index >= len(r.doc.Meshes) {
+		err = errors.New("glTF node references undefined mesh " + strconv.Itoa(index))
+		return
+	}
+	gltf_mesh := r.doc.Meshes[index]
+	if name == "" {
+		name = gltf_mesh.Name
+	}
+	if name == "" {
+		name = "mesh_" + strconv.Itoa(index)
+	}
+	m = New(name)
+
+	shared_vertices := make(map[string][]VertexI)
+	for _, primitive := range gltf_mesh.Primitives {
+		mode := gltfTriangles
+		if primitive.Mode != nil {
+			mode = *primitive.Mode
+		}
+		if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+			continue
+		}
+
+		// create (or reuse) the vertices of the primitive
+		key := ""
+		for _, attribute := range []string{"POSITION", "NORMAL", "TEXCOORD_0", "COLOR_0"} {
+			if accessor, ok := primitive.Attributes[attribute]; ok {
+				key += attribute + strconv.Itoa(accessor) + " "
+			}
+		}
+		var (
+			vertices   []VertexI
+			tex_coords []*geom.Vec3
+		)
+		vertices, tex_coords, err = r.buildPrimitiveVertices(m, primitive,
+			shared_vertices[key])
+		if err != nil {
+			return
+		}
+		shared_vertices[key] = vertices
+
+		// assemble the indices of the primitive's triangles
+		var indices []int
+		if primitive.Indices != nil {
+			var (
+				values     []float64
+				components int
+			)
+			values, components, err = r.readAccessor(*primitive.Indices)
+			if err == nil && components != 1 {
+				err = errors.New("glTF primitive indices must be SCALAR")
+			}
+			if err != nil {
+				return
+			}
+			indices = make([]int, len(values))
+			for i, value := range values {
+				indices[i] = int(value)
+				if indices[i] < 0 || indices[i] >= len(vertices) {
+					err = errors.New("glTF primitive index out of range")
+					return
+				}
+			}
+		} else {
+			indices = make([]int, len(vertices))
+			for i := range indices {
+				indices[i] = i
+			}
+		}
+		var triangles [][3]int
+		switch mode {
+		case gltfTriangles:
+			for i := 0; i+2 < len(indices); i += 3 {
+				triangles = append(triangles,
+					[3]int{indices[i], indices[i+1], indices[i+2]})
+			}
+		case gltfTriangleStrip:
+			for i := 0; i+2 < len(indices); i++ {
+				if i%2 == 0 {
+					triangles = append(triangles,
+						[3]int{indices[i], indices[i+1], indices[i+2]})
+				} else {
+					triangles = append(triangles,
+						[3]int{indices[i+1], indices[i], indices[i+2]})
+				}
+			}
+		case gltfTriangleFan:
+			for i := 1; i+1 < len(indices); i++ {
+				triangles = append(triangles,
+					[3]int{indices[0], indices[i], indices[i+1]})
+			}
+		}
+
+		group := FaceGroup{Object: name}
+		if primitive.Material != nil {
+			group.Material = r.addMaterial(m, *primitive.Material)
+		}
+		for _, triangle := range triangles {
+			f := m.AddFace(
+				vertices[triangle[0]], vertices[triangle[1]], vertices[triangle[2]])
+			f.SetGroup(group)
+			if tex_coords != nil {
+				f.SetTexCoords([3]*geom.Vec3{
+					tex_coords[triangle[0]],
+					tex_coords[triangle[1]],
+					tex_coords[triangle[2]],
+				})
+			}
+		}
+	}
+
+	if t != tr.Scale(1) {
+		m.Transform(t)
+		m.Vertices.Each(func(v VertexI) {
+			if n := v.GetNormal(); n != nil {
+				transformGLTFNormal(t, n)
+			}
+		})
+	}
+	return
+}
+
+// Creates the vertices for a primitive from its attributes.
+// Texture coordinates are returned separately, with their V axis flipped
+// back, as they belong to the corners of faces.
+func (r *gltfReader) buildPrimitiveVertices(m *Mesh, primitive gltfPrimitive, existing []VertexI) (vertices []VertexI, tex_coords []*geom.Vec3, err error) {
+	position_accessor, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		err = errors.New("glTF primitive has no POSITION attribute")
+		return
+	}
+	positions, position_components, err := r.readAccessor(position_accessor)
+	if err != nil {
+		return
+	}
+	if position_components != 3 {
+		err = errors.New("glTF POSITION attribute must be VEC3")
+		return
+	}
+	count := len(positions) / 3
+	// Reads the values of an attribute, along with its number of components
+	attribute := func(name string, components ...int) (values []float64, c int, err error) {
+		accessor, ok := primitive.Attributes[name]
+		if !ok {
+			return
+		}
+		values, c, err = r.readAccessor(accessor)
+		if err == nil && len(values) != count*c {
+			err = errors.New("glTF attribute " + name + " has the wrong count")
+		}
+		if err == nil {
+			valid := false
+			for _, expected := range components {
+				valid = valid || c == expected
+			}
+			if !valid {
+				err = errors.New("glTF attribute " + name + " has the wrong type")
+			}
+		}
+		return
+	}
+	normals, _, err := attribute("NORMAL", 3)
+	if err != nil {
+		return
+	}
+	uvs, _, err := attribute("TEXCOORD_0", 2)
+	if err != nil {
+		return
+	}
+	colors, color_components, err := attribute("COLOR_0", 3, 4)
+	if err != nil {
+		return
+	}
+
+	if existing != nil {
+		vertices = existing
+	} else {
+		vertices = make([]VertexI, count)
+		for i := range vertices {
+			p := positions[i*3:]
+			vertices[i] = m.AddVertex(p[0], p[1], p[2])
+			if normals != nil {
+				n := normals[i*3:]
+				vertices[i].SetNormal(&geom.Vec3{n[0], n[1], n[2]})
+			}
+			if colors != nil {
+				c := Color{1, 1, 1, 1}
+				copy(c[:], colors[i*color_components:(i+1)*color_components])
+				vertices[i].SetColor(&c)
+			}
+		}
+	}
+	if uvs != nil {
+		tex_coords = make([]*geom.Vec3, count)
+		for i := range tex_coords {
+			tex_coords[i] = &geom.Vec3{uvs[i*2], 1 - uvs[i*2+1], 0}
+		}
+	}
+	return
+}
+
+// Records the glTF material with the given index in the mesh's material
+// library, and returns its name.
+func (r *gltfReader) addMaterial(m *Mesh, index int) string {
+	name := "material_" + strconv.Itoa(index)
+	if index < 0 || index >= len(r.doc.Materials) {
+		return name
+	}
+	gltf_material := r.doc.Materials[index]
+	if gltf_material.Name != "" {
+		name = gltf_material.Name
+	}
+	if m.Materials.Get(name) == nil {
+		mat := NewMaterial(name)
+		pbr := gltf_material.PBRMetallicRoughness
+		if pbr != nil && len(pbr.BaseColorFactor) == 4 {
+			copy(mat.Diffuse[:], pbr.BaseColorFactor[:3])
+			mat.Opacity = pbr.BaseColorFactor[3]
+		}
+		m.Materials.Add(mat)
+	}
+	return name
+}
+
+// Reads the elements of an accessor as floats, normalizing integer components
+// where the accessor specifies it. The components of every element are
+// returned in a single slice, along with the number of components of each.
+// Counts, offsets and strides are checked against the buffer view before
+// anything is allocated for the values.
+func (r *gltfReader) readAccessor(index int) (values []float64, components int, err error) {
+	if index < 0 || index >= len(r.doc.Accessors) {
+		err = errors.New("glTF accessor " + strconv.Itoa(index) + " doesn't exist")
+		return
+	}
+	accessor := r.doc.Accessors[index]
+	if accessor.Sparse != nil {
+		err = errors.New("Sparse glTF accessors are not supported")
+		return
+	}
+	components, known_type := gltfTypeComponents[accessor.Type]
+	size, known_component := gltfComponentSizes[accessor.ComponentType]
+	if !known_type || !known_component {
+		err = errors.New("Unsupported type for glTF accessor " + strconv.Itoa(index))
+		return
+	}
+
+	total, valid := readValueCount(accessor.Count, components)
+	if !valid || accessor.ByteOffset < 0 {
+		err = errors.New("Invalid count or offset for glTF accessor " + strconv.Itoa(index))
+		return
+	}
+	if accessor.BufferView == nil {
+		// accessors without a buffer view are all zeros
+		values = make([]float64, total)
+		return
+	}
+	if *accessor.BufferView < 0 || *accessor.BufferView >= len(r.doc.BufferViews) {
+		err = errors.New("glTF buffer view doesn't exist")
+		return
+	}
+	view := r.doc.BufferViews[*accessor.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(r.buffers) {
+		err = errors.New("glTF buffer doesn't exist")
+		return
+	}
+	data := r.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 ||
+		view.ByteLength > len(data) || view.ByteOffset > len(data)-view.ByteLength {
+		err = errors.New("glTF buffer view exceeds its buffer")
+		return
+	}
+	element_size := size * components
+	stride := element_size
+	if view.ByteStride != nil && *view.ByteStride > 0 {
+		// the specification limits strides to 252 bytes
+		if *view.ByteStride < element_size || *view.ByteStride > 252 {
+			err = errors.New("Invalid byte stride for glTF accessor " + strconv.Itoa(index))
+			return
+		}
+		stride = *view.ByteStride
+	}
+	// the count is limited by maxReadValues, so this can't overflow
+	if accessor.Count > 0 && (accessor.ByteOffset > view.ByteLength ||
+		stride*(accessor.Count-1)+element_size > view.ByteLength-accessor.ByteOffset) {
+		err = errors.New("glTF accessor " + strconv.Itoa(index) +
+			" exceeds its buffer view")
+		return
+	}
+	start := view.ByteOffset + accessor.ByteOffset
+	values = make([]float64, total)
+	for i := 0; i < accessor.Count; i++ {
+		for j := 0; j < components; j++ {
+			b := data[start+i*stride+j*size:]
+			var value float64
+			switch accessor.ComponentType {
+			case gltfByte:
+				value = float64(int8(b[0]))
+				if accessor.Normalized {
+					value = math.Max(value/127, -1)
+				}
+			case gltfUnsignedByte:
+				value = float64(b[0])
+				if accessor.Normalized {
+					value /= 255
+				}
+			case gltfShort:
+				value = float64(int16(binary.LittleEndian.Uint16(b)))
+				if accessor.Normalized {
+					value = math.Max(value/32767, -1)
+				}
+			case gltfUnsignedShort:
+				value = float64(binary.LittleEndian.Uint16(b))
+				if accessor.Normalized {
+					value /= 65535
+				}
+			case gltfUnsignedInt:
+				value = float64(binary.LittleEndian.Uint32(b))
+			case gltfFloat:
+				value = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}
+			values[i*components+j] = value
+		}
+	}
+	return
+}
+
+// Transforms a normal by the inverse transpose of the linear part of t, which
+// is proportional to its cofactor matrix, and renormalizes it.
+func transformGLTFNormal(t tr.Transformation, n *geom.Vec3) {
+	cofactors := [9]float64{
+		t[5]*t[10] - t[6]*t[9], t[6]*t[8] - t[4]*t[10], t[4]*t[9] - t[5]*t[8],
+		t[2]*t[9] - t[1]*t[10], t[0]*t[10] - t[2]*t[8], t[1]*t[8] - t[0]*t[9],
+		t[1]*t[6] - t[2]*t[5], t[2]*t[4] - t[0]*t[6], t[0]*t[5] - t[1]*t[4],
+	}
+	det := t[0]*cofactors[0] + t[1]*cofactors[1] + t[2]*cofactors[2]
+	x := cofactors[0]*n.X + cofactors[1]*n.Y + cofactors[2]*n.Z
+	y := cofactors[3]*n.X + cofactors[4]*n.Y + cofactors[5]*n.Z
+	z := cofactors[6]*n.X + cofactors[7]*n.Y + cofactors[8]*n.Z
+	if det < 0 {
+		x, y, z = -x, -y, -z
+	}
+	l := math.Sqrt(x*x + y*y + z*z)
+	if l > 0 {
+		n.X, n.Y, n.Z = x/l, y/l, z/l
+	}
+}
@@ -0,0 +1,164 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	cb "github.com/nat-n/gomesh/cuboid"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Tests for WriteGLB
+
+func TestWriteGLB(t *testing.T) {
+	m := NewFromCuboid(*cb.New(-1, -2, -3, 1, 2, 3))
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		f.SetGroup(FaceGroup{Material: []string{"A", "B"}[i%2]})
+	})
+	// vertices without faces aren't written, or counted in the bounds
+	m.AddVertex(10, 10, 10)
+	m.Vertices.Each(func(v VertexI) { v.SetNormal(nil) })
+
+	buf := new(bytes.Buffer)
+	if err := m.WriteGLB(buf); err != nil {
+		t.Fatal("Expected no error writing GLB, got", err)
+	}
+	m.Vertices.Each(func(v VertexI) {
+		if v.GetNormal() != nil {
+			t.Error("Expected writing not to calculate vertex normals, got", v.GetNormal())
+		}
+	})
+	data := buf.Bytes()
+	if binary.LittleEndian.Uint32(data[0:]) != glbMagic ||
+		int(binary.LittleEndian.Uint32(data[8:])) != len(data) {
+		t.Fatal("Expected valid GLB header")
+	}
+	json_length := binary.LittleEndian.Uint32(data[12:])
+	doc := gltfDocument{}
+	if err := json.Unmarshal(data[20:20+json_length], &doc); err != nil {
+		t.Fatal("Expected valid GLB JSON chunk, got", err)
+	}
+
+	if len(doc.Meshes) != 1 || len(doc.Meshes[0].Primitives) != 2 {
+		t.Fatal("Expected one mesh with a primitive per face group, got",
+			doc.Meshes)
+	}
+	if len(doc.Materials) != 2 {
+		t.Error("Expected two materials, got", len(doc.Materials))
+	}
+	position := doc.Accessors[doc.Meshes[0].Primitives[0].Attributes["POSITION"]]
+	if position.Count != 8 ||
+		position.Min[0] != -1 || position.Min[1] != -2 || position.Min[2] != -3 ||
+		position.Max[0] != 1 || position.Max[1] != 2 || position.Max[2] != 3 {
+		t.Error("Expected 8 positions bounded by the cuboid, got", position)
+	}
+	for _, primitive := range doc.Meshes[0].Primitives {
+		indices := doc.Accessors[*primitive.Indices]
+		if indices.Count != 18 || indices.ComponentType != gltfUnsignedShort {
+			t.Error("Expected 18 unsigned short indices per primitive, got",
+				indices.Count, indices.ComponentType)
+		}
+	}
+}
+
+// Tests for LoadGLTF
+
+func TestGLTFRoundTrip(t *testing.T) {
+	m := NewFromCuboid(*cb.New(-1, -2, -3, 1, 2, 3))
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		f.SetGroup(FaceGroup{Material: []string{"A", "B"}[i%2]})
+	})
+
+	for _, binary := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		var err error
+		if binary {
+			err = m.WriteGLB(buf)
+		} else {
+			err = m.WriteGLTF(buf)
+		}
+		if err != nil {
+			t.Fatal("Expected no error writing glTF, got", err)
+		}
+		r := io.Reader(buf)
+		meshes, err := LoadGLTF(&r)
+		if err != nil {
+			t.Fatal("For binary", binary, "expected no error reading glTF, got", err)
+		}
+		if len(meshes) != 1 || meshes[0].Vertices.Len() != 8 ||
+			meshes[0].Faces.Len() != 12 {
+			t.Fatal("For binary", binary,
+				"expected one mesh with 8 vertices and 12 faces")
+		}
+		bb := meshes[0].BoundingBox()
+		if bb.OriginX != -1 || bb.OriginY != -2 || bb.OriginZ != -3 ||
+			bb.TerminusX != 1 || bb.TerminusY != 2 || bb.TerminusZ != 3 {
+			t.Error("For binary", binary, "expected bounds to survive, got", bb)
+		}
+		if meshes[0].Materials.Get("A") == nil || meshes[0].Materials.Get("B") == nil {
+			t.Error("For binary", binary, "expected materials A and B")
+		}
+	}
+}
+
+var multiMeshGLTF = `{
+  "asset": {"version": "2.0"},
+  "scene": 0,
+  "scenes": [{"nodes": [0]}],
+  "nodes": [
+    {"name": "parent", "translation": [10, 0, 0], "children": [1, 2]},
+    {"name": "first", "mesh": 0},
+    {"name": "second", "mesh": 0, "scale": [2, 2, 2]}
+  ],
+  "meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}],
+  "accessors": [
+    {"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}
+  ],
+  "bufferViews": [{"buffer": 0, "byteLength": 36}],
+  "buffers": [{"byteLength": 36,
+    "uri": "data:application/octet-stream;base64,AAAAAAAAAAAAAAAAAACAPwAAAAAAAAAAAAAAAAAAgD8AAAAA"}]
+}`
+
+func TestLoadGLTFNodes(t *testing.T) {
+	r := io.Reader(strings.NewReader(multiMeshGLTF))
+	meshes, err := LoadGLTF(&r)
+	if err != nil {
+		t.Fatal("Expected no error reading glTF, got", err)
+	}
+	if len(meshes) != 2 || meshes[0].Name != "first" || meshes[1].Name != "second" {
+		t.Fatal("Expected meshes first and second, got", meshes)
+	}
+	expected := []float64{11, 12}
+	for i, m := range meshes {
+		if m.Faces.Len() != 1 {
+			t.Error("For mesh", m.Name, "expected 1 face, got", m.Faces.Len())
+		}
+		if x := m.Vertices.Get(1)[0].GetX(); x != expected[i] {
+			t.Error("For mesh", m.Name, "expected transformed x", expected[i],
+				"got", x)
+		}
+	}
+}
+
+func TestLoadGLTFBadAccessors(t *testing.T) {
+	accessor := `{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}`
+	view := `{"buffer": 0, "byteLength": 36}`
+	for _, replacement := range [][2]string{
+		{accessor, `{"bufferView": 0, "componentType": 5126, "count": -1, "type": "VEC3"}`},
+		{accessor, `{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"}`},
+		{accessor, `{"bufferView": 0, "componentType": 5126, "count": 1000000000000, "type": "VEC3"}`},
+		{accessor, `{"componentType": 5126, "count": 1000000000000, "type": "VEC3"}`},
+		{accessor, `{"bufferView": 0, "byteOffset": -12, "componentType": 5126, "count": 3, "type": "VEC3"}`},
+		{view, `{"buffer": 0, "byteLength": 36, "byteStride": 4611686018427387904}`},
+		{view, `{"buffer": 0, "byteOffset": -4, "byteLength": 36}`},
+		{view, `{"buffer": 0, "byteLength": 40}`},
+	} {
+		r := io.Reader(strings.NewReader(
+			strings.Replace(multiMeshGLTF, replacement[0], replacement[1], 1)))
+		if _, err := LoadGLTF(&r); err == nil {
+			t.Error("For", replacement[1], "expected an error")
+		}
+	}
+}
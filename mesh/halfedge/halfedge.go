@@ -0,0 +1,294 @@
+/*
+Package halfedge provides a half-edge representation of triangle meshes for
+constant time topological queries.
+
+As every face of a mesh.Mesh is a triangle, half-edges are stored implicitly
+by face (the directed-edge structure): the half-edges of face f are 3f, 3f+1
+and 3f+2, running from each of its corners A, B and C to the next, so next and
+previous half-edges are computed rather than stored. Vertices and faces are
+referred to by their index in the mesh the structure was built from, and
+absent half-edges are None.
+*/
+package halfedge
+
+import (
+	"errors"
+	"github.com/nat-n/gomesh/mesh"
+	"sort"
+	"strconv"
+)
+
+// The index of a half-edge which doesn't exist, such as the twin of a
+// half-edge on a boundary.
+const None = -1
+
+type Mesh struct {
+	// The vertices and faces the structure was built from.
+	Vertices []mesh.VertexI
+	Faces    []mesh.FaceI
+	// The vertex each half-edge starts from.
+	origins []int
+	// The opposite half-edge of each half-edge, or None if it's on a boundary
+	// or a non-manifold edge.
+	twins []int
+	// A half-edge starting from each vertex, or None for unused vertices.
+	// Boundary vertices start from their outgoing boundary half-edge so that
+	// circulating from it visits the vertex's whole fan.
+	outgoing []int
+
+	non_manifold_edges    [][2]int
+	non_manifold_vertices []int
+}
+
+// Builds the half-edge structure of a mesh. Edges shared by more than two
+// faces, or by two faces with inconsistent winding, are non-manifold and have
+// no twins, as if they were boundaries.
+func New(m *mesh.Mesh) (hm *Mesh, err error) {
+	hm = &Mesh{
+		Vertices: m.Vertices.GetAll(),
+		Faces:    m.Faces.GetAll(),
+	}
+	vert_lookup := make(map[mesh.VertexI]int, len(hm.Vertices))
+	for i, v := range hm.Vertices {
+		vert_lookup[v] = i
+	}
+
+	hm.origins = make([]int, len(hm.Faces)*3)
+	for f, face := range hm.Faces {
+		for i, v := range [3]mesh.VertexI{face.GetA(), face.GetB(), face.GetC()} {
+			index, found := vert_lookup[v]
+			if !found {
+				return nil, errors.New("Face " + strconv.Itoa(f) +
+					" references a vertex which isn't in the mesh")
+			}
+			hm.origins[f*3+i] = index
+		}
+	}
+
+	// pair up the half-edges of each undirected edge
+	edges := make(map[[2]int][]int)
+	for h := range hm.origins {
+		a, b := hm.Origin(h), hm.Target(h)
+		if a > b {
+			a, b = b, a
+		}
+		edges[[2]int{a, b}] = append(edges[[2]int{a, b}], h)
+	}
+	hm.twins = make([]int, len(hm.origins))
+	for h := range hm.twins {
+		hm.twins[h] = None
+	}
+	for edge, half_edges := range edges {
+		if len(half_edges) == 1 {
+			continue
+		}
+		h1, h2 := half_edges[0], half_edges[len(half_edges)-1]
+		if len(half_edges) > 2 || hm.Origin(h1) != hm.Target(h2) {
+			hm.non_manifold_edges = append(hm.non_manifold_edges, edge)
+			continue
+		}
+		hm.twins[h1] = h2
+		hm.twins[h2] = h1
+	}
+	sort.Sort(edgesByVertices(hm.non_manifold_edges))
+
+	// choose an outgoing half-edge for each vertex, preferring boundaries
+	hm.outgoing = make([]int, len(hm.Vertices))
+	outgoing_counts := make([]int, len(hm.Vertices))
+	for v := range hm.outgoing {
+		hm.outgoing[v] = None
+	}
+	for h, v := range hm.origins {
+		outgoing_counts[v]++
+		if hm.outgoing[v] == None || hm.twins[h] == None {
+			hm.outgoing[v] = h
+		}
+	}
+
+	// vertices whose faces don't form a single fan are non-manifold
+	for v, count := range outgoing_counts {
+		fan_size := 0
+		hm.EachOutgoing(v, func(h int) { fan_size++ })
+		if fan_size != count {
+			hm.non_manifold_vertices = append(hm.non_manifold_vertices, v)
+		}
+	}
+	return
+}
+
+type edgesByVertices [][2]int
+
+func (es edgesByVertices) Len() int      { return len(es) }
+func (es edgesByVertices) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es edgesByVertices) Less(i, j int) bool {
+	return es[i][0] < es[j][0] || (es[i][0] == es[j][0] && es[i][1] < es[j][1])
+}
+
+func (hm *Mesh) HalfEdgeCount() int { return len(hm.origins) }
+
+// The first half-edge of face f, running from its A to its B corner.
+func (hm *Mesh) FaceHalfEdge(f int) int { return f * 3 }
+
+func (hm *Mesh) Next(h int) int { return h - h%3 + (h+1)%3 }
+
+func (hm *Mesh) Prev(h int) int { return h - h%3 + (h+2)%3 }
+
+func (hm *Mesh) Twin(h int) int { return hm.twins[h] }
+
+func (hm *Mesh) Face(h int) int { return h / 3 }
+
+// The vertex half-edge h starts from.
+func (hm *Mesh) Origin(h int) int { return hm.origins[h] }
+
+// The vertex half-edge h points to.
+func (hm *Mesh) Target(h int) int { return hm.origins[hm.Next(h)] }
+
+// A half-edge starting from vertex v, or None if no face uses it. For boundary
+// vertices this is the outgoing half-edge on the boundary.
+func (hm *Mesh) Outgoing(v int) int { return hm.outgoing[v] }
+
+// Whether half-edge h has no twin, as on a boundary or non-manifold edge.
+func (hm *Mesh) IsBoundary(h int) bool { return hm.twins[h] == None }
+
+// Whether vertex v is on a boundary or non-manifold edge.
+func (hm *Mesh) IsBoundaryVertex(v int) bool {
+	h := hm.outgoing[v]
+	return h != None && hm.twins[h] == None
+}
+
+// Calls cb with each half-edge starting from vertex v, turning through its fan
+// of faces from the boundary if there is one. For a non-manifold vertex only
+// one of its fans is visited.
+func (hm *Mesh) EachOutgoing(v int, cb func(h int)) {
+	start := hm.outgoing[v]
+	if start == None {
+		return
+	}
+	h := start
+	for {
+		cb(h)
+		h = hm.twins[hm.Prev(h)]
+		if h == None || h == start {
+			return
+		}
+	}
+}
+
+// Calls cb with each vertex joined to vertex v by an edge (its one-ring), in
+// order around it.
+func (hm *Mesh) EachNeighbor(v int, cb func(u int)) {
+	last := None
+	hm.EachOutgoing(v, func(h int) {
+		cb(hm.Target(h))
+		last = h
+	})
+	// the fan of a boundary vertex ends with an incoming boundary half-edge
+	if last != None && hm.twins[hm.Prev(last)] == None {
+		cb(hm.Origin(hm.Prev(last)))
+	}
+}
+
+// Calls cb with each face using vertex v, in order around it.
+func (hm *Mesh) EachFaceAround(v int, cb func(f int)) {
+	hm.EachOutgoing(v, func(h int) { cb(hm.Face(h)) })
+}
+
+// Calls cb with the three half-edges of face f.
+func (hm *Mesh) EachFaceHalfEdge(f int, cb func(h int)) {
+	cb(f * 3)
+	cb(f*3 + 1)
+	cb(f*3 + 2)
+}
+
+// Calls cb with each face sharing an edge with face f.
+func (hm *Mesh) EachAdjacentFace(f int, cb func(g int)) {
+	hm.EachFaceHalfEdge(f, func(h int) {
+		if twin := hm.twins[h]; twin != None {
+			cb(hm.Face(twin))
+		}
+	})
+}
+
+// Calls cb with one half-edge of each edge: the half-edge with the lower index
+// for edges with twins, or the only half-edge on boundaries. Each half-edge of
+// a non-manifold edge is visited.
+func (hm *Mesh) EachEdge(cb func(h int)) {
+	for h, twin := range hm.twins {
+		if twin == None || h < twin {
+			cb(h)
+		}
+	}
+}
+
+// Returns each boundary as a loop of vertex indices, following the winding of
+// the faces along it, with the first vertex repeated at the end like
+// Mesh.IdentifyBoundaries. Boundaries are ordered by their lowest half-edge.
+// Non-manifold edges aren't treated as boundaries.
+func (hm *Mesh) Boundaries() (boundaries [][]int) {
+	visited := make([]bool, len(hm.origins))
+	non_manifold := make(map[[2]int]bool, len(hm.non_manifold_edges))
+	for _, edge := range hm.non_manifold_edges {
+		non_manifold[edge] = true
+	}
+	isBoundary := func(h int) bool {
+		a, b := hm.Origin(h), hm.Target(h)
+		if a > b {
+			a, b = b, a
+		}
+		return hm.twins[h] == None && !non_manifold[[2]int{a, b}]
+	}
+
+	for start := range hm.origins {
+		if visited[start] || !isBoundary(start) {
+			continue
+		}
+		loop := []int{hm.Origin(start)}
+		for h := start; !visited[h]; {
+			visited[h] = true
+			loop = append(loop, hm.Target(h))
+			// turn around the target to find the boundary half-edge leaving it
+			g := hm.Next(h)
+			for turns := 0; hm.twins[g] != None && turns < len(hm.origins); turns++ {
+				g = hm.Next(hm.twins[g])
+			}
+			if !isBoundary(g) {
+				break
+			}
+			h = g
+		}
+		boundaries = append(boundaries, loop)
+	}
+	return
+}
+
+// Returns the edges shared by more than two faces, or by faces with
+// inconsistent winding, as pairs of vertex indices (the lower first).
+func (hm *Mesh) NonManifoldEdges() [][2]int {
+	return hm.non_manifold_edges
+}
+
+// Returns the vertices whose faces don't form a single fan, such as the apex
+// shared by two cones, in ascending order.
+func (hm *Mesh) NonManifoldVertices() []int {
+	return hm.non_manifold_vertices
+}
+
+func (hm *Mesh) IsManifold() bool {
+	return len(hm.non_manifold_edges) == 0 && len(hm.non_manifold_vertices) == 0
+}
+
+// Converts the structure back to a new mesh with copies of the vertices
+// (including their normals and colors) and faces (including their normals,
+// groups and tex coords) it was built from, which share nothing with them.
+func (hm *Mesh) ToMesh(name string) *mesh.Mesh {
+	m := mesh.New(name)
+	vertices := make([]mesh.VertexI, len(hm.Vertices))
+	for i, v := range hm.Vertices {
+		vertices[i] = m.AddVertexCopy(v)
+	}
+	for f, face := range hm.Faces {
+		m.AddFaceCopy(face, vertices[hm.origins[f*3]], vertices[hm.origins[f*3+1]],
+			vertices[hm.origins[f*3+2]])
+	}
+	return m
+}
@@ -0,0 +1,203 @@
+package halfedge
+
+import (
+	"github.com/nat-n/geom"
+	"github.com/nat-n/gomesh/mesh"
+	"testing"
+)
+
+// Returns a size by size grid of vertices in the XY plane, with each square
+// split into two triangles along its diagonal from the origin.
+func testGrid(size int) *mesh.Mesh {
+	m := mesh.New("grid")
+	verts := make([]mesh.VertexI, size*size)
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			verts[j*size+i] = m.AddVertex(float64(i), float64(j), 0)
+		}
+	}
+	for j := 0; j+1 < size; j++ {
+		for i := 0; i+1 < size; i++ {
+			a, b := verts[j*size+i], verts[j*size+i+1]
+			c, d := verts[(j+1)*size+i], verts[(j+1)*size+i+1]
+			m.AddFace(a, b, d)
+			m.AddFace(a, d, c)
+		}
+	}
+	return m
+}
+
+// Returns a mesh of the given triangles of vertex indices.
+func testTriangles(vertex_count int, triangles ...[3]int) *mesh.Mesh {
+	m := mesh.New("triangles")
+	verts := make([]mesh.VertexI, vertex_count)
+	for i := range verts {
+		verts[i] = m.AddVertex(float64(i), float64(i*i), 0)
+	}
+	for _, t := range triangles {
+		m.AddFace(verts[t[0]], verts[t[1]], verts[t[2]])
+	}
+	return m
+}
+
+func checkInvariants(t *testing.T, name string, hm *Mesh) {
+	for h := 0; h < hm.HalfEdgeCount(); h++ {
+		if hm.Next(hm.Next(hm.Next(h))) != h || hm.Prev(hm.Next(h)) != h {
+			t.Error("For", name, "expected half-edge", h, "to be in a cycle of three")
+		}
+		if twin := hm.Twin(h); twin != None {
+			if hm.Twin(twin) != h || hm.Origin(twin) != hm.Target(h) ||
+				hm.Target(twin) != hm.Origin(h) {
+				t.Error("For", name, "expected half-edge", h, "to match its twin", twin)
+			}
+		}
+	}
+}
+
+// Tests for New
+
+func TestClosedMesh(t *testing.T) {
+	// an octahedron around the origin, with corners along each axis
+	hm, err := New(testTriangles(6,
+		[3]int{0, 2, 4}, [3]int{2, 1, 4}, [3]int{1, 3, 4}, [3]int{3, 0, 4},
+		[3]int{2, 0, 5}, [3]int{1, 2, 5}, [3]int{3, 1, 5}, [3]int{0, 3, 5}))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	checkInvariants(t, "octahedron", hm)
+	if !hm.IsManifold() || len(hm.Boundaries()) != 0 {
+		t.Error("Expected a closed manifold, got non-manifold edges",
+			hm.NonManifoldEdges(), "and boundaries", hm.Boundaries())
+	}
+	edges := 0
+	hm.EachEdge(func(h int) {
+		edges++
+		if hm.IsBoundary(h) {
+			t.Error("Expected no boundary half-edges, got", h)
+		}
+	})
+	if edges != 12 {
+		t.Error("Expected 12 edges, got", edges)
+	}
+	neighbors := 0
+	for v := range hm.Vertices {
+		if hm.IsBoundaryVertex(v) {
+			t.Error("Expected no boundary vertices, got", v)
+		}
+		hm.EachNeighbor(v, func(u int) { neighbors++ })
+	}
+	if neighbors != 2*edges {
+		t.Error("Expected each edge to be in two one-rings, got", neighbors)
+	}
+	adjacent := 0
+	hm.EachAdjacentFace(0, func(g int) { adjacent++ })
+	if adjacent != 3 {
+		t.Error("Expected 3 adjacent faces, got", adjacent)
+	}
+}
+
+func TestOpenMesh(t *testing.T) {
+	hm, err := New(testGrid(3))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	checkInvariants(t, "grid", hm)
+	if !hm.IsManifold() {
+		t.Error("Expected a manifold, got non-manifold vertices",
+			hm.NonManifoldVertices())
+	}
+
+	type vertexTest struct{ v, neighbors, faces int }
+	for _, params := range []vertexTest{{4, 6, 6}, {0, 3, 2}, {2, 2, 1}, {1, 4, 3}} {
+		neighbors, faces := []int{}, 0
+		hm.EachNeighbor(params.v, func(u int) { neighbors = append(neighbors, u) })
+		hm.EachFaceAround(params.v, func(f int) { faces++ })
+		if len(neighbors) != params.neighbors || faces != params.faces {
+			t.Error("For vertex", params.v, "expected", params.neighbors, "neighbors and",
+				params.faces, "faces, got", neighbors, faces)
+		}
+		if hm.IsBoundaryVertex(params.v) != (params.v != 4) {
+			t.Error("For vertex", params.v, "expected boundary", params.v != 4)
+		}
+	}
+
+	boundaries := hm.Boundaries()
+	expected := []int{0, 1, 2, 5, 8, 7, 6, 3, 0}
+	if len(boundaries) != 1 || len(boundaries[0]) != len(expected) {
+		t.Fatal("Expected one boundary", expected, "got", boundaries)
+	}
+	for i, v := range expected {
+		if boundaries[0][i] != v {
+			t.Error("Expected boundary", expected, "got", boundaries[0])
+			break
+		}
+	}
+}
+
+func TestNonManifold(t *testing.T) {
+	// three faces sharing an edge
+	hm, _ := New(testTriangles(5, [3]int{0, 1, 2}, [3]int{1, 0, 3}, [3]int{0, 1, 4}))
+	checkInvariants(t, "fin", hm)
+	edges := hm.NonManifoldEdges()
+	if len(edges) != 1 || edges[0] != [2]int{0, 1} || hm.IsManifold() {
+		t.Error("Expected non-manifold edge [0 1], got", edges)
+	}
+
+	// two faces sharing only a vertex
+	hm, _ = New(testTriangles(5, [3]int{0, 1, 2}, [3]int{0, 3, 4}))
+	vertices := hm.NonManifoldVertices()
+	if len(vertices) != 1 || vertices[0] != 0 || len(hm.NonManifoldEdges()) != 0 {
+		t.Error("Expected non-manifold vertex 0, got", vertices)
+	}
+	if len(hm.Boundaries()) != 2 {
+		t.Error("Expected two boundaries, got", hm.Boundaries())
+	}
+
+	// a face referencing a vertex from elsewhere
+	m := testTriangles(3, [3]int{0, 1, 2})
+	other := testTriangles(3)
+	m.Faces.Get(0)[0].SetA(other.Vertices.Get(0)[0])
+	if _, err := New(m); err == nil {
+		t.Error("Expected an error for a vertex which isn't in the mesh")
+	}
+}
+
+// Tests for ToMesh
+
+func TestToMesh(t *testing.T) {
+	original := testGrid(4)
+	original.Vertices.Each(func(v mesh.VertexI) {
+		v.SetNormal(&geom.Vec3{0, 0, 1})
+		v.SetColor(&mesh.Color{1, 0, 0, 1})
+	})
+	original.Faces.Each(func(f mesh.FaceI) {
+		f.SetNormal(&geom.Vec3{0, 0, 1})
+		f.SetTexCoords([3]*geom.Vec3{&geom.Vec3{0, 0, 0}, &geom.Vec3{1, 0, 0},
+			&geom.Vec3{1, 1, 0}})
+	})
+	hm, _ := New(original)
+	m := hm.ToMesh("copy")
+	if m.Name != "copy" || m.Vertices.Len() != original.Vertices.Len() ||
+		m.Faces.Len() != original.Faces.Len() {
+		t.Fatal("Expected copy with the same vertex and face counts")
+	}
+	original.Faces.EachWithIndex(func(i int, f mesh.FaceI) {
+		g := m.Faces.Get(i)[0]
+		if f.GetA().Clone() != g.GetA().Clone() || f.GetB().Clone() != g.GetB().Clone() ||
+			f.GetC().Clone() != g.GetC().Clone() || f.GetA() == g.GetA() {
+			t.Error("Expected face", i, "to be copied")
+		}
+		if g.GetNormal() == f.GetNormal() || *g.GetNormal() != *f.GetNormal() ||
+			g.GetTexCoords()[2] == f.GetTexCoords()[2] ||
+			*g.GetTexCoords()[2] != *f.GetTexCoords()[2] {
+			t.Error("Expected normal and tex coords of face", i, "to be copied")
+		}
+	})
+	original.Vertices.EachWithIndex(func(i int, v mesh.VertexI) {
+		w := m.Vertices.Get(i)[0]
+		if w.GetNormal() == v.GetNormal() || *w.GetNormal() != *v.GetNormal() ||
+			w.GetColor() == v.GetColor() || *w.GetColor() != *v.GetColor() {
+			t.Error("Expected normal and color of vertex", i, "to be copied")
+		}
+	})
+}
@@ -1,180 +1,272 @@
 package mesh
 
 import (
-	"bufio"
 	"errors"
 	"github.com/nat-n/geom"
 	"io"
 	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 )
 
-// Populate this Mesh from the given OBJ file
-func LoadOBJ(obj_reader *io.Reader) (m *Mesh, err error) {
+// Populate this Mesh from the given OBJ file.
+// Faces may reference texture coordinates and normals using the v/vt/vn
+// syntax, and may use negative (relative) indices. Faces with more than three
+// corners are triangulated as a fan around their first corner.
+// The object, group and material in effect when each face is declared are
+// recorded on the face, and the names of referenced MTL files are recorded in
+// the mesh's material library. The library only holds materials which have
+// been read from those files, see ReadOBJFile.
+// Statements which are valid OBJ but not represented in a Mesh are skipped.
+// Malformed statements produce a *ParseError, unless options are given for
+// lenient parsing in which case they're skipped and the rest of the file read.
+// To process files too large to load, see ReadOBJStream and ProcessOBJ.
+func LoadOBJ(obj_reader *io.Reader, opts ...ParseOptions) (m *Mesh, err error) {
+	options := ParseOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
 	// prepare for data
 	m = New("")
 
-	// setup for parsing
-	var (
-		line  string
-		words []string
-	)
-	line_no := -1
-
+	// elements skipped by a lenient read are left nil
+	verticesBuffer := make([]VertexI, 0)
 	normalsBuffer := make([]*geom.Vec3, 0)
-	facesBuffer := make([][3]int, 0)
-
-	// open and parse file
-	scanner := bufio.NewScanner(*obj_reader)
-	for scanner.Scan() {
-		line_no++
-		// trim leading and trailing whitespace
-		line = strings.TrimSpace(scanner.Text())
-		// firstly discard anything on this line after a #
-		if comment_start := strings.Index(line, "#"); comment_start >= 0 {
-			line = line[:comment_start]
-		}
-		// ignore empty lines
-		if len(line) == 0 {
-			continue
-		}
-		words = strings.Fields(line)
-		switch words[0] {
-		case "v":
-			// read in a vertex
-			floats, parseErr := parse3Floats(words[1:])
-			if parseErr != nil {
-				err = newParseError("OBJ", line_no)
-				return
+	texCoordsBuffer := make([]*geom.Vec3, 0)
+	facesBuffer := make([][3]OBJCorner, 0)
+	groupsBuffer := make([]FaceGroup, 0)
+
+	err = ReadOBJStream(*obj_reader, OBJHandler{
+		Vertex: func(i int, position geom.Vec3) error {
+			for len(verticesBuffer) < i {
+				verticesBuffer = append(verticesBuffer, nil)
 			}
-			m.Vertices.Append(&Vertex{
-				Vec3:   geom.Vec3{floats[0], floats[1], floats[2]},
-				Meshes: make(map[Mesh]int)})
-		case "vn":
-			// read in a vertex normal
-			floats, parseErr := parse3Floats(words[1:])
-			if parseErr != nil {
-				err = newParseError("OBJ", line_no)
-				return
+			verticesBuffer = append(verticesBuffer,
+				m.AddVertex(position.X, position.Y, position.Z))
+			return nil
+		},
+		TexCoord: func(i int, vt geom.Vec3) error {
+			for len(texCoordsBuffer) < i {
+				texCoordsBuffer = append(texCoordsBuffer, nil)
+			}
+			texCoordsBuffer = append(texCoordsBuffer, &vt)
+			return nil
+		},
+		Normal: func(i int, n geom.Vec3) error {
+			for len(normalsBuffer) < i {
+				normalsBuffer = append(normalsBuffer, nil)
 			}
-			normalsBuffer = append(normalsBuffer,
-				&geom.Vec3{floats[0], floats[1], floats[2]})
-		case "f":
-			// read in a faces
-			ints, parseErr := parse3Ints(words[1:])
-			if parseErr != nil {
-				err = newParseError("OBJ", line_no)
+			normalsBuffer = append(normalsBuffer, &n)
+			return nil
+		},
+		Face: func(corners []OBJCorner, group FaceGroup) error {
+			// triangulate faces with more than three corners
+			for i := 2; i < len(corners); i++ {
+				facesBuffer = append(facesBuffer,
+					[3]OBJCorner{corners[0], corners[i-1], corners[i]})
+				groupsBuffer = append(groupsBuffer, group)
+			}
+			return nil
+		},
+		MaterialLibrary: func(files []string) error {
+			m.Materials.Files = append(m.Materials.Files, files...)
+			return nil
+		},
+	}, options)
+	if err != nil {
+		return
+	}
+	vertex_count := len(verticesBuffer)
+
+	// faces may only reference elements which were eventually defined
+	valid_faces := 0
+	for i, f := range facesBuffer {
+		valid := true
+		for _, corner := range f {
+			valid = valid && corner.V < vertex_count && verticesBuffer[corner.V] != nil
+			if corner.VT >= 0 {
+				valid = valid && corner.VT < len(texCoordsBuffer) &&
+					texCoordsBuffer[corner.VT] != nil
+			}
+			if corner.VN >= 0 {
+				valid = valid && corner.VN < len(normalsBuffer) &&
+					normalsBuffer[corner.VN] != nil
+			}
+		}
+		if !valid {
+			err = &ParseError{Format: "OBJ", Err: errors.New("face references " +
+				"undefined vertex, texture coordinate or normal")}
+			if err = options.tolerate(err); err != nil {
 				return
 			}
-			facesBuffer = append(facesBuffer,
-				[3]int{ints[0] - 1, ints[1] - 1, ints[2] - 1})
-		default:
-			err = newParseError("OBJ", line_no)
-			return
+			continue
 		}
+		facesBuffer[valid_faces] = f
+		groupsBuffer[valid_faces] = groupsBuffer[i]
+		valid_faces++
 	}
+	facesBuffer = facesBuffer[:valid_faces]
+	groupsBuffer = groupsBuffer[:valid_faces]
 
-	for i, n := range normalsBuffer {
-		m.Vertices.Get(i)[0].SetNormal(n)
+	// Files which list one normal per vertex without referencing them from
+	// faces associate normals with vertices by order.
+	uses_normal_indices := false
+	for _, f := range facesBuffer {
+		if f[0].VN >= 0 || f[1].VN >= 0 || f[2].VN >= 0 {
+			uses_normal_indices = true
+			break
+		}
 	}
+	if !uses_normal_indices && len(normalsBuffer) == vertex_count {
+		for i, n := range normalsBuffer {
+			if verticesBuffer[i] != nil && n != nil {
+				verticesBuffer[i].SetNormal(n)
+			}
+		}
+	}
+
 	for i, f := range facesBuffer {
-		abc := m.Vertices.Get(f[0], f[1], f[2])
-		a, b, c := abc[0], abc[1], abc[2]
-		m.Faces.Append(&Face{Vertices: [3]VertexI{a, b, c}, Mesh: *m, Index: i})
+		abc := []VertexI{verticesBuffer[f[0].V], verticesBuffer[f[1].V], verticesBuffer[f[2].V]}
+		face := m.AddFace(abc[0], abc[1], abc[2])
+		face.SetGroup(groupsBuffer[i])
+		tex_coords := [3]*geom.Vec3{}
+		has_tex_coords := false
+		for i, corner := range f {
+			if corner.VN >= 0 {
+				abc[i].SetNormal(normalsBuffer[corner.VN])
+			}
+			if corner.VT >= 0 {
+				tex_coords[i] = texCoordsBuffer[corner.VT]
+				has_tex_coords = true
+			}
+		}
+		if has_tex_coords {
+			face.SetTexCoords(tex_coords)
+		}
 	}
 
 	return
 }
 
+// Options controlling how OBJ files are written.
+type OBJOptions struct {
+	// The number of decimal places floats are written with, or zero to write
+	// them exactly. Trailing zeros are kept, so output only changes when
+	// values change at the given precision.
+	Precision int
+	// Write the tex coords of faces as vt statements referenced from faces.
+	TexCoords bool
+}
+
 // Write this mesh to a new obj file.
-func (m *Mesh) WriteOBJ(obj_writer io.Writer) (err error) {
-	// track where vertices were written
-	vert_lookup := make(map[geom.Vec3]int)
+// Faces reference vertices by their location in the mesh. If any vertex has a
+// normal then a normal is written for every vertex (calculating any which are
+// missing) and referenced from faces as v//vn, or v/vt/vn with tex coords.
+// The object, group and material of each face are written as o, g and usemtl
+// statements, and the mesh's MTL files are referenced with mtllib.
+func (m *Mesh) WriteOBJ(obj_writer io.Writer, opts ...OBJOptions) (err error) {
+	mtl_files := []string{}
+	if m.Materials != nil {
+		mtl_files = m.Materials.Files
+	}
+	return m.writeOBJ(obj_writer, mtl_files, opts...)
+}
 
-	// Write Vertices
+func (m *Mesh) writeOBJ(obj_writer io.Writer, mtl_files []string, opts ...OBJOptions) (err error) {
+	options := OBJOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	w := NewOBJWriter(obj_writer, options)
+	if len(mtl_files) > 0 {
+		w.WriteMaterialLibrary(mtl_files...)
+	}
+
+	// track where vertices were written, by identity rather than position so
+	// that distinct vertices which coincide aren't merged
+	vert_lookup := make(map[VertexI]int, m.Vertices.Len())
+	with_normals := false
 	m.Vertices.EachWithIndex(func(i int, v VertexI) {
-		vert_lookup[v.Clone()] = i
-		_, err = obj_writer.Write([]byte(
-			"v " + strconv.FormatFloat(v.GetX(), 'f', -1, 64) +
-				" " + strconv.FormatFloat(v.GetY(), 'f', -1, 64) +
-				" " + strconv.FormatFloat(v.GetZ(), 'f', -1, 64) +
-				"\n",
-		))
+		vert_lookup[v] = i
+		with_normals = with_normals || v.GetNormal() != nil
+		w.WriteVertex(v.GetX(), v.GetY(), v.GetZ())
 	})
-	// It seems improbably that an error would occur for writing vertex but not
-	// the last one so only check the last one.
-	if err != nil {
-		err = errors.New(
-			"Error occured when attempting to write vertices to obj file.",
-		)
-		return
+	if w.err != nil {
+		return errors.New(
+			"Error occured when attempting to write vertices to obj file.")
 	}
 
-	// Write normals, unless first vector has no normal
-	for i := 0; i < m.Vertices.Len(); i++ {
-		v := m.Vertices.Get(i)[0]
-		n := v.GetNormal()
-		if n == nil {
-			v.CalculateNormal()
-			n = v.GetNormal()
+	if with_normals {
+		m.Vertices.Each(func(v VertexI) {
+			n := v.GetNormal()
+			if n == nil {
+				v.CalculateNormal()
+				n = v.GetNormal()
+			}
+			w.WriteNormal(n.GetX(), n.GetY(), n.GetZ())
+		})
+		if w.err != nil {
+			return errors.New(
+				"Error occured when attempting to write vertex normals obj file.")
 		}
-		_, err = obj_writer.Write([]byte(
-			"vn " + strconv.FormatFloat(n.GetX(), 'f', -1, 64) +
-				" " + strconv.FormatFloat(n.GetY(), 'f', -1, 64) +
-				" " + strconv.FormatFloat(n.GetZ(), 'f', -1, 64) +
-				"\n",
-		))
-	}
-	// It seems improbably that an error would occur for writing vertex but not
-	// the last one so only check the last one.
-	if err != nil {
-		err = errors.New(
-			"Error occured when attempting to write vertex normals obj file.",
-		)
-		return
 	}
 
-	// Write faces
-	for i := 0; i < m.Faces.Len(); i++ {
-		f := m.Faces.Get(i)[0]
-		_, err = obj_writer.Write([]byte(
-			"f " + strconv.Itoa(vert_lookup[f.GetA().Clone()]+1) +
-				" " + strconv.Itoa(vert_lookup[f.GetB().Clone()]+1) +
-				" " + strconv.Itoa(vert_lookup[f.GetC().Clone()]+1) +
-				"\n",
-		))
-	}
-	// It seems improbable that an error would occur for writing vertex but not
-	// the last one so only check the last one.
+	// write each distinct tex coord once, in the order faces first use them
+	tex_coord_lookup := make(map[geom.Vec3]int)
+	face_tex_coords := make([][3]int, m.Faces.Len())
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		face_tex_coords[i] = [3]int{-1, -1, -1}
+		if !options.TexCoords {
+			return
+		}
+		for j, vt := range f.GetTexCoords() {
+			if vt == nil {
+				continue
+			}
+			index, found := tex_coord_lookup[*vt]
+			if !found {
+				index = len(tex_coord_lookup)
+				tex_coord_lookup[*vt] = index
+				w.WriteTexCoord(*vt)
+			}
+			face_tex_coords[i][j] = index
+		}
+	})
+
+	// Write faces, preceded by statements for any change in group
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		if err != nil {
+			return
+		}
+		var corners [3]OBJCorner
+		for j, v := range [3]VertexI{f.GetA(), f.GetB(), f.GetC()} {
+			index, found := vert_lookup[v]
+			if !found {
+				err = errors.New("Error writing obj file: face references a " +
+					"vertex which isn't in the mesh")
+				return
+			}
+			corners[j] = OBJCorner{V: index, VT: face_tex_coords[i][j], VN: -1}
+			if with_normals {
+				corners[j].VN = index
+			}
+		}
+		w.WriteFace(f.GetGroup(), corners[:]...)
+	})
 	if err != nil {
-		err = errors.New(
-			"Error occured when attempting to write faces to obj file.",
-		)
 		return
 	}
+	if w.Flush() != nil {
+		err = errors.New(
+			"Error occured when attempting to write faces to obj file.")
+	}
 	return
 }
 
-// Read in STL file as new mesh. Not yet implemented
-func LoadSTL(stl_path string) (m *Mesh, err error) {
-	err = errors.New(
-		"STL reading not yet implemented",
-	)
-	return
-}
-
-// Write mesh to STL file. Not yet implemented
-func (m *Mesh) WriteSTL(stl_path string) (err error) {
-	err = errors.New(
-		"STL writing not yet implemented",
-	)
-	return
-}
-
-func ReadOBJFile(input_path string) (m *Mesh, err error) {
+// Read an OBJ file, along with any MTL files it references which can be found
+// relative to it. Any options apply to both.
+func ReadOBJFile(input_path string, opts ...ParseOptions) (m *Mesh, err error) {
 	// Open file
-	input_file, err := os.Open(input_path)
+	input_file, err := openFile(input_path)
 	if err != nil {
 		return
 	}
@@ -182,24 +274,51 @@ func ReadOBJFile(input_path string) (m *Mesh, err error) {
 
 	// Read from file
 	mesh_reader := io.Reader(input_file)
-	m, err = LoadOBJ(&mesh_reader)
-
-	return
-}
-
-func (m *Mesh) WriteOBJFile(output_path string) (err error) {
-	// Serialized JSON and stream to a file
-	output_file, err := os.Create(output_path)
+	m, err = LoadOBJ(&mesh_reader, opts...)
 	if err != nil {
 		return
 	}
-	defer output_file.Close()
-	err = m.WriteOBJ(io.Writer(output_file))
+
+	// Read referenced material libraries, tolerating missing files as exporters
+	// often reference MTL files which aren't distributed with the OBJ.
+	for _, mtl_file := range m.Materials.Files {
+		mats, mtlErr := ReadMTLFile(filepath.Join(filepath.Dir(input_path), mtl_file),
+			opts...)
+		if os.IsNotExist(mtlErr) {
+			continue
+		} else if mtlErr != nil {
+			err = mtlErr
+			return
+		}
+		m.Materials.Add(mats...)
+	}
 
 	return
 }
 
-func newParseError(fileType string, line_no int) error {
-	return errors.New(
-		"Error parsing " + fileType + " file on line: " + strconv.Itoa(line_no))
+// Write this mesh to an OBJ file, and its materials (if any) to an MTL file
+// of the same name alongside it. A mesh without materials keeps referencing
+// the MTL files it was read with.
+func (m *Mesh) WriteOBJFile(output_path string, opts ...OBJOptions) (err error) {
+	mtl_files := []string{}
+	if m.Materials != nil {
+		mtl_files = m.Materials.Files
+	}
+	if m.Materials != nil && !m.Materials.IsEmpty() {
+		mtl_files = []string{}
+		mtl_file := baseName(output_path) + ".mtl"
+		err = m.Materials.WriteMTLFile(
+			filepath.Join(filepath.Dir(output_path), mtl_file))
+		if err != nil {
+			return
+		}
+		mtl_files = append(mtl_files, mtl_file)
+	}
+
+	// Serialize and stream to a file
+	err = writeFile(output_path, func(w io.Writer) error {
+		return m.writeOBJ(w, mtl_files, opts...)
+	})
+
+	return
 }
@@ -0,0 +1,257 @@
+package mesh
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type objTestParams struct {
+	input           string
+	resultVerts     int
+	resultFaces     int
+	resultNormals   bool
+	resultTexCoords bool
+	resultError     bool
+}
+
+// Tests for LoadOBJ
+
+var loadOBJTests = []objTestParams{
+	{
+		input:       "v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n",
+		resultVerts: 3,
+		resultFaces: 1,
+	},
+	{
+		// quad with texture coordinates, normals and negative indices
+		input: `# exported
+mtllib scene.mtl
+o Plane
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+g plane_group
+usemtl Material
+s off
+f -4/-4/-1 -3/-3/-1 -2/-2/-1 -1/-1/-1
+`,
+		resultVerts:     4,
+		resultFaces:     2,
+		resultNormals:   true,
+		resultTexCoords: true,
+	},
+	{
+		input:         "v 0 0 0\nv 1 0 0\nv 1 1 0\nvn 0 0 1\nf 1//1 2//1 3//1\n",
+		resultVerts:   3,
+		resultFaces:   1,
+		resultNormals: true,
+	},
+	{
+		input:       "v 0 0 0\nv 1 0 0\nf 1 2 4\n",
+		resultError: true,
+	},
+	{
+		input:       "v 0 0\n",
+		resultError: true,
+	},
+	{
+		input:       "bogus 1 2 3\n",
+		resultError: true,
+	},
+}
+
+func TestLoadOBJ(t *testing.T) {
+	for _, params := range loadOBJTests {
+		r := io.Reader(strings.NewReader(params.input))
+		m, err := LoadOBJ(&r)
+		if params.resultError {
+			if err == nil {
+				t.Error("For OBJ", params.input, "expected an error, got none")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("For OBJ", params.input, "expected no error, got", err)
+			continue
+		}
+		if m.Vertices.Len() != params.resultVerts ||
+			m.Faces.Len() != params.resultFaces {
+			t.Error(
+				"For OBJ", params.input,
+				"expected", params.resultVerts, params.resultFaces,
+				"got", m.Vertices.Len(), m.Faces.Len(),
+			)
+		}
+		m.Vertices.Each(func(v VertexI) {
+			if (v.GetNormal() != nil) != params.resultNormals {
+				t.Error("For OBJ", params.input, "expected normals:",
+					params.resultNormals)
+			}
+		})
+		m.Faces.Each(func(f FaceI) {
+			if (f.GetTexCoords()[0] != nil) != params.resultTexCoords {
+				t.Error("For OBJ", params.input, "expected texture coordinates:",
+					params.resultTexCoords)
+			}
+		})
+	}
+}
+
+// Tests for WriteOBJ
+
+type writeOBJTestParams struct {
+	input   string
+	options OBJOptions
+	output  string
+}
+
+var writeOBJTests = []writeOBJTestParams{
+	{
+		// coincident vertices must keep their own faces
+		input:  "v 0 0 0\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 3 4\nf 2 4 3\n",
+		output: "v 0 0 0\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 3 4\nf 2 4 3\n",
+	},
+	{
+		input: "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1//1 2//1 3//1\n",
+		output: "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nvn 0 0 1\nvn 0 0 1\n" +
+			"f 1//1 2//2 3//3\n",
+	},
+	{
+		input:  "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nf 1/1 2/2 3/1\n",
+		output: "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+	},
+	{
+		input:   "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nf 1/1 2/2 3/1\n",
+		options: OBJOptions{TexCoords: true, Precision: 2},
+		output: "v 0.00 0.00 0.00\nv 1.00 0.00 0.00\nv 0.00 1.00 0.00\n" +
+			"vt 0.00 0.00\nvt 1.00 0.00\nf 1/1 2/2 3/1\n",
+	},
+	{
+		input:   "v 0.123456 1 -2.5\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		options: OBJOptions{Precision: 3},
+		output:  "v 0.123 1.000 -2.500\nv 1.000 0.000 0.000\nv 0.000 1.000 0.000\nf 1 2 3\n",
+	},
+}
+
+func TestWriteOBJ(t *testing.T) {
+	for _, params := range writeOBJTests {
+		r := io.Reader(strings.NewReader(params.input))
+		m, err := LoadOBJ(&r)
+		if err != nil {
+			t.Error("For OBJ", params.input, "expected no error, got", err)
+			continue
+		}
+		output := strings.Builder{}
+		if err = m.WriteOBJ(&output, params.options); err != nil {
+			t.Error("For OBJ", params.input, "expected no error writing, got", err)
+			continue
+		}
+		if output.String() != params.output {
+			t.Error("For OBJ", params.input, "expected", params.output,
+				"got", output.String())
+		}
+	}
+}
+
+// Tests for groups and materials through ReadOBJFile and WriteOBJFile
+
+var groupedOBJ = `mtllib parts.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+o Body
+g left
+usemtl Red
+f 1 2 3
+g right
+usemtl Blue
+f 1 3 4
+`
+
+var groupedMTL = `newmtl Red
+Kd 1 0 0
+d 0.5
+
+newmtl Blue
+Kd 0 0 1
+map_Kd blue.png
+`
+
+func TestOBJGroupsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "parts.obj"), []byte(groupedOBJ), 0644)
+	os.WriteFile(filepath.Join(dir, "parts.mtl"), []byte(groupedMTL), 0644)
+
+	m, err := ReadOBJFile(filepath.Join(dir, "parts.obj"))
+	if err != nil {
+		t.Fatal("Expected no error reading grouped OBJ, got", err)
+	}
+	if err = m.WriteOBJFile(filepath.Join(dir, "copy.obj")); err != nil {
+		t.Fatal("Expected no error writing grouped OBJ, got", err)
+	}
+	m, err = ReadOBJFile(filepath.Join(dir, "copy.obj"))
+	if err != nil {
+		t.Fatal("Expected no error reading written OBJ, got", err)
+	}
+
+	expectedGroups := []FaceGroup{
+		FaceGroup{"Body", "left", "Red"},
+		FaceGroup{"Body", "right", "Blue"},
+	}
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		if f.GetGroup() != expectedGroups[i] {
+			t.Error("For face", i, "expected group", expectedGroups[i],
+				"got", f.GetGroup())
+		}
+	})
+	red := m.Materials.Get("Red")
+	if red == nil || red.Diffuse != [3]float64{1, 0, 0} || red.Opacity != 0.5 {
+		t.Error("Expected material Red to survive round trip, got", red)
+	}
+	blue := m.Materials.Get("Blue")
+	if blue == nil || blue.DiffuseMap != "blue.png" {
+		t.Error("Expected material Blue to survive round trip, got", blue)
+	}
+	if len(m.Materials.Files) != 1 || m.Materials.Files[0] != "copy.mtl" {
+		t.Error("Expected written OBJ to reference copy.mtl, got",
+			m.Materials.Files)
+	}
+}
+
+func TestOBJMissingMaterials(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "parts.obj"), []byte(groupedOBJ), 0644)
+
+	m, err := ReadOBJFile(filepath.Join(dir, "parts.obj"))
+	if err != nil {
+		t.Fatal("Expected no error reading OBJ without its MTL file, got", err)
+	}
+	if !m.Materials.IsEmpty() {
+		t.Error("Expected no materials without the MTL file, got", m.Materials.Materials)
+	}
+	if err = m.WriteOBJFile(filepath.Join(dir, "copy.obj")); err != nil {
+		t.Fatal("Expected no error writing OBJ, got", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "copy.mtl")); !os.IsNotExist(err) {
+		t.Error("Expected no MTL file to be written, got", err)
+	}
+	m, err = ReadOBJFile(filepath.Join(dir, "copy.obj"))
+	if err != nil {
+		t.Fatal("Expected no error reading written OBJ, got", err)
+	}
+	if len(m.Materials.Files) != 1 || m.Materials.Files[0] != "parts.mtl" ||
+		m.Faces.Get(1)[0].GetGroup().Material != "Blue" {
+		t.Error("Expected written OBJ to keep referencing parts.mtl, got",
+			m.Materials.Files)
+	}
+}
@@ -12,14 +12,23 @@ import (
 import cb "github.com/nat-n/gomesh/cuboid"
 import tr "github.com/nat-n/gomesh/transformation"
 
-// Applies the given transformation to every vertex.
+// Applies the given transformation to every vertex, and to the directions of
+// vector and tangent attributes.
 func (m *Mesh) Transform(t tr.Transformation) {
 	t.ApplyToVec3(ConvertVertexSliceToVec3ISlice(m.Vertices.GetAll())...)
+	if m.Attributes != nil {
+		m.Attributes.transform(t, nil)
+	}
 }
 
-// Applies the given transformation to each vertex in indices.
+// Applies the given transformation to each vertex in indices, and to the
+// directions of their vector and tangent attributes.
 func (m *Mesh) TransformSubset(indices []int, t tr.Transformation) {
-	t.ApplyToVec3(ConvertVertexSliceToVec3ISlice(m.Vertices.Get(indices...))...)
+	vertices := m.Vertices.Get(indices...)
+	t.ApplyToVec3(ConvertVertexSliceToVec3ISlice(vertices)...)
+	if m.Attributes != nil {
+		m.Attributes.transform(t, vertices)
+	}
 }
 
 func (m *Mesh) BoundingBox() *cb.Cuboid {
@@ -48,7 +57,7 @@ func (m *Mesh) SubsetBoundingBox(subset interface{}) *cb.Cuboid {
 	if verts, ok := subset.([]VertexI); ok {
 		subset_indices = make([]int, len(verts), len(verts))
 		for i, vert := range verts {
-			subset_indices[i] = vert.GetLocationInMesh(*m)
+			subset_indices[i] = vert.GetLocationInMesh(m)
 		}
 	} else {
 		subset_indices = subset.([]int)
@@ -81,103 +90,103 @@ func NewFromCuboid(c cb.Cuboid) (m *Mesh) {
 		VertexI(&Vertex{
 			Vec3:   geom.Vec3{c.OriginX, c.OriginY, c.OriginZ},
 			Normal: &geom.Vec3{-normalComponent, -normalComponent, -normalComponent},
-			Meshes: MakeMeshesMap(*m, 0),
+			Meshes: MakeMeshesMap(m, 0),
 		}),
 		&Vertex{
 			Vec3:   geom.Vec3{c.TerminusX, c.OriginY, c.OriginZ},
 			Normal: &geom.Vec3{normalComponent, -normalComponent, -normalComponent},
-			Meshes: MakeMeshesMap(*m, 1),
+			Meshes: MakeMeshesMap(m, 1),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.TerminusX, c.OriginY, c.TerminusZ},
 			Normal: &geom.Vec3{normalComponent, -normalComponent, normalComponent},
-			Meshes: MakeMeshesMap(*m, 2),
+			Meshes: MakeMeshesMap(m, 2),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.OriginX, c.OriginY, c.TerminusZ},
 			Normal: &geom.Vec3{-normalComponent, -normalComponent, normalComponent},
-			Meshes: MakeMeshesMap(*m, 3),
+			Meshes: MakeMeshesMap(m, 3),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.OriginX, c.TerminusY, c.OriginZ},
 			Normal: &geom.Vec3{-normalComponent, normalComponent, -normalComponent},
-			Meshes: MakeMeshesMap(*m, 4),
+			Meshes: MakeMeshesMap(m, 4),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.TerminusX, c.TerminusY, c.OriginZ},
 			Normal: &geom.Vec3{normalComponent, normalComponent, -normalComponent},
-			Meshes: MakeMeshesMap(*m, 5),
+			Meshes: MakeMeshesMap(m, 5),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.TerminusX, c.TerminusY, c.TerminusZ},
 			Normal: &geom.Vec3{normalComponent, normalComponent, normalComponent},
-			Meshes: MakeMeshesMap(*m, 6),
+			Meshes: MakeMeshesMap(m, 6),
 		},
 		&Vertex{
 			Vec3:   geom.Vec3{c.OriginX, c.TerminusY, c.TerminusZ},
 			Normal: &geom.Vec3{-normalComponent, normalComponent, normalComponent},
-			Meshes: MakeMeshesMap(*m, 7),
+			Meshes: MakeMeshesMap(m, 7),
 		},
 	}
 	faces := []FaceI{
 		&Face{
 			Vertices: [3]VertexI{verts[0], verts[2], verts[1]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    0,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[0], verts[3], verts[2]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    1,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[0], verts[5], verts[1]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    2,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[0], verts[4], verts[5]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    3,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[1], verts[6], verts[2]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    4,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[1], verts[5], verts[6]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    5,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[2], verts[7], verts[3]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    6,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[2], verts[6], verts[7]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    7,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[3], verts[4], verts[0]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    8,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[3], verts[7], verts[4]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    9,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[5], verts[7], verts[6]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    10,
 		},
 		&Face{
 			Vertices: [3]VertexI{verts[5], verts[4], verts[7]},
-			Mesh:     *m,
+			Mesh:     m,
 			Index:    11,
 		},
 	}
@@ -196,21 +205,14 @@ func NewFromCuboid(c cb.Cuboid) (m *Mesh) {
 // Border vertices are identified as including a face which includes an edge
 // which is only included in that one face.
 func (m *Mesh) IdentifyBoundaries() (boundaries [][]VertexI, err error) {
-	edge_counts := make(map[VertexPair]int)
 	boundary_edges_slice := make(SortableVertexPairs, 0)
 	boundary_edges := list.New()
 
-	m.Faces.Each(func(f FaceI) {
-		edge_counts[MakeVertexPair(f.GetA(), f.GetB())]++
-		edge_counts[MakeVertexPair(f.GetB(), f.GetC())]++
-		edge_counts[MakeVertexPair(f.GetC(), f.GetA())]++
-	})
-
-	for edge, count := range edge_counts {
-		if count == 1 {
-			boundary_edges_slice = append(boundary_edges_slice, edge)
+	m.GetEdges().Each(func(e *Edge) {
+		if e.IsBoundary() {
+			boundary_edges_slice = append(boundary_edges_slice, MakeVertexPair(e.V1, e.V2))
 		}
-	}
+	})
 
 	// The purpose of the intermediate boundary_edges_slice is so the following
 	// intermediate boundary_edges list will be sorted so that this function can
@@ -9,21 +9,26 @@ type MeshI interface {
 	GetName() string
 	GetVertices() VertexCollection
 	GetFaces() FaceCollection
+	GetEdges() EdgeCollection
 	ReindexVerticesAndFaces()
 }
 
 type Mesh struct {
-	Name     string
-	Vertices VertexCollection
-	Faces    FaceCollection
+	Name       string
+	Vertices   VertexCollection
+	Faces      FaceCollection
+	Materials  *MaterialLibrary
+	Attributes *Attributes
 }
 
 // Constructor
 func New(name string) *Mesh {
 	return &Mesh{
-		Name:     name,
-		Vertices: &VertexSlice{make([]VertexI, 0)},
-		Faces:    &FaceSlice{make([]FaceI, 0)},
+		Name:       name,
+		Vertices:   &VertexSlice{make([]VertexI, 0)},
+		Faces:      &FaceSlice{make([]FaceI, 0)},
+		Materials:  &MaterialLibrary{},
+		Attributes: &Attributes{},
 	}
 }
 
@@ -71,16 +76,81 @@ func (m *Mesh) GetFaces() FaceCollection {
 	return m.Faces
 }
 
+// Appends a new vertex at the given position to the mesh, recording its
+// location in the mesh.
+func (m *Mesh) AddVertex(x, y, z float64) VertexI {
+	if vb, ok := m.Vertices.(*VertexBuffer); ok {
+		v := vb.NewVertex(x, y, z)
+		v.SetLocationInMesh(m, vb.Len()-1)
+		return v
+	}
+	v := &Vertex{
+		Vec3:   geom.Vec3{x, y, z},
+		Faces:  make([]FaceI, 0),
+		Meshes: MakeMeshesMap(m, m.Vertices.Len()),
+	}
+	m.Vertices.Append(v)
+	return v
+}
+
+// Appends a new face joining the given vertices to the mesh, and registers the
+// new face with each of its (distinct) vertices.
+func (m *Mesh) AddFace(a, b, c VertexI) FaceI {
+	var f FaceI
+	if fb, ok := m.Faces.(*FaceBuffer); ok {
+		bf := fb.NewFace(a, b, c)
+		bf.SetMeshLocation(m, fb.Len()-1)
+		f = bf
+	} else {
+		f = &Face{Vertices: [3]VertexI{a, b, c}, Mesh: m, Index: m.Faces.Len()}
+		m.Faces.Append(f)
+	}
+	a.AddFace(f)
+	if b != a {
+		b.AddFace(f)
+	}
+	if c != a && c != b {
+		c.AddFace(f)
+	}
+	return f
+}
+
+// Switches the mesh to storing its vertex positions and faces contiguously in
+// a VertexBuffer and FaceBuffer. The mesh's vertices and faces are replaced by
+// copies, along with their attribute values.
+func (m *Mesh) UseBuffers() {
+	vertices := NewVertexBuffer()
+	m.convert(vertices, NewFaceBuffer(vertices))
+}
+
+// Switches the mesh back to storing its vertices and faces in a VertexSlice
+// and FaceSlice. The mesh's vertices and faces are replaced by copies, along
+// with their attribute values.
+func (m *Mesh) UseSlices() {
+	m.convert(&VertexSlice{make([]VertexI, 0)}, &FaceSlice{make([]FaceI, 0)})
+}
+
+func (m *Mesh) convert(vertices VertexCollection, faces FaceCollection) {
+	converted := &Mesh{Name: m.Name, Vertices: vertices, Faces: faces,
+		Attributes: &Attributes{}}
+	converted.appendCopy(m)
+	m.Vertices.Each(func(v VertexI) { v.ForgetLocationInMesh(m) })
+	m.Vertices, m.Faces, m.Attributes = converted.Vertices, converted.Faces,
+		converted.Attributes
+	m.Vertices.Each(func(v VertexI) { v.ForgetLocationInMesh(converted) })
+	m.ReindexVerticesAndFaces()
+}
+
 func (m *Mesh) ReindexVerticesAndFaces() {
 	m.Vertices.EachWithIndex(func(i int, v VertexI) {
-		v.ForgetLocationInMeshByName(m.GetName())
-		v.SetLocationInMesh(*m, i)
+		v.SetLocationInMesh(m, i)
 	})
-	m.Faces.EachWithIndex(func(i int, f FaceI) { f.SetMeshLocation(*m, i) })
+	m.Faces.EachWithIndex(func(i int, f FaceI) { f.SetMeshLocation(m, i) })
 }
 
 // Accepts two vertices with identical locations and moves all faces from the
-// secondaries to the primary
+// secondaries to the primary. The primary takes the attribute values of the
+// secondaries where it has none of its own.
 // This method assumes vertex Indices are accurate
 func MergeSharedVertices(vprime VertexI, vsecs ...VertexI) (err error) {
 	for _, vsec := range vsecs {
@@ -111,6 +181,10 @@ func MergeSharedVertices(vprime VertexI, vsecs ...VertexI) (err error) {
 			panic("Method assumption violated: vertex index inaccurate")
 		}
 		vsec_mesh.GetVertices().Update(vsec_i, vprime)
+		if vsec_mesh.Attributes != nil {
+			vsec_mesh.Attributes.mergeVertex(vprime, vsec)
+		}
+		vsec.ForgetLocationInMesh(vsec_mesh)
 		vprime.SetLocationInMesh(vsec_mesh, vsec_i)
 	}
 	return
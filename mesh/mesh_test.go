@@ -0,0 +1,44 @@
+package mesh
+
+import (
+	"testing"
+)
+
+// Tests for mesh membership of vertices and faces
+
+func TestMeshIdentity(t *testing.T) {
+	m, verts := testTetrahedron()
+	m.Name = "renamed"
+	m.Faces = &FaceSlice{m.Faces.GetAll()}
+	for i, v := range verts {
+		if !v.OccursInMesh(m) || v.GetLocationInMesh(m) != i {
+			t.Error("Expected vertex", i, "to keep its location after renaming")
+		}
+	}
+	m.Faces.EachWithIndex(func(i int, f FaceI) {
+		if f_mesh, f_i := f.GetMeshLocation(); f_mesh != m || f_i != i {
+			t.Error("Expected face", i, "to be in the renamed mesh, got", f_i)
+		}
+	})
+
+	// a vertex shared with a second mesh of the same name
+	other := New("renamed")
+	other.AddVertex(5, 5, 5)
+	other.Vertices.Append(verts[2])
+	verts[2].SetLocationInMesh(other, 1)
+	if verts[2].CountOccurances() != 2 || verts[2].GetLocationInMesh(m) != 2 ||
+		verts[2].GetLocationInMesh(other) != 1 {
+		t.Error("Expected vertex to be located in both meshes, got", verts[2].(*Vertex).Meshes)
+	}
+	other.ReindexVerticesAndFaces()
+	m.Vertices.Remove(0)
+	m.ReindexVerticesAndFaces()
+	if verts[2].GetLocationInMesh(m) != 1 || verts[2].GetLocationInMesh(other) != 1 {
+		t.Error("Expected reindexing one mesh to leave the other alone, got",
+			verts[2].(*Vertex).Meshes)
+	}
+	verts[2].ForgetLocationInMesh(other)
+	if verts[2].OccursInMesh(other) || !verts[2].OccursInMesh(m) {
+		t.Error("Expected vertex to be forgotten by only one mesh")
+	}
+}
@@ -0,0 +1,231 @@
+package mesh
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A material as described by a Wavefront MTL file.
+type Material struct {
+	Name         string
+	Ambient      [3]float64 // Ka
+	Diffuse      [3]float64 // Kd
+	Specular     [3]float64 // Ks
+	Emissive     [3]float64 // Ke
+	Shininess    float64    // Ns
+	Opacity      float64    // d
+	Illumination int        // illum
+	DiffuseMap   string     // map_Kd
+	// Any other statements from the material definition, kept verbatim so they
+	// can be written back out.
+	Other []string
+}
+
+// Constructs a new material with the default values of the MTL format.
+func NewMaterial(name string) *Material {
+	return &Material{
+		Name:         name,
+		Ambient:      [3]float64{0.2, 0.2, 0.2},
+		Diffuse:      [3]float64{0.8, 0.8, 0.8},
+		Specular:     [3]float64{1, 1, 1},
+		Shininess:    0,
+		Opacity:      1,
+		Illumination: 2,
+	}
+}
+
+// The materials available to the faces of a mesh, and the MTL files they were
+// read from.
+type MaterialLibrary struct {
+	Files     []string
+	Materials []*Material
+}
+
+// Returns the material with the given name, or nil if there is none.
+func (ml *MaterialLibrary) Get(name string) *Material {
+	for _, mat := range ml.Materials {
+		if mat.Name == name {
+			return mat
+		}
+	}
+	return nil
+}
+
+// Adds materials to the library, replacing any existing materials with the
+// same names.
+func (ml *MaterialLibrary) Add(mats ...*Material) {
+	for _, mat := range mats {
+		replaced := false
+		for i, existing := range ml.Materials {
+			if existing.Name == mat.Name {
+				ml.Materials[i] = mat
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			ml.Materials = append(ml.Materials, mat)
+		}
+	}
+}
+
+func (ml *MaterialLibrary) IsEmpty() bool {
+	return len(ml.Materials) == 0
+}
+
+// Read the materials defined in an MTL file. Malformed statements produce a
+// *ParseError, unless options are given for lenient parsing in which case
+// they're skipped.
+func LoadMTL(mtl_reader *io.Reader, opts ...ParseOptions) (mats []*Material, err error) {
+	options := ParseOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	var (
+		line    string
+		words   []string
+		current *Material
+	)
+	line_no := 0
+
+	scanner := bufio.NewScanner(*mtl_reader)
+	for scanner.Scan() {
+		line_no++
+		raw_line := scanner.Text()
+		line = strings.TrimSpace(raw_line)
+		if comment_start := strings.Index(line, "#"); comment_start >= 0 {
+			line = line[:comment_start]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		words = strings.Fields(line)
+		parseError := func(token string, cause error) error {
+			err = newTokenError("MTL", line_no, raw_line, token, cause)
+			return options.tolerate(err)
+		}
+		if words[0] == "newmtl" {
+			if len(words) < 2 {
+				if err = parseError(words[0], errors.New("missing material name")); err != nil {
+					return
+				}
+				continue
+			}
+			current = NewMaterial(strings.Join(words[1:], " "))
+			mats = append(mats, current)
+			continue
+		}
+		if current == nil {
+			if err = parseError(words[0], errors.New("statement before newmtl")); err != nil {
+				return
+			}
+			continue
+		}
+
+		var parseErr error
+		switch words[0] {
+		case "Ka", "Kd", "Ks", "Ke":
+			var color [3]float64
+			if len(words) != 4 {
+				// spectral and xyz colors are kept verbatim
+				current.Other = append(current.Other, line)
+				continue
+			}
+			color, parseErr = parse3Floats(words[1:])
+			switch words[0] {
+			case "Ka":
+				current.Ambient = color
+			case "Kd":
+				current.Diffuse = color
+			case "Ks":
+				current.Specular = color
+			case "Ke":
+				current.Emissive = color
+			}
+		case "Ns":
+			current.Shininess, parseErr = parseMTLFloat(words)
+		case "d":
+			current.Opacity, parseErr = parseMTLFloat(words)
+		case "Tr":
+			var transparency float64
+			transparency, parseErr = parseMTLFloat(words)
+			current.Opacity = 1 - transparency
+		case "illum":
+			if len(words) != 2 {
+				parseErr = errors.New("illum needs one argument")
+				break
+			}
+			current.Illumination, parseErr = strconv.Atoi(words[1])
+		case "map_Kd":
+			current.DiffuseMap = strings.Join(words[1:], " ")
+		default:
+			current.Other = append(current.Other, line)
+		}
+		if parseErr != nil {
+			if err = parseError("", parseErr); err != nil {
+				return
+			}
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// Parses the single float argument of an MTL statement.
+func parseMTLFloat(words []string) (float64, error) {
+	if len(words) != 2 {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseFloat(words[1], 64)
+}
+
+func ReadMTLFile(input_path string, opts ...ParseOptions) (mats []*Material, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	mtl_reader := io.Reader(input_file)
+	mats, err = LoadMTL(&mtl_reader, opts...)
+	return
+}
+
+// Write the materials of the library as an MTL file.
+func (ml *MaterialLibrary) WriteMTL(mtl_writer io.Writer) (err error) {
+	formatColor := func(c [3]float64) string {
+		return strconv.FormatFloat(c[0], 'f', -1, 64) + " " +
+			strconv.FormatFloat(c[1], 'f', -1, 64) + " " +
+			strconv.FormatFloat(c[2], 'f', -1, 64)
+	}
+	for _, mat := range ml.Materials {
+		definition := "newmtl " + mat.Name + "\n" +
+			"Ka " + formatColor(mat.Ambient) + "\n" +
+			"Kd " + formatColor(mat.Diffuse) + "\n" +
+			"Ks " + formatColor(mat.Specular) + "\n" +
+			"Ke " + formatColor(mat.Emissive) + "\n" +
+			"Ns " + strconv.FormatFloat(mat.Shininess, 'f', -1, 64) + "\n" +
+			"d " + strconv.FormatFloat(mat.Opacity, 'f', -1, 64) + "\n" +
+			"illum " + strconv.Itoa(mat.Illumination) + "\n"
+		if mat.DiffuseMap != "" {
+			definition += "map_Kd " + mat.DiffuseMap + "\n"
+		}
+		for _, other := range mat.Other {
+			definition += other + "\n"
+		}
+		if _, err = io.WriteString(mtl_writer, definition+"\n"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (ml *MaterialLibrary) WriteMTLFile(output_path string) (err error) {
+	err = writeFile(output_path, func(w io.Writer) error {
+		return ml.WriteMTL(w)
+	})
+	return
+}
@@ -0,0 +1,528 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nat-n/geom"
+	"hash/crc32"
+	"io"
+	"math"
+	"strconv"
+)
+
+// The gomesh binary format stores a mesh as contiguous little-endian arrays so
+// that it can be loaded without any text parsing. Version 2 is laid out as:
+//
+//	magic          8 bytes, "\x89GOMESH\n"
+//	version        uint32
+//	flags          uint32, which of the optional sections below are present
+//	name           string
+//	vertex count   uint32
+//	face count     uint32
+//	positions      3 float64 per vertex
+//	normals        3 float64 per vertex (nativeHasNormals)
+//	colors         4 float64 per vertex (nativeHasColors)
+//	faces          3 uint32 vertex indices per face
+//	tex coords     9 float64 per face (nativeHasTexCoords)
+//	groups         uint32 count, then object, group and material strings for
+//	               each, then a uint32 group index per face (nativeHasGroups)
+//	attributes     uint32 count, then for each a name, a uint32 AttributeType
+//	               and its components as float64s for each vertex, followed
+//	               by the same for face attributes and then corner attributes
+//	               (with the values of each face's three corners in turn)
+//	checksum       uint32, CRC-32 (Castagnoli) of all preceding bytes
+//
+// where strings are a uint32 byte length followed by UTF-8 bytes. The positions
+// and faces sections have the same layout as the Buffer of a triplebuffer
+// VertexBuffer and TriangleBuffer respectively. Attribute values missing for a
+// vertex, face or corner are stored as NaN. Materials are not stored.
+// Version 1 files, whose attributes are all scalars with no type and which
+// have no corner attributes, can still be read.
+const NativeVersion = 2
+
+const (
+	nativeHasNormals = 1 << iota
+	nativeHasColors
+	nativeHasTexCoords
+	nativeHasGroups
+)
+
+var nativeMagic = []byte("\x89GOMESH\n")
+
+var nativeChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options controlling how gomesh binary files are read.
+type NativeOptions struct {
+	// Memory map the file rather than reading it, where the platform supports
+	// it. The mesh doesn't retain any reference to the mapped file.
+	MemoryMap bool
+}
+
+// Appends little-endian values to a byte slice.
+type nativeEncoder struct {
+	data []byte
+}
+
+func (e *nativeEncoder) Uint32(value uint32) {
+	e.data = append(e.data, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.data[len(e.data)-4:], value)
+}
+
+func (e *nativeEncoder) Float64(value float64) {
+	e.data = append(e.data, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.data[len(e.data)-8:], math.Float64bits(value))
+}
+
+func (e *nativeEncoder) String(value string) {
+	e.Uint32(uint32(len(value)))
+	e.data = append(e.data, value...)
+}
+
+// Reads little-endian values from a byte slice, recording the first error so
+// that it only needs to be checked once per section.
+type nativeDecoder struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+// Returns the next n bytes, or nil if there aren't that many.
+func (d *nativeDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.data)-d.offset < n {
+		d.err = errors.New("Error reading gomesh binary file: unexpected end of data at byte " +
+			strconv.Itoa(d.offset))
+		return nil
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+func (d *nativeDecoder) Uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *nativeDecoder) String() string {
+	// converting to a string copies the bytes, so it's safe to unmap the data
+	return string(d.next(int(d.Uint32())))
+}
+
+// Returns the next count*size bytes for an array of count values of the given
+// size, checking the count is plausible before anything is allocated for it.
+func (d *nativeDecoder) array(count uint32, size int) []byte {
+	if uint64(count)*uint64(size) > uint64(len(d.data)-d.offset) {
+		d.next(len(d.data) - d.offset + 1)
+		return nil
+	}
+	return d.next(int(count) * size)
+}
+
+// Write mesh in the gomesh binary format.
+// Normals are written if every vertex has one, colors if any vertex has one,
+// and tex coords if every face has all three.
+func (m *Mesh) WriteNative(native_writer io.Writer) (err error) {
+	vertex_count := m.Vertices.Len()
+	face_count := m.Faces.Len()
+
+	flags := uint32(0)
+	has_normals := vertex_count > 0
+	has_colors := false
+	m.Vertices.Each(func(v VertexI) {
+		has_normals = has_normals && v.GetNormal() != nil
+		has_colors = has_colors || v.GetColor() != nil
+	})
+	has_tex_coords := face_count > 0
+	has_groups := false
+	m.Faces.Each(func(f FaceI) {
+		for _, vt := range f.GetTexCoords() {
+			has_tex_coords = has_tex_coords && vt != nil
+		}
+		has_groups = has_groups || f.GetGroup() != FaceGroup{}
+	})
+	if has_normals {
+		flags |= nativeHasNormals
+	}
+	if has_colors {
+		flags |= nativeHasColors
+	}
+	if has_tex_coords {
+		flags |= nativeHasTexCoords
+	}
+	if has_groups {
+		flags |= nativeHasGroups
+	}
+
+	e := &nativeEncoder{
+		data: make([]byte, 0, 64+len(m.Name)+vertex_count*24+face_count*12),
+	}
+	e.data = append(e.data, nativeMagic...)
+	e.Uint32(NativeVersion)
+	e.Uint32(flags)
+	e.String(m.Name)
+	e.Uint32(uint32(vertex_count))
+	e.Uint32(uint32(face_count))
+
+	// track where vertices were written
+	vert_lookup := make(map[VertexI]int, vertex_count)
+	m.Vertices.EachWithIndex(func(i int, v VertexI) {
+		vert_lookup[v] = i
+		e.Float64(v.GetX())
+		e.Float64(v.GetY())
+		e.Float64(v.GetZ())
+	})
+	if has_normals {
+		m.Vertices.Each(func(v VertexI) {
+			n := v.GetNormal()
+			e.Float64(n.GetX())
+			e.Float64(n.GetY())
+			e.Float64(n.GetZ())
+		})
+	}
+	if has_colors {
+		m.Vertices.Each(func(v VertexI) {
+			c := v.GetColor()
+			if c == nil {
+				c = &Color{1, 1, 1, 1}
+			}
+			for _, component := range c {
+				e.Float64(component)
+			}
+		})
+	}
+
+	var write_err error
+	m.Faces.Each(func(f FaceI) {
+		f.EachVertex(func(v VertexI) {
+			i, found := vert_lookup[v]
+			if !found {
+				write_err = errors.New("Cannot write gomesh binary file: face " +
+					"references a vertex which isn't in the mesh")
+			}
+			e.Uint32(uint32(i))
+		})
+	})
+	if write_err != nil {
+		return write_err
+	}
+	if has_tex_coords {
+		m.Faces.Each(func(f FaceI) {
+			for _, vt := range f.GetTexCoords() {
+				e.Float64(vt.GetX())
+				e.Float64(vt.GetY())
+				e.Float64(vt.GetZ())
+			}
+		})
+	}
+	if has_groups {
+		groups := []FaceGroup{}
+		group_lookup := make(map[FaceGroup]int)
+		group_indices := make([]int, 0, face_count)
+		m.Faces.Each(func(f FaceI) {
+			group := f.GetGroup()
+			i, found := group_lookup[group]
+			if !found {
+				i = len(groups)
+				group_lookup[group] = i
+				groups = append(groups, group)
+			}
+			group_indices = append(group_indices, i)
+		})
+		e.Uint32(uint32(len(groups)))
+		for _, group := range groups {
+			e.String(group.Object)
+			e.String(group.Group)
+			e.String(group.Material)
+		}
+		for _, i := range group_indices {
+			e.Uint32(uint32(i))
+		}
+	}
+
+	vertexAttributes := []*VertexAttribute{}
+	faceAttributes := []*FaceAttribute{}
+	cornerAttributes := []*CornerAttribute{}
+	if m.Attributes != nil {
+		vertexAttributes = m.Attributes.Vertex
+		faceAttributes = m.Attributes.Face
+		cornerAttributes = m.Attributes.Corner
+	}
+	// writes a value's components, or NaNs if it's missing
+	attribute := func(t AttributeType, value []float64, found bool) {
+		for c := 0; c < t.Components(); c++ {
+			if found && c < len(value) {
+				e.Float64(value[c])
+			} else {
+				e.Float64(math.NaN())
+			}
+		}
+	}
+	e.Uint32(uint32(len(vertexAttributes)))
+	for _, attr := range vertexAttributes {
+		e.String(attr.Name)
+		e.Uint32(uint32(attr.Type))
+		m.Vertices.Each(func(v VertexI) {
+			value, found := attr.Get(v)
+			attribute(attr.Type, value, found)
+		})
+	}
+	e.Uint32(uint32(len(faceAttributes)))
+	for _, attr := range faceAttributes {
+		e.String(attr.Name)
+		e.Uint32(uint32(attr.Type))
+		m.Faces.Each(func(f FaceI) {
+			value, found := attr.Get(f)
+			attribute(attr.Type, value, found)
+		})
+	}
+	e.Uint32(uint32(len(cornerAttributes)))
+	for _, attr := range cornerAttributes {
+		e.String(attr.Name)
+		e.Uint32(uint32(attr.Type))
+		m.Faces.Each(func(f FaceI) {
+			for i := 0; i < 3; i++ {
+				value, found := attr.Get(Corner{f, i})
+				attribute(attr.Type, value, found)
+			}
+		})
+	}
+
+	e.Uint32(crc32.Checksum(e.data, nativeChecksumTable))
+	_, err = native_writer.Write(e.data)
+	return
+}
+
+func (m *Mesh) WriteNativeFile(output_path string) (err error) {
+	err = writeFile(output_path, m.WriteNative)
+	return
+}
+
+// Read a new mesh from a gomesh binary file.
+func LoadNative(native_reader *io.Reader) (m *Mesh, err error) {
+	data, err := io.ReadAll(*native_reader)
+	if err != nil {
+		return
+	}
+	return decodeNative(data)
+}
+
+// Read a new mesh from a gomesh binary file, memory mapping it if requested in
+// the options. Compressed files, and files on platforms which don't support
+// memory mapping, are read normally.
+func ReadNativeFile(input_path string, opts ...NativeOptions) (m *Mesh, err error) {
+	if len(opts) > 0 && opts[0].MemoryMap {
+		data, unmap, mapErr := mapFile(input_path)
+		if mapErr == nil {
+			if bytes.HasPrefix(data, nativeMagic) {
+				m, err = decodeNative(data)
+				if unmapErr := unmap(); err == nil {
+					err = unmapErr
+				}
+				return
+			}
+			unmap()
+		}
+	}
+
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	native_reader := io.Reader(input_file)
+	m, err = LoadNative(&native_reader)
+	return
+}
+
+// Populates a new mesh from the complete contents of a gomesh binary file.
+func decodeNative(data []byte) (m *Mesh, err error) {
+	if !bytes.HasPrefix(data, nativeMagic) {
+		err = errors.New("Error reading gomesh binary file: missing magic number")
+		return
+	}
+	if len(data) < len(nativeMagic)+8 {
+		err = errors.New("Error reading gomesh binary file: truncated header")
+		return
+	}
+	checksum_at := len(data) - 4
+	if crc32.Checksum(data[:checksum_at], nativeChecksumTable) !=
+		binary.LittleEndian.Uint32(data[checksum_at:]) {
+		err = errors.New("Error reading gomesh binary file: checksum mismatch")
+		return
+	}
+
+	d := &nativeDecoder{data: data[:checksum_at], offset: len(nativeMagic)}
+	version := d.Uint32()
+	if version != 1 && version != NativeVersion {
+		err = errors.New("Error reading gomesh binary file: unsupported version " +
+			strconv.Itoa(int(version)))
+		return
+	}
+	flags := d.Uint32()
+	m = New(d.String())
+	vertex_count := d.Uint32()
+	face_count := d.Uint32()
+
+	positions := d.array(vertex_count, 24)
+	var normals, colors []byte
+	if flags&nativeHasNormals != 0 {
+		normals = d.array(vertex_count, 24)
+	}
+	if flags&nativeHasColors != 0 {
+		colors = d.array(vertex_count, 32)
+	}
+	indices := d.array(face_count, 12)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	float := func(b []byte, i int) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:]))
+	}
+	vertices := make([]VertexI, vertex_count)
+	for i := range vertices {
+		v := m.AddVertex(float(positions, i*3), float(positions, i*3+1),
+			float(positions, i*3+2))
+		if normals != nil {
+			v.SetNormal(&geom.Vec3{float(normals, i*3), float(normals, i*3+1),
+				float(normals, i*3+2)})
+		}
+		if colors != nil {
+			v.SetColor(&Color{float(colors, i*4), float(colors, i*4+1),
+				float(colors, i*4+2), float(colors, i*4+3)})
+		}
+		vertices[i] = v
+	}
+
+	faces := make([]FaceI, face_count)
+	for i := range faces {
+		var corners [3]VertexI
+		for j := range corners {
+			index := binary.LittleEndian.Uint32(indices[i*12+j*4:])
+			if index >= vertex_count {
+				return nil, errors.New("Error reading gomesh binary file: face " +
+					strconv.Itoa(i) + " references undefined vertex " +
+					strconv.Itoa(int(index)))
+			}
+			corners[j] = vertices[index]
+		}
+		faces[i] = m.AddFace(corners[0], corners[1], corners[2])
+	}
+
+	if flags&nativeHasTexCoords != 0 {
+		tex_coords := d.array(face_count, 72)
+		if d.err != nil {
+			return nil, d.err
+		}
+		for i, f := range faces {
+			var vts [3]*geom.Vec3
+			for j := range vts {
+				k := i*9 + j*3
+				vts[j] = &geom.Vec3{float(tex_coords, k), float(tex_coords, k+1),
+					float(tex_coords, k+2)}
+			}
+			f.SetTexCoords(vts)
+		}
+	}
+	if flags&nativeHasGroups != 0 {
+		group_count := d.Uint32()
+		if uint64(group_count)*12 > uint64(len(d.data)) {
+			return nil, errors.New("Error reading gomesh binary file: invalid group count")
+		}
+		groups := make([]FaceGroup, group_count)
+		for i := range groups {
+			groups[i] = FaceGroup{Object: d.String(), Group: d.String(),
+				Material: d.String()}
+		}
+		group_indices := d.array(face_count, 4)
+		if d.err != nil {
+			return nil, d.err
+		}
+		for i, f := range faces {
+			index := binary.LittleEndian.Uint32(group_indices[i*4:])
+			if index >= group_count {
+				return nil, errors.New("Error reading gomesh binary file: face " +
+					strconv.Itoa(i) + " references undefined group " +
+					strconv.Itoa(int(index)))
+			}
+			f.SetGroup(groups[index])
+		}
+	}
+
+	// reads the name, type and values of an attribute of count elements, with
+	// nil for missing values
+	attribute := func(count uint32) (name string, t AttributeType, values [][]float64) {
+		name = d.String()
+		if version > 1 {
+			t = AttributeType(d.Uint32())
+			if t > TangentAttribute && d.err == nil {
+				d.err = errors.New("Error reading gomesh binary file: unknown type " +
+					strconv.Itoa(int(t)) + " of attribute " + name)
+			}
+		}
+		components := t.Components()
+		data := d.array(count, 8*components)
+		values = make([][]float64, len(data)/8/components)
+		for i := range values {
+			if value := float(data, i*components); !math.IsNaN(value) {
+				values[i] = make([]float64, components)
+				for c := range values[i] {
+					values[i][c] = float(data, i*components+c)
+				}
+			}
+		}
+		return
+	}
+	attribute_count := d.Uint32()
+	for a := uint32(0); a < attribute_count && d.err == nil; a++ {
+		name, t, values := attribute(vertex_count)
+		attr := m.Attributes.AddVertexAttribute(name, t)
+		for i, value := range values {
+			if value != nil {
+				attr.Set(vertices[i], value...)
+			}
+		}
+	}
+	attribute_count = d.Uint32()
+	for a := uint32(0); a < attribute_count && d.err == nil; a++ {
+		name, t, values := attribute(face_count)
+		attr := m.Attributes.AddFaceAttribute(name, t)
+		for i, value := range values {
+			if value != nil {
+				attr.Set(faces[i], value...)
+			}
+		}
+	}
+	attribute_count = 0
+	if version > 1 {
+		attribute_count = d.Uint32()
+	}
+	for a := uint32(0); a < attribute_count && d.err == nil; a++ {
+		name, t, values := attribute(face_count * 3)
+		attr := m.Attributes.AddCornerAttribute(name, t)
+		for i, value := range values {
+			if value != nil {
+				attr.Set(Corner{faces[i/3], i % 3}, value...)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.offset != len(d.data) {
+		return nil, errors.New("Error reading gomesh binary file: unexpected data at byte " +
+			strconv.Itoa(d.offset))
+	}
+	return
+}
+
+func sniffNative(header []byte) bool {
+	return bytes.HasPrefix(header, nativeMagic)
+}
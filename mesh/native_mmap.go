@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package mesh
+
+import (
+	"os"
+	"syscall"
+)
+
+// Memory maps a file read-only, returning its contents and a function to unmap
+// it once they are no longer needed.
+func mapFile(path string) (data []byte, unmap func() error, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	size := info.Size()
+	if size == 0 || int64(int(size)) != size {
+		err = syscall.EINVAL
+		return
+	}
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(size),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return
+	}
+	unmap = func() error { return syscall.Munmap(data) }
+	return
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package mesh
+
+import (
+	"errors"
+)
+
+// Memory mapping isn't supported on this platform, so files are always read.
+func mapFile(path string) (data []byte, unmap func() error, err error) {
+	err = errors.New("Memory mapping is not supported on this platform")
+	return
+}
@@ -0,0 +1,93 @@
+package mesh
+
+import (
+	"bytes"
+	"github.com/nat-n/geom"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for LoadNative and WriteNative
+
+func TestNativeRoundTrip(t *testing.T) {
+	r := io.Reader(strings.NewReader(asciiPLY))
+	m, err := LoadPLY(&r)
+	if err != nil {
+		t.Fatal("Expected no error reading PLY, got", err)
+	}
+	m.Name = "quad"
+	m.Vertices.Each(func(v VertexI) { v.SetNormal(&geom.Vec3{0, 0, 1}) })
+	m.Faces.Get(1)[0].SetGroup(FaceGroup{Object: "quad", Material: "red"})
+	m.Attributes.AddVertexAttribute("flow", VectorAttribute).Set(m.Vertices.Get(2)[0], 1, 2, 3)
+	m.Attributes.AddCornerAttribute("uv", TexCoordAttribute).Set(
+		Corner{m.Faces.Get(1)[0], 2}, 0.5, 1)
+
+	buf := new(bytes.Buffer)
+	if err = m.WriteNative(buf); err != nil {
+		t.Fatal("Expected no error writing native format, got", err)
+	}
+	data := buf.Bytes()
+
+	path := filepath.Join(t.TempDir(), "quad.gomesh")
+	os.WriteFile(path, data, 0644)
+	for _, opts := range []NativeOptions{{}, {MemoryMap: true}} {
+		m2, err := ReadNativeFile(path, opts)
+		if err != nil {
+			t.Error("For", opts, "expected no error reading, got", err)
+			continue
+		}
+		if m2.Name != "quad" || m2.Vertices.Len() != 4 || m2.Faces.Len() != 2 {
+			t.Error("For", opts, "expected quad with 4 vertices and 2 faces, got",
+				m2.Name, m2.Vertices.Len(), m2.Faces.Len())
+			continue
+		}
+		v := m2.Vertices.Get(2)[0]
+		if v.GetX() != 1 || v.GetY() != 1 || *v.GetNormal() != (geom.Vec3{0, 0, 1}) ||
+			*v.GetColor() != (Color{0, 0, 1, 1}) {
+			t.Error("For", opts, "expected vertex 2 to be preserved, got", v)
+		}
+		confidence := m2.Attributes.GetVertexAttribute("confidence")
+		if confidence == nil || confidence.Values[v] != 1 {
+			t.Error("For", opts, "expected confidence attribute, got", confidence)
+		}
+		f := m2.Faces.Get(1)[0]
+		if f.GetGroup() != (FaceGroup{Object: "quad", Material: "red"}) ||
+			m2.Faces.Get(0)[0].GetGroup() != (FaceGroup{}) {
+			t.Error("For", opts, "expected face groups to be preserved")
+		}
+		label := m2.Attributes.GetFaceAttribute("label")
+		if label == nil || label.Type != LabelAttribute || label.Values[f] != 7 {
+			t.Error("For", opts, "expected label attribute, got", label)
+		}
+		flow := m2.Attributes.GetVertexAttribute("flow")
+		if value, found := flow.Get(v); flow.Type != VectorAttribute || !found ||
+			value[2] != 3 {
+			t.Error("For", opts, "expected flow vector attribute, got", flow)
+		}
+		uv := m2.Attributes.GetCornerAttribute("uv")
+		if value, found := uv.Get(Corner{f, 2}); uv.Type != TexCoordAttribute ||
+			!found || value[0] != 0.5 || value[1] != 1 {
+			t.Error("For", opts, "expected uv corner attribute, got", uv)
+		} else if _, found = uv.Get(Corner{f, 0}); found {
+			t.Error("For", opts, "expected missing corner values to stay missing")
+		}
+		if f.GetA() != m2.Vertices.Get(0)[0] || f.GetC() != m2.Vertices.Get(3)[0] {
+			t.Error("For", opts, "expected face to share vertices")
+		}
+	}
+
+	// corruption is detected by the checksum
+	corrupt := append([]byte{}, data...)
+	corrupt[len(nativeMagic)+20]++
+	r = io.Reader(bytes.NewReader(corrupt))
+	if _, err = LoadNative(&r); err == nil {
+		t.Error("Expected error reading corrupt data")
+	}
+	r = io.Reader(bytes.NewReader(data[:len(data)/2]))
+	if _, err = LoadNative(&r); err == nil {
+		t.Error("Expected error reading truncated data")
+	}
+}
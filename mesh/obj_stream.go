@@ -0,0 +1,508 @@
+package mesh
+
+import (
+	"bufio"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+// A corner of an OBJ face statement, as zero based indices into the vertex,
+// texture coordinate and normal lists, or -1 where no index was given.
+type OBJCorner struct {
+	V, VT, VN int
+}
+
+// Callbacks for the statements of an OBJ file, as read by ReadOBJStream. Any
+// of them may be nil, and returning an error from one stops reading.
+type OBJHandler struct {
+	// Called with the zero based index and position of each vertex.
+	Vertex func(i int, position geom.Vec3) error
+	// Called with the zero based index of each texture coordinate, with any
+	// missing components zero.
+	TexCoord func(i int, vt geom.Vec3) error
+	// Called with the zero based index of each vertex normal.
+	Normal func(i int, n geom.Vec3) error
+	// Called with the corners of each face, which isn't triangulated, and the
+	// object, group and material in effect when it was declared. Negative
+	// indices are resolved, but may reference elements declared later in the
+	// file.
+	Face func(corners []OBJCorner, group FaceGroup) error
+	// Called when an o, g or usemtl statement changes the face group.
+	Group func(group FaceGroup) error
+	// Called with the files named by each mtllib statement.
+	MaterialLibrary func(files []string) error
+	// Called with the words of each valid statement which has no callback of
+	// its own, such as smoothing groups, points, lines and free-form geometry.
+	Other func(words []string) error
+}
+
+// Read an OBJ file statement by statement, calling the handler's callbacks as
+// each is parsed, so that files can be processed without holding them in
+// memory. Lines ending with a backslash are joined onto the following line and
+// comments are discarded. Malformed statements produce a *ParseError, or are
+// skipped if parsing is lenient. The indices of skipped vertices, texture
+// coordinates and normals aren't passed to any callback, and faces which
+// reference them are skipped too, so that other faces keep their elements.
+func ReadOBJStream(obj_reader io.Reader, handler OBJHandler, opts ...ParseOptions) (err error) {
+	options := ParseOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	var (
+		line  string
+		words []string
+	)
+	line_no := 0
+	vertex_count, tex_coord_count, normal_count := 0, 0, 0
+	// the sorted indices of malformed elements skipped by a lenient read
+	skipped_vertices, skipped_tex_coords, skipped_normals := []int{}, []int{}, []int{}
+	skipped := func(indices []int, i int) bool {
+		j := sort.SearchInts(indices, i)
+		return j < len(indices) && indices[j] == i
+	}
+	current_group := FaceGroup{}
+
+	scanner := bufio.NewScanner(obj_reader)
+	for scanner.Scan() {
+		line_no++
+		statement_line_no := line_no
+		// trim leading and trailing whitespace
+		raw_line := scanner.Text()
+		line = strings.TrimSpace(raw_line)
+		// join lines ending with a backslash onto the following line
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			line_no++
+			line = line[:len(line)-1] + " " + strings.TrimSpace(scanner.Text())
+		}
+		// firstly discard anything on this line after a #
+		if comment_start := strings.Index(line, "#"); comment_start >= 0 {
+			line = line[:comment_start]
+		}
+		// ignore empty lines
+		if len(line) == 0 {
+			continue
+		}
+		words = strings.Fields(line)
+		parseError := func(token string, cause error) error {
+			return newTokenError("OBJ", statement_line_no, raw_line, token, cause)
+		}
+		switch words[0] {
+		case "v":
+			// read in a vertex, ignoring any w or color components
+			if len(words) < 4 {
+				err = parseError(words[0], errors.New("vertex needs three coordinates"))
+				skipped_vertices = append(skipped_vertices, vertex_count)
+				vertex_count++
+				break
+			}
+			floats, parseErr := parse3Floats(words[1:4])
+			if parseErr != nil {
+				err = parseError("", parseErr)
+				skipped_vertices = append(skipped_vertices, vertex_count)
+				vertex_count++
+				break
+			}
+			if handler.Vertex != nil {
+				err = handler.Vertex(vertex_count, geom.Vec3{floats[0], floats[1], floats[2]})
+			}
+			vertex_count++
+		case "vt":
+			// read in a texture coordinate with one to three components
+			if len(words) < 2 || len(words) > 4 {
+				err = parseError(words[0],
+					errors.New("texture coordinate needs one to three components"))
+				skipped_tex_coords = append(skipped_tex_coords, tex_coord_count)
+				tex_coord_count++
+				break
+			}
+			components := [3]float64{}
+			for i, word := range words[1:] {
+				var parseErr error
+				components[i], parseErr = strconv.ParseFloat(word, 64)
+				if parseErr != nil {
+					err = parseError("", parseErr)
+					break
+				}
+			}
+			if err != nil {
+				skipped_tex_coords = append(skipped_tex_coords, tex_coord_count)
+				tex_coord_count++
+				break
+			}
+			if handler.TexCoord != nil {
+				err = handler.TexCoord(tex_coord_count,
+					geom.Vec3{components[0], components[1], components[2]})
+			}
+			tex_coord_count++
+		case "vn":
+			// read in a vertex normal
+			if len(words) != 4 {
+				err = parseError(words[0], errors.New("normal needs three components"))
+				skipped_normals = append(skipped_normals, normal_count)
+				normal_count++
+				break
+			}
+			floats, parseErr := parse3Floats(words[1:])
+			if parseErr != nil {
+				err = parseError("", parseErr)
+				skipped_normals = append(skipped_normals, normal_count)
+				normal_count++
+				break
+			}
+			if handler.Normal != nil {
+				err = handler.Normal(normal_count, geom.Vec3{floats[0], floats[1], floats[2]})
+			}
+			normal_count++
+		case "f":
+			if len(words) < 4 {
+				err = parseError(words[0], errors.New("face needs at least three corners"))
+				break
+			}
+			corners := make([]OBJCorner, len(words)-1)
+			for i, word := range words[1:] {
+				var parseErr error
+				corners[i], parseErr = parseOBJCorner(word, vertex_count,
+					tex_coord_count, normal_count)
+				if parseErr == nil && (skipped(skipped_vertices, corners[i].V) ||
+					skipped(skipped_tex_coords, corners[i].VT) ||
+					skipped(skipped_normals, corners[i].VN)) {
+					parseErr = errors.New("face references a skipped element")
+				}
+				if parseErr != nil {
+					err = parseError(word, parseErr)
+					break
+				}
+			}
+			if err == nil && handler.Face != nil {
+				err = handler.Face(corners, current_group)
+			}
+		case "o", "g", "usemtl":
+			name := strings.Join(words[1:], " ")
+			switch words[0] {
+			case "o":
+				current_group.Object = name
+			case "g":
+				current_group.Group = name
+			case "usemtl":
+				if len(words) < 2 {
+					err = parseError(words[0], errors.New("missing material name"))
+					break
+				}
+				current_group.Material = name
+			}
+			if err == nil && handler.Group != nil {
+				err = handler.Group(current_group)
+			}
+		case "mtllib":
+			if handler.MaterialLibrary != nil {
+				err = handler.MaterialLibrary(words[1:])
+			}
+		case "vp", "s", "mg", "usemap", "maplib",
+			"p", "l", "cstype", "deg", "bmat", "step", "curv", "curv2", "surf",
+			"parm", "trim", "hole", "scrv", "sp", "end", "con", "lod", "bevel",
+			"c_interp", "d_interp", "trace_obj", "shadow_obj", "ctech", "stech":
+			// valid statements with no representation in a Mesh
+			if handler.Other != nil {
+				err = handler.Other(words)
+			}
+		default:
+			err = parseError(words[0], errors.New("unknown statement"))
+		}
+		if err != nil {
+			if err = options.tolerate(err); err != nil {
+				return
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Parses a face corner of the form v, v/vt, v//vn or v/vt/vn into zero based
+// indices, resolving negative indices relative to the number of elements of
+// each kind read so far.
+func parseOBJCorner(word string, v_count, vt_count, vn_count int) (corner OBJCorner, err error) {
+	parts := strings.Split(word, "/")
+	if len(parts) > 3 {
+		err = errors.New("Too many components in face corner: " + word)
+		return
+	}
+	corner = OBJCorner{-1, -1, -1}
+	counts := [3]int{v_count, vt_count, vn_count}
+	indices := [3]*int{&corner.V, &corner.VT, &corner.VN}
+	for i, part := range parts {
+		if len(part) == 0 {
+			if i == 0 {
+				err = errors.New("Missing vertex index in face corner: " + word)
+				return
+			}
+			continue
+		}
+		var index int
+		index, err = strconv.Atoi(part)
+		if err != nil {
+			return
+		}
+		if index > 0 {
+			*indices[i] = index - 1
+		} else if index < 0 && counts[i]+index >= 0 {
+			*indices[i] = counts[i] + index
+		} else {
+			err = errors.New("Invalid index in face corner: " + word)
+			return
+		}
+	}
+	return
+}
+
+// Writes OBJ statements one at a time through a buffer, so that files can be
+// written without holding a whole Mesh in memory. Call Flush once everything
+// has been written. After an error every method returns that error without
+// writing anything further.
+type OBJWriter struct {
+	w             *bufio.Writer
+	options       OBJOptions
+	current_group FaceGroup
+	err           error
+}
+
+// Creates an OBJWriter, which formats floats according to the Precision of any
+// options given.
+func NewOBJWriter(obj_writer io.Writer, opts ...OBJOptions) *OBJWriter {
+	w := &OBJWriter{w: bufio.NewWriter(obj_writer)}
+	if len(opts) > 0 {
+		w.options = opts[0]
+	}
+	return w
+}
+
+func (w *OBJWriter) write(statement string) error {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(statement)
+	}
+	return w.err
+}
+
+func (w *OBJWriter) formatFloats(values ...float64) string {
+	precision := -1
+	if w.options.Precision > 0 {
+		precision = w.options.Precision
+	}
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = strconv.FormatFloat(value, 'f', precision, 64)
+	}
+	return strings.Join(formatted, " ")
+}
+
+func (w *OBJWriter) WriteMaterialLibrary(files ...string) error {
+	return w.write("mtllib " + strings.Join(files, " ") + "\n")
+}
+
+func (w *OBJWriter) WriteVertex(x, y, z float64) error {
+	return w.write("v " + w.formatFloats(x, y, z) + "\n")
+}
+
+// Writes a texture coordinate, omitting the third component if it's zero.
+func (w *OBJWriter) WriteTexCoord(vt geom.Vec3) error {
+	if vt.Z == 0 {
+		return w.write("vt " + w.formatFloats(vt.X, vt.Y) + "\n")
+	}
+	return w.write("vt " + w.formatFloats(vt.X, vt.Y, vt.Z) + "\n")
+}
+
+func (w *OBJWriter) WriteNormal(x, y, z float64) error {
+	return w.write("vn " + w.formatFloats(x, y, z) + "\n")
+}
+
+// Writes a face with the given zero based corners, preceded by o, g and usemtl
+// statements for any change from the group of the previous face.
+func (w *OBJWriter) WriteFace(group FaceGroup, corners ...OBJCorner) error {
+	statement := ""
+	if group.Object != w.current_group.Object {
+		statement += "o " + group.Object + "\n"
+	}
+	if group.Group != w.current_group.Group {
+		statement += "g " + group.Group + "\n"
+	}
+	if group.Material != w.current_group.Material {
+		statement += "usemtl " + group.Material + "\n"
+	}
+	w.current_group = group
+
+	statement += "f"
+	for _, corner := range corners {
+		statement += " " + strconv.Itoa(corner.V+1)
+		if corner.VT >= 0 {
+			statement += "/" + strconv.Itoa(corner.VT+1)
+		} else if corner.VN >= 0 {
+			statement += "/"
+		}
+		if corner.VN >= 0 {
+			statement += "/" + strconv.Itoa(corner.VN+1)
+		}
+	}
+	return w.write(statement + "\n")
+}
+
+// Writes any other statement verbatim.
+func (w *OBJWriter) WriteStatement(words ...string) error {
+	return w.write(strings.Join(words, " ") + "\n")
+}
+
+func (w *OBJWriter) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+// Options controlling how ProcessOBJ groups statements into chunks.
+type OBJProcessOptions struct {
+	// The largest number of vertices or normals in a chunk. Defaults to 65536.
+	ChunkSize int
+}
+
+// A run of consecutive vertices or normals from an OBJ file being processed by
+// ProcessOBJ. Only one of Vertices and Normals is populated.
+type OBJChunk struct {
+	// The zero based index in the file of the first vertex or normal.
+	Offset int
+	// Vertices may be moved, or set to nil to remove them from the file along
+	// with any faces which use them.
+	Vertices []VertexI
+	// Normals may be modified in place.
+	Normals []*geom.Vec3
+}
+
+// Streams an OBJ file from obj_reader to obj_writer, passing vertices and
+// normals through the process callback in chunks, so that transformations and
+// filters can be applied to files too large to load as a Mesh. Vertices which
+// are removed are dropped along with the faces which use them, and the
+// indices of following vertices are adjusted. Only the removed vertex indices
+// are held in memory, and face corners are written with positive indices.
+// Group statements are written just before the faces they apply to, and
+// comments and line continuations are not preserved.
+func ProcessOBJ(obj_reader io.Reader, obj_writer io.Writer, process func(chunk *OBJChunk) error, opts ...OBJProcessOptions) (err error) {
+	options := OBJProcessOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = 65536
+	}
+
+	w := NewOBJWriter(obj_writer)
+	chunk := &OBJChunk{}
+	vertex_count, normal_count := 0, 0
+	// the sorted indices of removed vertices
+	removed := []int{}
+
+	flush := func() error {
+		if len(chunk.Vertices) == 0 && len(chunk.Normals) == 0 {
+			return nil
+		}
+		if err := process(chunk); err != nil {
+			return err
+		}
+		for i, v := range chunk.Vertices {
+			if v == nil {
+				removed = append(removed, chunk.Offset+i)
+			} else {
+				w.WriteVertex(v.GetX(), v.GetY(), v.GetZ())
+			}
+		}
+		for _, n := range chunk.Normals {
+			w.WriteNormal(n.X, n.Y, n.Z)
+		}
+		chunk.Vertices = chunk.Vertices[:0]
+		chunk.Normals = chunk.Normals[:0]
+		return w.err
+	}
+
+	err = ReadOBJStream(obj_reader, OBJHandler{
+		Vertex: func(i int, position geom.Vec3) error {
+			if len(chunk.Normals) > 0 || len(chunk.Vertices) == options.ChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if len(chunk.Vertices) == 0 {
+				chunk.Offset = i
+			}
+			chunk.Vertices = append(chunk.Vertices, &Vertex{Vec3: position})
+			vertex_count++
+			return nil
+		},
+		Normal: func(i int, n geom.Vec3) error {
+			if len(chunk.Vertices) > 0 || len(chunk.Normals) == options.ChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if len(chunk.Normals) == 0 {
+				chunk.Offset = i
+			}
+			chunk.Normals = append(chunk.Normals, &n)
+			normal_count++
+			return nil
+		},
+		TexCoord: func(i int, vt geom.Vec3) error {
+			if err := flush(); err != nil {
+				return err
+			}
+			return w.WriteTexCoord(vt)
+		},
+		Face: func(corners []OBJCorner, group FaceGroup) error {
+			if err := flush(); err != nil {
+				return err
+			}
+			for i, corner := range corners {
+				if corner.V >= vertex_count || corner.VN >= normal_count {
+					return errors.New("Error processing OBJ file: face references " +
+						"a vertex or normal which hasn't been declared yet")
+				}
+				j := sort.SearchInts(removed, corner.V)
+				if j < len(removed) && removed[j] == corner.V {
+					return nil
+				}
+				corners[i].V -= j
+			}
+			return w.WriteFace(group, corners...)
+		},
+		MaterialLibrary: func(files []string) error {
+			if err := flush(); err != nil {
+				return err
+			}
+			return w.WriteMaterialLibrary(files...)
+		},
+		Other: func(words []string) error {
+			if err := flush(); err != nil {
+				return err
+			}
+			return w.WriteStatement(words...)
+		},
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	return
+}
+
+// Applies the given transformation to every vertex of an OBJ file, streaming
+// it from obj_reader to obj_writer with ProcessOBJ. As with Mesh.Transform,
+// normals are left unchanged.
+func TransformOBJ(obj_reader io.Reader, obj_writer io.Writer, t tr.Transformation) error {
+	return ProcessOBJ(obj_reader, obj_writer, func(chunk *OBJChunk) error {
+		t.ApplyToVec3(ConvertVertexSliceToVec3ISlice(chunk.Vertices)...)
+		return nil
+	})
+}
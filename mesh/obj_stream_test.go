@@ -0,0 +1,144 @@
+package mesh
+
+import (
+	"bytes"
+	"github.com/nat-n/geom"
+	"io"
+	"strings"
+	"testing"
+)
+
+import tr "github.com/nat-n/gomesh/transformation"
+
+const streamTestOBJ = `mtllib scene.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 5 5 5
+vn 0 0 1
+vt 0 0
+o Plane
+usemtl Material
+s off
+f 1//1 2//1 3//1 4//1
+f -4 -3 -1
+`
+
+// Tests for ReadOBJStream
+
+func TestReadOBJStream(t *testing.T) {
+	counts := make(map[string]int)
+	faces := [][]OBJCorner{}
+	groups := []FaceGroup{}
+	err := ReadOBJStream(strings.NewReader(streamTestOBJ), OBJHandler{
+		Vertex:   func(i int, position geom.Vec3) error { counts["v"]++; return nil },
+		TexCoord: func(i int, vt geom.Vec3) error { counts["vt"]++; return nil },
+		Normal:   func(i int, n geom.Vec3) error { counts["vn"]++; return nil },
+		Face: func(corners []OBJCorner, group FaceGroup) error {
+			faces = append(faces, corners)
+			groups = append(groups, group)
+			return nil
+		},
+		MaterialLibrary: func(files []string) error { counts["mtllib"]++; return nil },
+		Other:           func(words []string) error { counts[words[0]]++; return nil },
+	})
+	if err != nil {
+		t.Error("Expected no error, got", err)
+		return
+	}
+	expected := map[string]int{"v": 5, "vt": 1, "vn": 1, "mtllib": 1, "s": 1}
+	for key, count := range expected {
+		if counts[key] != count {
+			t.Error("For", key, "expected", count, "got", counts[key])
+		}
+	}
+	if len(faces) != 2 || len(faces[0]) != 4 {
+		t.Error("Expected an untriangulated quad and a triangle, got", faces)
+		return
+	}
+	if faces[0][3] != (OBJCorner{3, -1, 0}) || faces[1][0] != (OBJCorner{1, -1, -1}) {
+		t.Error("Expected resolved corners, got", faces)
+	}
+	if groups[1] != (FaceGroup{Object: "Plane", Material: "Material"}) {
+		t.Error("Expected face group, got", groups[1])
+	}
+}
+
+// Tests for ProcessOBJ
+
+func TestProcessOBJ(t *testing.T) {
+	output := bytes.Buffer{}
+	chunks := 0
+	err := ProcessOBJ(strings.NewReader(streamTestOBJ), &output,
+		func(chunk *OBJChunk) error {
+			chunks++
+			for i, v := range chunk.Vertices {
+				// drop the first vertex, and so the quad using it
+				if chunk.Offset+i == 0 {
+					chunk.Vertices[i] = nil
+				} else {
+					v.SetX(v.GetX() * 2)
+				}
+			}
+			return nil
+		}, OBJProcessOptions{ChunkSize: 2})
+	if err != nil {
+		t.Error("Expected no error, got", err)
+		return
+	}
+	expected := `mtllib scene.mtl
+v 2 0 0
+v 2 1 0
+v 0 1 0
+v 10 5 5
+vn 0 0 1
+vt 0 0
+s off
+o Plane
+usemtl Material
+f 1 2 4
+`
+	if output.String() != expected {
+		t.Error("Expected", expected, "got", output.String())
+	}
+	// three vertex chunks and one normal chunk
+	if chunks != 4 {
+		t.Error("Expected 4 chunks, got", chunks)
+	}
+
+	r := io.Reader(strings.NewReader(output.String()))
+	m, err := LoadOBJ(&r)
+	if err != nil || m.Vertices.Len() != 4 || m.Faces.Len() != 1 {
+		t.Error("Expected processed output to load")
+	}
+}
+
+func TestTransformOBJ(t *testing.T) {
+	output := bytes.Buffer{}
+	err := TransformOBJ(strings.NewReader("v 1 2 3\nv 0 0 0\nf 1 2 1\n"), &output,
+		tr.Translation(1, 0, -1))
+	expected := "v 2 2 2\nv 1 0 -1\nf 1 2 1\n"
+	if err != nil || output.String() != expected {
+		t.Error("Expected", expected, "got", output.String(), err)
+	}
+}
+
+// Tests for OBJWriter
+
+func TestOBJWriter(t *testing.T) {
+	output := bytes.Buffer{}
+	w := NewOBJWriter(&output)
+	w.WriteVertex(0.5, 0, -1)
+	w.WriteTexCoord(geom.Vec3{0.25, 1, 0})
+	w.WriteNormal(0, 0, 1)
+	w.WriteFace(FaceGroup{Group: "g1"},
+		OBJCorner{0, -1, -1}, OBJCorner{0, 0, -1}, OBJCorner{0, -1, 0}, OBJCorner{0, 0, 0})
+	if err := w.Flush(); err != nil {
+		t.Error("Expected no error, got", err)
+	}
+	expected := "v 0.5 0 -1\nvt 0.25 1\nvn 0 0 1\ng g1\nf 1 1/1 1//1 1/1/1\n"
+	if output.String() != expected {
+		t.Error("Expected", expected, "got", output.String())
+	}
+}
@@ -0,0 +1,315 @@
+package mesh
+
+import (
+	"bufio"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The optional prefixes of an OFF header keyword, in the order they appear,
+// e.g. "STCNOFF" for vertices with tex coords, colors and normals.
+type offHeader struct {
+	TexCoords bool // ST
+	Colors    bool // C
+	Normals   bool // N
+}
+
+// Parses the header keyword of an OFF file, returning any counts which follow
+// it on the same line.
+func parseOFFHeader(words []string) (header offHeader, rest []string, ok bool) {
+	if len(words) == 0 {
+		return
+	}
+	keyword := words[0]
+	if strings.HasPrefix(keyword, "ST") {
+		header.TexCoords = true
+		keyword = keyword[2:]
+	}
+	if strings.HasPrefix(keyword, "C") {
+		header.Colors = true
+		keyword = keyword[1:]
+	}
+	if strings.HasPrefix(keyword, "N") {
+		header.Normals = true
+		keyword = keyword[1:]
+	}
+	if !strings.HasPrefix(keyword, "OFF") {
+		return
+	}
+	// some datasets (ModelNet) omit the newline between keyword and counts
+	rest = words[1:]
+	if counts := keyword[3:]; counts != "" {
+		if _, err := strconv.Atoi(counts); err != nil {
+			return
+		}
+		rest = append([]string{counts}, rest...)
+	}
+	ok = true
+	return
+}
+
+// Parses an OFF color component, which is in the range 0..255 if written as an
+// integer and 0..1 otherwise.
+func parseOFFColor(word string) (float64, error) {
+	if i, err := strconv.Atoi(word); err == nil {
+		return float64(i) / 255, nil
+	}
+	return strconv.ParseFloat(word, 64)
+}
+
+// Read a new mesh from an OFF file, including the COFF (vertex colors), NOFF
+// (vertex normals) and STOFF (vertex tex coords) variants and combinations of
+// them. Polygonal faces are triangulated as a fan, and face colors are ignored.
+// The 4OFF and nOFF variants for other dimensions aren't supported.
+func LoadOFF(off_reader *io.Reader) (m *Mesh, err error) {
+	line_no := 0
+	scanner := bufio.NewScanner(*off_reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	// Returns the words of the next line which isn't blank or a comment.
+	nextWords := func() ([]string, bool) {
+		for scanner.Scan() {
+			line_no++
+			line := scanner.Text()
+			if comment_start := strings.Index(line, "#"); comment_start >= 0 {
+				line = line[:comment_start]
+			}
+			if words := strings.Fields(line); len(words) > 0 {
+				return words, true
+			}
+		}
+		return nil, false
+	}
+	unexpectedEnd := func() error {
+		if scanErr := scanner.Err(); scanErr != nil {
+			return scanErr
+		}
+		return &ParseError{Format: "OFF", Line: line_no, Err: io.ErrUnexpectedEOF}
+	}
+
+	words, found := nextWords()
+	if !found {
+		err = unexpectedEnd()
+		return
+	}
+	header, counts, ok := parseOFFHeader(words)
+	if !ok {
+		err = errors.New("Error parsing OFF file: missing OFF header")
+		return
+	}
+	if len(counts) == 0 {
+		if counts, found = nextWords(); !found {
+			err = unexpectedEnd()
+			return
+		}
+	}
+	if len(counts) < 2 {
+		err = newParseError("OFF", line_no)
+		return
+	}
+	vertex_count, vErr := strconv.Atoi(counts[0])
+	face_count, fErr := strconv.Atoi(counts[1])
+	if vErr != nil || fErr != nil || vertex_count < 0 || face_count < 0 {
+		err = newParseError("OFF", line_no)
+		return
+	}
+
+	min_words := 3
+	if header.Normals {
+		min_words += 3
+	}
+	if header.TexCoords {
+		min_words += 2
+	}
+	if header.Colors {
+		min_words += 3
+	}
+	// the counts are checked so a corrupt header can't exhaust memory
+	if _, valid := readValueCount(vertex_count, min_words); !valid {
+		err = newParseError("OFF", line_no)
+		return
+	}
+
+	m = New("")
+	vertices := make([]VertexI, 0, readChunkSize(vertex_count))
+	var tex_coords []*geom.Vec3
+	if header.TexCoords {
+		tex_coords = make([]*geom.Vec3, 0, readChunkSize(vertex_count))
+	}
+	for i := 0; i < vertex_count; i++ {
+		if words, found = nextWords(); !found {
+			err = unexpectedEnd()
+			return
+		}
+		if len(words) < min_words {
+			err = newParseError("OFF", line_no)
+			return
+		}
+		position, parseErr := parse3Floats(words[0:3])
+		if parseErr != nil {
+			err = newParseError("OFF", line_no)
+			return
+		}
+		v := m.AddVertex(position[0], position[1], position[2])
+		vertices = append(vertices, v)
+		words = words[3:]
+
+		if header.Normals {
+			normal, parseErr := parse3Floats(words[0:3])
+			if parseErr != nil {
+				err = newParseError("OFF", line_no)
+				return
+			}
+			v.SetNormal(&geom.Vec3{normal[0], normal[1], normal[2]})
+			words = words[3:]
+		}
+		if header.Colors {
+			// colors have 3 or 4 components, so tex coords are the last two words
+			color_words := words
+			if header.TexCoords {
+				color_words = words[:len(words)-2]
+			}
+			if len(color_words) != 3 && len(color_words) != 4 {
+				err = newParseError("OFF", line_no)
+				return
+			}
+			color := Color{1, 1, 1, 1}
+			for j, word := range color_words {
+				if color[j], parseErr = parseOFFColor(word); parseErr != nil {
+					err = newParseError("OFF", line_no)
+					return
+				}
+			}
+			v.SetColor(&color)
+			words = words[len(color_words):]
+		}
+		if header.TexCoords {
+			s, sErr := strconv.ParseFloat(words[0], 64)
+			t, tErr := strconv.ParseFloat(words[1], 64)
+			if sErr != nil || tErr != nil {
+				err = newParseError("OFF", line_no)
+				return
+			}
+			tex_coords = append(tex_coords, &geom.Vec3{s, t, 0})
+		}
+	}
+
+	for i := 0; i < face_count; i++ {
+		if words, found = nextWords(); !found {
+			err = unexpectedEnd()
+			return
+		}
+		corner_count, parseErr := strconv.Atoi(words[0])
+		if parseErr != nil || corner_count < 3 || len(words) < corner_count+1 {
+			err = newParseError("OFF", line_no)
+			return
+		}
+		indices := make([]int, corner_count)
+		for j := range indices {
+			indices[j], parseErr = strconv.Atoi(words[j+1])
+			if parseErr != nil || indices[j] < 0 || indices[j] >= vertex_count {
+				err = newParseError("OFF", line_no)
+				return
+			}
+		}
+		for j := 2; j < corner_count; j++ {
+			corners := [3]int{indices[0], indices[j-1], indices[j]}
+			f := m.AddFace(vertices[corners[0]], vertices[corners[1]],
+				vertices[corners[2]])
+			if header.TexCoords {
+				f.SetTexCoords([3]*geom.Vec3{tex_coords[corners[0]],
+					tex_coords[corners[1]], tex_coords[corners[2]]})
+			}
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+func ReadOFFFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	off_reader := io.Reader(input_file)
+	m, err = LoadOFF(&off_reader)
+	return
+}
+
+// Write mesh as OFF, with a COFF, NOFF or CNOFF header if it has vertex colors
+// or normals. Normals are written if every vertex has one, colors if any vertex
+// has one, as integers in the range 0..255.
+func (m *Mesh) WriteOFF(off_writer io.Writer) (err error) {
+	has_normals := m.Vertices.Len() > 0
+	has_colors := false
+	m.Vertices.Each(func(v VertexI) {
+		has_normals = has_normals && v.GetNormal() != nil
+		has_colors = has_colors || v.GetColor() != nil
+	})
+	keyword := "OFF"
+	if has_normals {
+		keyword = "N" + keyword
+	}
+	if has_colors {
+		keyword = "C" + keyword
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	buffered := bufio.NewWriter(off_writer)
+	buffered.WriteString(keyword + "\n")
+	if m.Name != "" {
+		buffered.WriteString("# " + m.Name + "\n")
+	}
+	buffered.WriteString(strconv.Itoa(m.Vertices.Len()) + " " +
+		strconv.Itoa(m.Faces.Len()) + " 0\n")
+
+	// track where vertices were written
+	vert_lookup := make(map[VertexI]int)
+	m.Vertices.EachWithIndex(func(i int, v VertexI) {
+		vert_lookup[v] = i
+		line := formatFloat(v.GetX()) + " " + formatFloat(v.GetY()) + " " +
+			formatFloat(v.GetZ())
+		if has_normals {
+			n := v.GetNormal()
+			line += " " + formatFloat(n.GetX()) + " " + formatFloat(n.GetY()) +
+				" " + formatFloat(n.GetZ())
+		}
+		if has_colors {
+			c := v.GetColor()
+			if c == nil {
+				c = &Color{1, 1, 1, 1}
+			}
+			for _, component := range c {
+				line += " " + strconv.Itoa(
+					int(math.Floor(math.Max(0, math.Min(1, component))*255+0.5)))
+			}
+		}
+		buffered.WriteString(line + "\n")
+	})
+
+	m.Faces.Each(func(f FaceI) {
+		buffered.WriteString("3 " + strconv.Itoa(vert_lookup[f.GetA()]) + " " +
+			strconv.Itoa(vert_lookup[f.GetB()]) + " " +
+			strconv.Itoa(vert_lookup[f.GetC()]) + "\n")
+	})
+	err = buffered.Flush()
+	return
+}
+
+func (m *Mesh) WriteOFFFile(output_path string) (err error) {
+	err = writeFile(output_path, m.WriteOFF)
+	return
+}
+
+func sniffOFF(header []byte) bool {
+	_, _, ok := parseOFFHeader(strings.Fields(string(firstStatement(header, "#"))))
+	return ok
+}
@@ -0,0 +1,134 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Tests for LoadOFF and WriteOFF
+
+type offTestParams struct {
+	off       string
+	vertices  int
+	faces     int
+	normal    *geom.Vec3
+	color     *Color
+	tex_coord *geom.Vec3
+}
+
+var offTests = []offTestParams{
+	{
+		"OFF\n# a quad\n4 1 0\n0 0 0\n1 0 0\n1 1 0\n0 1 0\n4 0 1 2 3\n",
+		4, 2, nil, nil, nil,
+	},
+	{
+		"OFF 3 1 0\n0 0 0\n1 0 0\n1 1 0\n3 0 1 2 255 0 0\n",
+		3, 1, nil, nil, nil,
+	},
+	{
+		"OFF3 1 0\n0 0 0\n1 0 0\n1 1 0\n3 0 1 2\n",
+		3, 1, nil, nil, nil,
+	},
+	{
+		"COFF\n3 1 0\n0 0 0 255 0 0 255\n1 0 0 0 255 0 255\n" +
+			"1 1 0 0 0 255 255\n3 0 1 2\n",
+		3, 1, nil, &Color{0, 1, 0, 1}, nil,
+	},
+	{
+		"NOFF\n3 1 0\n0 0 0 0 0 1\n1 0 0 0 0 1\n1 1 0 0 0 1\n3 0 1 2\n",
+		3, 1, &geom.Vec3{0, 0, 1}, nil, nil,
+	},
+	{
+		"STCNOFF\n3 1 0\n0 0 0 0 0 1 1 0 0 0 0\n1 0 0 0 0 1 0.0 1.0 0.0 1 0\n" +
+			"1 1 0 0 0 1 0 0 1 1 1\n3 0 1 2\n",
+		3, 1, &geom.Vec3{0, 0, 1}, &Color{0, 1, 0, 1}, &geom.Vec3{1, 0, 0},
+	},
+}
+
+func TestLoadOFF(t *testing.T) {
+	for _, params := range offTests {
+		r := io.Reader(strings.NewReader(params.off))
+		m, err := LoadOFF(&r)
+		if err != nil {
+			t.Error("For", params.off, "expected no error, got", err)
+			continue
+		}
+		if m.Vertices.Len() != params.vertices || m.Faces.Len() != params.faces {
+			t.Error("For", params.off, "expected", params.vertices, "vertices and",
+				params.faces, "faces, got", m.Vertices.Len(), m.Faces.Len())
+			continue
+		}
+		v := m.Vertices.Get(1)[0]
+		if (params.normal == nil) != (v.GetNormal() == nil) ||
+			(params.normal != nil && *params.normal != *v.GetNormal()) {
+			t.Error("For", params.off, "expected normal", params.normal, "got",
+				v.GetNormal())
+		}
+		if (params.color == nil) != (v.GetColor() == nil) ||
+			(params.color != nil && *params.color != *v.GetColor()) {
+			t.Error("For", params.off, "expected color", params.color, "got",
+				v.GetColor())
+		}
+		vt := m.Faces.Get(0)[0].GetTexCoords()[1]
+		if (params.tex_coord == nil) != (vt == nil) ||
+			(params.tex_coord != nil && *params.tex_coord != *vt) {
+			t.Error("For", params.off, "expected tex coord", params.tex_coord,
+				"got", vt)
+		}
+
+		// writing and reading back should preserve normals and colors
+		buf := new(bytes.Buffer)
+		if err = m.WriteOFF(buf); err != nil {
+			t.Error("For", params.off, "expected no error writing, got", err)
+			continue
+		}
+		r = io.Reader(buf)
+		m2, err := LoadOFF(&r)
+		if err != nil {
+			t.Error("For", params.off, "expected no error reading back, got", err)
+			continue
+		}
+		v2 := m2.Vertices.Get(1)[0]
+		if m2.Faces.Len() != params.faces || v2.GetX() != v.GetX() ||
+			(params.normal != nil && *v2.GetNormal() != *params.normal) ||
+			(params.color != nil && *v2.GetColor() != *params.color) {
+			t.Error("For", params.off, "expected round trip to preserve mesh")
+		}
+	}
+}
+
+func TestLoadOFFErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"PLY\n3 1 0\n",
+		"OFF\n3 1 0\n0 0 0\n1 0 0\n",
+		"OFF\n3 1 0\n0 0 0\n1 0 0\n1 1 0\n3 0 1 3\n",
+		"OFF\n3 1 0\n0 0 0\n1 0 0\n1 1 0\n4 0 1 2\n",
+		"COFF\n1 0 0\n0 0 0\n",
+	}
+	for _, off := range invalid {
+		r := io.Reader(strings.NewReader(off))
+		if _, err := LoadOFF(&r); err == nil {
+			t.Error("For", off, "expected an error")
+		}
+	}
+}
+
+func TestLoadOFFHugeCounts(t *testing.T) {
+	for _, off := range []string{
+		"OFF\n1099511627776 0 0\n",
+		"STOFF\n1099511627776 0 0\n0 0 0 0 0\n",
+		"OFF\n10000000 0 0\n0 0 0\n",
+	} {
+		r := io.Reader(strings.NewReader(off))
+		_, err := LoadOFF(&r)
+		var parse_err *ParseError
+		if !errors.As(err, &parse_err) {
+			t.Error("For", off, "expected a ParseError, got", err)
+		}
+	}
+}
@@ -0,0 +1,732 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The encodings of the body of a PLY file.
+type PLYFormat int
+
+const (
+	PLYASCII PLYFormat = iota
+	PLYBinaryLittleEndian
+	PLYBinaryBigEndian
+)
+
+var plyFormatNames = map[PLYFormat]string{
+	PLYASCII:              "ascii",
+	PLYBinaryLittleEndian: "binary_little_endian",
+	PLYBinaryBigEndian:    "binary_big_endian",
+}
+
+// Options controlling how PLY files are written.
+type PLYOptions struct {
+	Format PLYFormat
+}
+
+type plyProperty struct {
+	Name      string
+	Type      string
+	IsList    bool
+	CountType string
+}
+
+type plyElement struct {
+	Name       string
+	Count      int
+	Properties []plyProperty
+}
+
+// The size in bytes of each PLY scalar type, and the value which represents
+// full intensity when the type is used for a color component.
+var plyTypeSizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+var plyColorScales = map[string]float64{
+	"char": 127, "int8": 127, "uchar": 255, "uint8": 255,
+	"short": 32767, "int16": 32767, "ushort": 65535, "uint16": 65535,
+	"int": 2147483647, "int32": 2147483647,
+	"uint": 4294967295, "uint32": 4294967295,
+	"float": 1, "float32": 1, "double": 1, "float64": 1,
+}
+
+// Reads scalar values from the body of a PLY file.
+type plyValueReader interface {
+	Read(ply_type string) (float64, error)
+}
+
+type plyASCIIReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *plyASCIIReader) Read(ply_type string) (float64, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	return strconv.ParseFloat(r.scanner.Text(), 64)
+}
+
+type plyBinaryReader struct {
+	reader io.Reader
+	order  binary.ByteOrder
+	buffer [8]byte
+}
+
+func (r *plyBinaryReader) Read(ply_type string) (value float64, err error) {
+	size, known := plyTypeSizes[ply_type]
+	if !known {
+		err = errors.New("Unknown PLY property type: " + ply_type)
+		return
+	}
+	b := r.buffer[:size]
+	if _, err = io.ReadFull(r.reader, b); err != nil {
+		return
+	}
+	switch ply_type {
+	case "char", "int8":
+		value = float64(int8(b[0]))
+	case "uchar", "uint8":
+		value = float64(b[0])
+	case "short", "int16":
+		value = float64(int16(r.order.Uint16(b)))
+	case "ushort", "uint16":
+		value = float64(r.order.Uint16(b))
+	case "int", "int32":
+		value = float64(int32(r.order.Uint32(b)))
+	case "uint", "uint32":
+		value = float64(r.order.Uint32(b))
+	case "float", "float32":
+		value = float64(math.Float32frombits(r.order.Uint32(b)))
+	case "double", "float64":
+		value = math.Float64frombits(r.order.Uint64(b))
+	}
+	return
+}
+
+// Read a new mesh from an ASCII or binary PLY file.
+// The x, y and z vertex properties give the position of each vertex, nx, ny
+// and nz its normal, red, green, blue and alpha its color, and texture_u and
+// texture_v (or u and v, or s and t) the texture coordinates of the corners of
+// its faces. Faces are read
+// from the vertex_indices (or vertex_index) list, and triangulated as a fan if
+// they have more than three corners. Any other scalar vertex or face
+// properties are kept as attributes of the mesh, and other elements skipped.
+func LoadPLY(ply_reader *io.Reader) (m *Mesh, err error) {
+	buffered := bufio.NewReader(*ply_reader)
+	format, elements, err := readPLYHeader(buffered)
+	if err != nil {
+		return
+	}
+
+	var values plyValueReader
+	switch format {
+	case PLYASCII:
+		scanner := bufio.NewScanner(buffered)
+		scanner.Split(bufio.ScanWords)
+		values = &plyASCIIReader{scanner: scanner}
+	case PLYBinaryLittleEndian:
+		values = &plyBinaryReader{reader: buffered, order: binary.LittleEndian}
+	case PLYBinaryBigEndian:
+		values = &plyBinaryReader{reader: buffered, order: binary.BigEndian}
+	}
+
+	m = New("")
+
+	// Faces are only created once all elements are read, in case faces are
+	// declared before vertices.
+	facesBuffer := make([][]int, 0)
+	faceValuesBuffer := make([][]float64, 0)
+	var faceAttributes []*FaceAttribute
+	var faceAttributeProperties [][]int
+	var tex_coords []*geom.Vec3
+
+	for _, element := range elements {
+		switch element.Name {
+		case "vertex":
+			tex_coords, err = readPLYVertices(m, element, values)
+		case "face":
+			names, properties := []string{}, []int{}
+			for i, property := range element.Properties {
+				if !property.IsList {
+					names = append(names, property.Name)
+					properties = append(properties, i)
+				}
+			}
+			groups, attr_names, types := groupPLYAttributes(element, names, properties)
+			for i, group := range groups {
+				faceAttributes = append(faceAttributes,
+					m.Attributes.AddFaceAttribute(attr_names[i], types[i]))
+				faceAttributeProperties = append(faceAttributeProperties, group)
+			}
+			facesBuffer, faceValuesBuffer, err = readPLYFaces(element, values)
+		default:
+			err = skipPLYElement(element, values)
+		}
+		if _, is_parse_error := err.(*ParseError); err != nil && !is_parse_error {
+			err = errors.New("Error reading PLY " + element.Name +
+				" element: " + err.Error())
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	vertex_count := m.Vertices.Len()
+	for i, indices := range facesBuffer {
+		for _, index := range indices {
+			if index < 0 || index >= vertex_count {
+				err = errors.New("Error reading PLY face element: face " +
+					strconv.Itoa(i) + " references undefined vertex " +
+					strconv.Itoa(index))
+				return
+			}
+		}
+		verts := m.Vertices.Get(indices...)
+		for j := 2; j < len(verts); j++ {
+			f := m.AddFace(verts[0], verts[j-1], verts[j])
+			for k, attr := range faceAttributes {
+				attr.Set(f, plyRowValues(faceValuesBuffer[i], faceAttributeProperties[k])...)
+			}
+		}
+	}
+	if tex_coords != nil {
+		setVertexTexCoords(m.Vertices.GetAll(), tex_coords)
+	}
+	return
+}
+
+func readPLYHeader(r *bufio.Reader) (format PLYFormat, elements []*plyElement, err error) {
+	line_no := 0
+	readLine := func() (string, error) {
+		line_no++
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	line, err := readLine()
+	if err != nil || line != "ply" {
+		err = errors.New("Error parsing PLY file: missing ply magic number")
+		return
+	}
+
+	has_format := false
+	for {
+		line, err = readLine()
+		if err != nil {
+			err = errors.New("Error parsing PLY file: header not terminated")
+			return
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "format":
+			found := false
+			for f, name := range plyFormatNames {
+				if len(words) == 3 && words[1] == name {
+					format = f
+					found = true
+				}
+			}
+			if !found {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			has_format = true
+		case "element":
+			if len(words) != 3 {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			element := &plyElement{Name: words[1]}
+			element.Count, err = strconv.Atoi(words[2])
+			if err != nil || element.Count < 0 {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			elements = append(elements, element)
+		case "property":
+			if len(elements) == 0 {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			element := elements[len(elements)-1]
+			property := plyProperty{}
+			if len(words) == 5 && words[1] == "list" {
+				property = plyProperty{
+					Name: words[4], Type: words[3], IsList: true, CountType: words[2],
+				}
+			} else if len(words) == 3 {
+				property = plyProperty{Name: words[2], Type: words[1]}
+			} else {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			_, known_type := plyTypeSizes[property.Type]
+			_, known_count_type := plyTypeSizes[property.CountType]
+			if !known_type || (property.IsList && !known_count_type) {
+				err = newParseError("PLY", line_no)
+				return
+			}
+			element.Properties = append(element.Properties, property)
+		case "comment", "obj_info":
+			// nothing to do
+		case "end_header":
+			if !has_format {
+				err = errors.New("Error parsing PLY file: missing format")
+			}
+			return
+		default:
+			err = newParseError("PLY", line_no)
+			return
+		}
+	}
+}
+
+// Groups the scalar properties of an element with the given names and indices
+// into typed attributes, with single properties of integer types read as
+// labels. Returns the property indices of each attribute, with its name and
+// type.
+func groupPLYAttributes(element *plyElement, names []string, properties []int) (groups [][]int, attr_names []string, types []AttributeType) {
+	groups, attr_names, types = groupAttributeComponents(names)
+	for i, group := range groups {
+		for j, k := range group {
+			group[j] = properties[k]
+		}
+		if types[i] == ScalarAttribute &&
+			plyColorScales[element.Properties[group[0]].Type] != 1 {
+			types[i] = LabelAttribute
+		}
+	}
+	return
+}
+
+// Returns the values of a row at the given property indices.
+func plyRowValues(row []float64, properties []int) []float64 {
+	values := make([]float64, len(properties))
+	for i, property := range properties {
+		values[i] = row[property]
+	}
+	return values
+}
+
+// Returns the header lines declaring the properties of an attribute, with one
+// property per component.
+func plyAttributeProperties(name string, t AttributeType) (lines string) {
+	ply_type := "float"
+	if t == LabelAttribute {
+		ply_type = "int"
+	}
+	for _, component := range attributeComponentNames(name, t) {
+		lines += "property " + ply_type + " " + component + "\n"
+	}
+	return
+}
+
+// Writes the value of an attribute, as zeros where it has none.
+func writePLYAttribute(w *plyValueWriter, t AttributeType, value []float64) {
+	ply_type := "float"
+	if t == LabelAttribute {
+		ply_type = "int"
+	}
+	for i := 0; i < t.Components(); i++ {
+		component := 0.0
+		if i < len(value) {
+			component = value[i]
+		}
+		w.Write(ply_type, component)
+	}
+}
+
+// Reads the vertices of a vertex element into the mesh, returning the texture
+// coordinates of each if the element has them.
+func readPLYVertices(m *Mesh, element *plyElement, values plyValueReader) (tex_coords []*geom.Vec3, err error) {
+	// locate the properties with dedicated fields on Vertex or Face
+	position := [3]int{-1, -1, -1}
+	normal := [3]int{-1, -1, -1}
+	color := [4]int{-1, -1, -1, -1}
+	tex_coord := [2]int{-1, -1}
+	var attributeNames []string
+	var attributeProperties []int
+	for i, property := range element.Properties {
+		if property.IsList {
+			continue
+		}
+		switch property.Name {
+		case "x":
+			position[0] = i
+		case "y":
+			position[1] = i
+		case "z":
+			position[2] = i
+		case "nx":
+			normal[0] = i
+		case "ny":
+			normal[1] = i
+		case "nz":
+			normal[2] = i
+		case "red", "diffuse_red":
+			color[0] = i
+		case "green", "diffuse_green":
+			color[1] = i
+		case "blue", "diffuse_blue":
+			color[2] = i
+		case "alpha":
+			color[3] = i
+		case "texture_u", "u", "s":
+			tex_coord[0] = i
+		case "texture_v", "v", "t":
+			tex_coord[1] = i
+		default:
+			attributeNames = append(attributeNames, property.Name)
+			attributeProperties = append(attributeProperties, i)
+		}
+	}
+	groups, attr_names, types := groupPLYAttributes(element, attributeNames,
+		attributeProperties)
+	attributes := make([]*VertexAttribute, len(groups))
+	for i := range groups {
+		attributes[i] = m.Attributes.AddVertexAttribute(attr_names[i], types[i])
+	}
+	if position[0] < 0 || position[1] < 0 || position[2] < 0 {
+		err = errors.New("vertex element lacks x, y or z property")
+		return
+	}
+	has_normals := normal[0] >= 0 && normal[1] >= 0 && normal[2] >= 0
+	has_colors := color[0] >= 0 && color[1] >= 0 && color[2] >= 0
+	if tex_coord[0] >= 0 && tex_coord[1] >= 0 {
+		tex_coords = make([]*geom.Vec3, 0, readChunkSize(element.Count))
+	}
+
+	for i := 0; i < element.Count; i++ {
+		var row []float64
+		row, err = readPLYRow(element, values)
+		if err != nil {
+			return
+		}
+		v := m.AddVertex(row[position[0]], row[position[1]], row[position[2]])
+		if has_normals {
+			v.SetNormal(&geom.Vec3{row[normal[0]], row[normal[1]], row[normal[2]]})
+		}
+		if has_colors {
+			c := Color{1, 1, 1, 1}
+			for j, property_index := range color {
+				if property_index >= 0 {
+					c[j] = row[property_index] /
+						plyColorScales[element.Properties[property_index].Type]
+				}
+			}
+			v.SetColor(&c)
+		}
+		if tex_coords != nil {
+			tex_coords = append(tex_coords,
+				&geom.Vec3{row[tex_coord[0]], row[tex_coord[1]], 0})
+		}
+		for j, attr := range attributes {
+			attr.Set(v, plyRowValues(row, groups[j])...)
+		}
+	}
+	return
+}
+
+// Reads the faces of a face element as lists of vertex indices, along with the
+// values of the element's scalar properties (indexed by property).
+func readPLYFaces(element *plyElement, values plyValueReader) (faces [][]int, rows [][]float64, err error) {
+	indices_property := -1
+	for i, property := range element.Properties {
+		if property.IsList &&
+			(property.Name == "vertex_indices" || property.Name == "vertex_index") {
+			indices_property = i
+		}
+	}
+	if indices_property < 0 {
+		err = errors.New("face element lacks vertex_indices property")
+		return
+	}
+
+	faces = make([][]int, 0, readChunkSize(element.Count))
+	rows = make([][]float64, 0, readChunkSize(element.Count))
+	for i := 0; i < element.Count; i++ {
+		row := make([]float64, len(element.Properties))
+		var face []int
+		for j, property := range element.Properties {
+			if !property.IsList {
+				row[j], err = values.Read(property.Type)
+				if err != nil {
+					return
+				}
+				continue
+			}
+			var list []float64
+			list, err = readPLYList(property, values)
+			if err != nil {
+				return
+			}
+			if j == indices_property {
+				if len(list) < 3 {
+					err = errors.New("face " + strconv.Itoa(i) +
+						" has fewer than three vertices")
+					return
+				}
+				face = make([]int, len(list))
+				for k, index := range list {
+					face[k] = int(index)
+				}
+			}
+		}
+		faces = append(faces, face)
+		rows = append(rows, row)
+	}
+	return
+}
+
+// Reads the values of one instance of an element, skipping list properties.
+func readPLYRow(element *plyElement, values plyValueReader) (row []float64, err error) {
+	row = make([]float64, len(element.Properties))
+	for j, property := range element.Properties {
+		if property.IsList {
+			_, err = readPLYList(property, values)
+		} else {
+			row[j], err = values.Read(property.Type)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func readPLYList(property plyProperty, values plyValueReader) (list []float64, err error) {
+	count, err := values.Read(property.CountType)
+	if err != nil {
+		return
+	}
+	if count < 0 || count > maxReadValues || count != math.Trunc(count) {
+		err = &ParseError{Format: "PLY", Token: strconv.FormatFloat(count, 'g', -1, 64),
+			Err: errors.New("invalid list length for property " + property.Name)}
+		return
+	}
+	// values are appended as they're read, so a length larger than the data
+	// in the file doesn't allocate more than is there
+	list = make([]float64, 0, readChunkSize(int(count)))
+	for i := 0; i < int(count); i++ {
+		var value float64
+		if value, err = values.Read(property.Type); err != nil {
+			return
+		}
+		list = append(list, value)
+	}
+	return
+}
+
+func skipPLYElement(element *plyElement, values plyValueReader) (err error) {
+	for i := 0; i < element.Count; i++ {
+		if _, err = readPLYRow(element, values); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func ReadPLYFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	mesh_reader := io.Reader(input_file)
+	m, err = LoadPLY(&mesh_reader)
+	return
+}
+
+// Writes PLY values in either ASCII or binary, tracking the first error.
+type plyValueWriter struct {
+	writer *bufio.Writer
+	format PLYFormat
+	order  binary.ByteOrder
+	buffer [8]byte
+	first  bool
+	err    error
+}
+
+func (w *plyValueWriter) Write(ply_type string, value float64) {
+	if w.err != nil {
+		return
+	}
+	if w.format == PLYASCII {
+		if !w.first {
+			w.err = w.writer.WriteByte(' ')
+		}
+		w.first = false
+		_, w.err = w.writer.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		return
+	}
+	b := w.buffer[:plyTypeSizes[ply_type]]
+	switch ply_type {
+	case "uchar":
+		b[0] = uint8(value)
+	case "int":
+		w.order.PutUint32(b, uint32(int32(value)))
+	case "float":
+		w.order.PutUint32(b, math.Float32bits(float32(value)))
+	case "double":
+		w.order.PutUint64(b, math.Float64bits(value))
+	}
+	_, w.err = w.writer.Write(b)
+}
+
+// Ends the current element instance.
+func (w *plyValueWriter) EndRow() {
+	if w.format == PLYASCII && w.err == nil {
+		w.err = w.writer.WriteByte('\n')
+	}
+	w.first = true
+}
+
+// Write mesh as PLY, ASCII unless another format is given in the options.
+// Normals are written if every vertex has one, colors if any vertex has one,
+// texture coordinates (from the first corner of each vertex which has any) if
+// any face has them, and the mesh's vertex and face attributes as float
+// properties.
+func (m *Mesh) WritePLY(ply_writer io.Writer, opts ...PLYOptions) (err error) {
+	options := PLYOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	format_name, known := plyFormatNames[options.Format]
+	if !known {
+		return errors.New("Unknown PLY format")
+	}
+
+	has_normals := m.Vertices.Len() > 0
+	has_colors := false
+	m.Vertices.Each(func(v VertexI) {
+		has_normals = has_normals && v.GetNormal() != nil
+		has_colors = has_colors || v.GetColor() != nil
+	})
+	tex_coords := vertexTexCoords(m.Vertices.GetAll(), m.Faces)
+	vertexAttributes := []*VertexAttribute{}
+	faceAttributes := []*FaceAttribute{}
+	if m.Attributes != nil {
+		vertexAttributes = m.Attributes.Vertex
+		faceAttributes = m.Attributes.Face
+	}
+
+	header := "ply\n" +
+		"format " + format_name + " 1.0\n" +
+		"comment written by gomesh\n" +
+		"element vertex " + strconv.Itoa(m.Vertices.Len()) + "\n" +
+		"property double x\nproperty double y\nproperty double z\n"
+	if has_normals {
+		header += "property float nx\nproperty float ny\nproperty float nz\n"
+	}
+	if has_colors {
+		header += "property uchar red\nproperty uchar green\n" +
+			"property uchar blue\nproperty uchar alpha\n"
+	}
+	if tex_coords != nil {
+		header += "property float texture_u\nproperty float texture_v\n"
+	}
+	for _, attr := range vertexAttributes {
+		header += plyAttributeProperties(attr.Name, attr.Type)
+	}
+	header += "element face " + strconv.Itoa(m.Faces.Len()) + "\n" +
+		"property list uchar int vertex_indices\n"
+	for _, attr := range faceAttributes {
+		header += plyAttributeProperties(attr.Name, attr.Type)
+	}
+	header += "end_header\n"
+
+	buffered := bufio.NewWriter(ply_writer)
+	if _, err = buffered.WriteString(header); err != nil {
+		return
+	}
+
+	w := &plyValueWriter{writer: buffered, format: options.Format, first: true}
+	if options.Format == PLYBinaryBigEndian {
+		w.order = binary.BigEndian
+	} else {
+		w.order = binary.LittleEndian
+	}
+
+	// track where vertices were written
+	vert_lookup := make(map[VertexI]int)
+	m.Vertices.EachWithIndex(func(i int, v VertexI) {
+		vert_lookup[v] = i
+		w.Write("double", v.GetX())
+		w.Write("double", v.GetY())
+		w.Write("double", v.GetZ())
+		if has_normals {
+			n := v.GetNormal()
+			w.Write("float", n.GetX())
+			w.Write("float", n.GetY())
+			w.Write("float", n.GetZ())
+		}
+		if has_colors {
+			c := v.GetColor()
+			if c == nil {
+				c = &Color{1, 1, 1, 1}
+			}
+			for _, component := range c {
+				w.Write("uchar", math.Floor(math.Max(0, math.Min(1, component))*255+0.5))
+			}
+		}
+		if tex_coords != nil {
+			vt := tex_coords[i]
+			if vt == nil {
+				vt = &geom.Vec3{}
+			}
+			w.Write("float", vt.X)
+			w.Write("float", vt.Y)
+		}
+		for _, attr := range vertexAttributes {
+			value, _ := attr.Get(v)
+			writePLYAttribute(w, attr.Type, value)
+		}
+		w.EndRow()
+	})
+
+	m.Faces.Each(func(f FaceI) {
+		w.Write("uchar", 3)
+		f.EachVertex(func(v VertexI) {
+			w.Write("int", float64(vert_lookup[v]))
+		})
+		for _, attr := range faceAttributes {
+			value, _ := attr.Get(f)
+			writePLYAttribute(w, attr.Type, value)
+		}
+		w.EndRow()
+	})
+	if w.err != nil {
+		err = w.err
+		return
+	}
+	err = buffered.Flush()
+	return
+}
+
+func (m *Mesh) WritePLYFile(output_path string, opts ...PLYOptions) (err error) {
+	err = writeFile(output_path, func(w io.Writer) error {
+		return m.WritePLY(w, opts...)
+	})
+	return
+}
@@ -0,0 +1,115 @@
+package mesh
+
+import (
+	"bytes"
+	"github.com/nat-n/geom"
+	"io"
+	"strings"
+	"testing"
+)
+
+var asciiPLY = `ply
+format ascii 1.0
+comment a coloured quad with a confidence per vertex
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property float confidence
+element face 1
+property list uchar int vertex_indices
+property int label
+end_header
+0 0 0 255 0 0 0.5
+1 0 0 0 255 0 0.25
+1 1 0 0 0 255 1
+0 1 0 255 255 255 0.75
+4 0 1 2 3 7
+`
+
+// Tests for LoadPLY and WritePLY
+
+func TestPLYRoundTrip(t *testing.T) {
+	formats := []PLYFormat{PLYASCII, PLYBinaryLittleEndian, PLYBinaryBigEndian}
+	for _, format := range formats {
+		r := io.Reader(strings.NewReader(asciiPLY))
+		m, err := LoadPLY(&r)
+		if err != nil {
+			t.Fatal("Expected no error reading PLY, got", err)
+		}
+		m.Attributes.AddVertexAttribute("tangent", TangentAttribute).Set(
+			m.Vertices.Get(1)[0], 0, 1, 0, -1)
+		m.Faces.Each(func(f FaceI) {
+			f.SetTexCoords([3]*geom.Vec3{
+				&geom.Vec3{f.GetA().GetX(), f.GetA().GetY(), 0},
+				&geom.Vec3{f.GetB().GetX(), f.GetB().GetY(), 0},
+				&geom.Vec3{f.GetC().GetX(), f.GetC().GetY(), 0},
+			})
+		})
+
+		buf := new(bytes.Buffer)
+		if err = m.WritePLY(buf, PLYOptions{Format: format}); err != nil {
+			t.Error("For format", format, "expected no error writing PLY, got", err)
+			continue
+		}
+		r = io.Reader(buf)
+		m, err = LoadPLY(&r)
+		if err != nil {
+			t.Error("For format", format, "expected no error reading PLY, got", err)
+			continue
+		}
+
+		if m.Vertices.Len() != 4 || m.Faces.Len() != 2 {
+			t.Error("For format", format, "expected 4 vertices and 2 faces, got",
+				m.Vertices.Len(), m.Faces.Len())
+			continue
+		}
+		v := m.Vertices.Get(1)[0]
+		if c := v.GetColor(); c == nil || *c != (Color{0, 1, 0, 1}) {
+			t.Error("For format", format, "expected vertex color to be green, got", c)
+		}
+		if vt := m.Faces.Get(1)[0].GetTexCoords()[1]; vt == nil || *vt != (geom.Vec3{1, 1, 0}) {
+			t.Error("For format", format, "expected texture coordinates, got", vt)
+		}
+		if m.Attributes.GetVertexAttribute("texture") != nil {
+			t.Error("For format", format, "expected no texture coordinate attribute")
+		}
+		confidence := m.Attributes.GetVertexAttribute("confidence")
+		if confidence == nil || confidence.Values[v] != 0.25 {
+			t.Error("For format", format, "expected confidence attribute 0.25")
+		}
+		label := m.Attributes.GetFaceAttribute("label")
+		if label == nil {
+			t.Error("For format", format, "expected label face attribute")
+			continue
+		}
+		tangent := m.Attributes.GetVertexAttribute("tangent")
+		if value, _ := tangent.Get(v); tangent.Type != TangentAttribute ||
+			len(value) != 4 || value[1] != 1 || value[3] != -1 {
+			t.Error("For format", format, "expected tangent attribute, got", tangent)
+		}
+		if label.Type != LabelAttribute {
+			t.Error("For format", format, "expected integer property to be read as a label")
+		}
+		m.Faces.Each(func(f FaceI) {
+			if label.Values[f] != 7 {
+				t.Error("For format", format, "expected face label 7, got",
+					label.Values[f])
+			}
+		})
+	}
+}
+
+func TestLoadPLYBadListLengths(t *testing.T) {
+	for _, length := range []string{"-1", "2.5", "1e300", "100000000", "NaN"} {
+		input := strings.Replace(asciiPLY, "4 0 1 2 3 7", length+" 0 1 2 3 7", 1)
+		r := io.Reader(strings.NewReader(input))
+		_, err := LoadPLY(&r)
+		if _, ok := err.(*ParseError); !ok {
+			t.Error("For list length", length, "expected a ParseError, got", err)
+		}
+	}
+}
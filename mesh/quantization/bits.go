@@ -0,0 +1,98 @@
+package quantization
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Packs values of arbitrary bit widths into bytes, least significant bit
+// first.
+type bitWriter struct {
+	data    []byte
+	pending uint64
+	count   uint
+}
+
+func (w *bitWriter) Write(value uint64, bits uint) {
+	w.pending |= (value & (1<<bits - 1)) << w.count
+	w.count += bits
+	for w.count >= 8 {
+		w.data = append(w.data, byte(w.pending))
+		w.pending >>= 8
+		w.count -= 8
+	}
+}
+
+// Writes out any partial byte, so that following data is byte aligned.
+func (w *bitWriter) Flush() {
+	if w.count > 0 {
+		w.data = append(w.data, byte(w.pending))
+		w.pending = 0
+		w.count = 0
+	}
+}
+
+var errTruncated = errors.New("Error decoding quantized mesh: unexpected end of data")
+
+// Unpacks values written by a bitWriter.
+type bitReader struct {
+	data    []byte
+	offset  int
+	pending uint64
+	count   uint
+}
+
+func (r *bitReader) Read(bits uint) (uint64, error) {
+	for r.count < bits {
+		if r.offset >= len(r.data) {
+			return 0, errTruncated
+		}
+		r.pending |= uint64(r.data[r.offset]) << r.count
+		r.offset++
+		r.count += 8
+	}
+	value := r.pending & (1<<bits - 1)
+	r.pending >>= bits
+	r.count -= bits
+	return value, nil
+}
+
+// Discards the rest of a partially read byte.
+func (r *bitReader) Align() {
+	r.pending = 0
+	r.count = 0
+}
+
+func (r *bitReader) Uvarint() (uint64, error) {
+	value, n := binary.Uvarint(r.data[r.offset:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.offset += n
+	return value, nil
+}
+
+func (r *bitReader) Bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.offset {
+		return nil, errTruncated
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b, nil
+}
+
+func (w *bitWriter) Uvarint(value uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buffer[:], value)
+	w.data = append(w.data, buffer[:n]...)
+}
+
+// Maps signed integers to unsigned ones so that small magnitudes have short
+// varints: 0, -1, 1, -2, 2... become 0, 1, 2, 3, 4...
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
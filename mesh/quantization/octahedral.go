@@ -0,0 +1,50 @@
+package quantization
+
+import (
+	"math"
+)
+
+// Octahedral normal encoding projects a unit vector onto the octahedron
+// |x|+|y|+|z| = 1, folds the lower half over the upper, and flattens the result
+// onto the square [-1, 1]², which is then quantized with the given number of
+// bits per component.
+
+func signNotZero(f float64) float64 {
+	if f < 0 {
+		return -1
+	}
+	return 1
+}
+
+func octEncode(x, y, z float64, bits uint) (qu, qv uint64) {
+	l1 := math.Abs(x) + math.Abs(y) + math.Abs(z)
+	if l1 == 0 || math.IsNaN(l1) {
+		x, y, z, l1 = 0, 0, 1, 1
+	}
+	u, v := x/l1, y/l1
+	if z < 0 {
+		u, v = (1-math.Abs(v))*signNotZero(u), (1-math.Abs(u))*signNotZero(v)
+	}
+	return quantizeUnit((u+1)/2, bits), quantizeUnit((v+1)/2, bits)
+}
+
+func octDecode(qu, qv uint64, bits uint) (x, y, z float64) {
+	u := dequantizeUnit(qu, bits)*2 - 1
+	v := dequantizeUnit(qv, bits)*2 - 1
+	z = 1 - math.Abs(u) - math.Abs(v)
+	if z < 0 {
+		u, v = (1-math.Abs(v))*signNotZero(u), (1-math.Abs(u))*signNotZero(v)
+	}
+	length := math.Sqrt(u*u + v*v + z*z)
+	return u / length, v / length, z / length
+}
+
+// Quantizes a value in the range 0..1 to the nearest of 2^bits levels.
+func quantizeUnit(f float64, bits uint) uint64 {
+	max := float64(uint64(1)<<bits - 1)
+	return uint64(math.Floor(math.Max(0, math.Min(1, f))*max + 0.5))
+}
+
+func dequantizeUnit(q uint64, bits uint) float64 {
+	return float64(q) / float64(uint64(1)<<bits-1)
+}
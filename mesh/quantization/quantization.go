@@ -0,0 +1,341 @@
+/*
+Package quantization provides a compact, lossy encoding of meshes for delivery
+over the web.
+
+Vertex positions are quantized to a configurable number of bits per axis
+relative to the mesh's BoundingBox(), so each coordinate of a decoded position
+is within
+
+	extent / (2 * (2^PositionBits - 1))
+
+of the original, where extent is the size of the bounding box along that axis
+(see PositionError). Normals are octahedral encoded with NormalBits per
+component, so each decoded unit normal is within
+
+	3 * sqrt(2) / (2^NormalBits - 1)
+
+of the original unit normal, as a distance between unit vectors, which for
+small errors is the angle between them in radians (see NormalError).
+
+Faces are reordered for a GPU's post-transform vertex cache, vertices are
+renumbered in the order faces first use them, and the index stream is delta
+and varint coded. Neither the order of vertices nor that of faces is preserved,
+and only the mesh's name, positions, normals and faces are encoded.
+*/
+package quantization
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/nat-n/geom"
+	"github.com/nat-n/gomesh/mesh"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Options controlling how meshes are quantized. Zero values select the
+// defaults.
+type Options struct {
+	// Bits per axis of vertex positions, 1 to 30. Defaults to 14.
+	PositionBits int
+	// Bits per octahedral component of vertex normals, 1 to 30. Defaults to 10.
+	NormalBits int
+	// Omit normals, which are otherwise encoded if every vertex has one.
+	SkipNormals bool
+}
+
+const (
+	DefaultPositionBits = 14
+	DefaultNormalBits   = 10
+)
+
+const (
+	formatVersion = 1
+	hasNormals    = 1
+)
+
+var magic = []byte("GMQZ")
+
+// Returns the largest error in any coordinate of a vertex position when the
+// mesh is quantized with the given number of bits.
+func PositionError(m *mesh.Mesh, bits int) float64 {
+	bb := m.BoundingBox()
+	extent := math.Max(bb.Width(), math.Max(bb.Height(), bb.Depth()))
+	if m.Vertices.Len() == 0 || extent <= 0 {
+		return 0
+	}
+	return extent / (2 * float64(uint64(1)<<uint(bits)-1))
+}
+
+// Returns the largest distance between an original and a decoded unit normal
+// when normals are quantized with the given number of bits.
+func NormalError(bits int) float64 {
+	return 3 * math.Sqrt2 / float64(uint64(1)<<uint(bits)-1)
+}
+
+func (o *Options) withDefaults() (Options, error) {
+	options := *o
+	if options.PositionBits == 0 {
+		options.PositionBits = DefaultPositionBits
+	}
+	if options.NormalBits == 0 {
+		options.NormalBits = DefaultNormalBits
+	}
+	if options.PositionBits < 1 || options.PositionBits > 30 ||
+		options.NormalBits < 1 || options.NormalBits > 30 {
+		return options, errors.New("Quantization bits must be between 1 and 30")
+	}
+	return options, nil
+}
+
+// Encodes a mesh in the quantized format.
+func Encode(m *mesh.Mesh, opts ...Options) (data []byte, err error) {
+	options := Options{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options, err = options.withDefaults(); err != nil {
+		return
+	}
+	position_bits := uint(options.PositionBits)
+	normal_bits := uint(options.NormalBits)
+
+	vertices := m.Vertices.GetAll()
+	vert_lookup := make(map[mesh.VertexI]int, len(vertices))
+	with_normals := !options.SkipNormals && len(vertices) > 0
+	for i, v := range vertices {
+		vert_lookup[v] = i
+		with_normals = with_normals && v.GetNormal() != nil
+	}
+	indices := make([]int, 0, m.Faces.Len()*3)
+	m.Faces.Each(func(f mesh.FaceI) {
+		f.EachVertex(func(v mesh.VertexI) {
+			i, found := vert_lookup[v]
+			if !found {
+				err = errors.New("Cannot quantize mesh: face references a vertex " +
+					"which isn't in the mesh")
+			}
+			indices = append(indices, i)
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	// renumber vertices in the order the reordered faces first use them
+	indices = optimizeVertexCache(indices, len(vertices))
+	new_index := make([]int, len(vertices))
+	for i := range new_index {
+		new_index[i] = -1
+	}
+	order := make([]int, 0, len(vertices))
+	for _, i := range indices {
+		if new_index[i] < 0 {
+			new_index[i] = len(order)
+			order = append(order, i)
+		}
+	}
+	for i := range vertices {
+		if new_index[i] < 0 {
+			new_index[i] = len(order)
+			order = append(order, i)
+		}
+	}
+
+	w := &bitWriter{}
+	w.data = append(w.data, magic...)
+	flags := byte(0)
+	if with_normals {
+		flags |= hasNormals
+	}
+	w.data = append(w.data, formatVersion, flags, byte(position_bits), byte(normal_bits))
+	w.Uvarint(uint64(len(m.Name)))
+	w.data = append(w.data, m.Name...)
+	w.Uvarint(uint64(len(vertices)))
+	w.Uvarint(uint64(len(indices) / 3))
+
+	bb := m.BoundingBox()
+	origin := [3]float64{bb.OriginX, bb.OriginY, bb.OriginZ}
+	extent := [3]float64{bb.Width(), bb.Height(), bb.Depth()}
+	if len(vertices) == 0 {
+		origin, extent = [3]float64{}, [3]float64{}
+	}
+	for _, f := range append(origin[:], extent[:]...) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		w.data = append(w.data, b[:]...)
+	}
+
+	for _, i := range order {
+		v := vertices[i]
+		for axis, coord := range [3]float64{v.GetX(), v.GetY(), v.GetZ()} {
+			relative := 0.0
+			if extent[axis] > 0 {
+				relative = (coord - origin[axis]) / extent[axis]
+			}
+			w.Write(quantizeUnit(relative, position_bits), position_bits)
+		}
+	}
+	if with_normals {
+		for _, i := range order {
+			n := vertices[i].GetNormal()
+			qu, qv := octEncode(n.GetX(), n.GetY(), n.GetZ(), normal_bits)
+			w.Write(qu, normal_bits)
+			w.Write(qv, normal_bits)
+		}
+	}
+	w.Flush()
+
+	previous := 0
+	for _, i := range indices {
+		w.Uvarint(zigzag(int64(new_index[i] - previous)))
+		previous = new_index[i]
+	}
+	data = w.data
+	return
+}
+
+// Decodes a mesh from the quantized format.
+func Decode(data []byte) (m *mesh.Mesh, err error) {
+	if len(data) < len(magic)+4 || string(data[:len(magic)]) != string(magic) {
+		err = errors.New("Error decoding quantized mesh: missing magic number")
+		return
+	}
+	header := data[len(magic) : len(magic)+4]
+	if header[0] != formatVersion {
+		err = errors.New("Error decoding quantized mesh: unsupported version " +
+			strconv.Itoa(int(header[0])))
+		return
+	}
+	with_normals := header[1]&hasNormals != 0
+	position_bits, normal_bits := uint(header[2]), uint(header[3])
+	if position_bits < 1 || position_bits > 30 || normal_bits < 1 || normal_bits > 30 {
+		err = errors.New("Error decoding quantized mesh: invalid bit depth")
+		return
+	}
+
+	r := &bitReader{data: data, offset: len(magic) + 4}
+	name_length, err := r.Uvarint()
+	if err != nil {
+		return
+	}
+	name, err := r.Bytes(int(name_length))
+	if err != nil {
+		return
+	}
+	vertex_count, err := r.Uvarint()
+	if err != nil {
+		return
+	}
+	face_count, err := r.Uvarint()
+	if err != nil {
+		return
+	}
+	// check the counts are plausible before allocating anything for them
+	bits_per_vertex := uint64(position_bits * 3)
+	if with_normals {
+		bits_per_vertex += uint64(normal_bits * 2)
+	}
+	available := uint64(len(data) - r.offset)
+	if vertex_count > available*8/bits_per_vertex || face_count > available/3 {
+		err = errTruncated
+		return
+	}
+
+	var bounds [6]float64
+	for i := range bounds {
+		var b []byte
+		if b, err = r.Bytes(8); err != nil {
+			return
+		}
+		bounds[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+
+	m = mesh.New(string(name))
+	vertices := make([]mesh.VertexI, vertex_count)
+	for i := range vertices {
+		var coords [3]float64
+		for axis := range coords {
+			var q uint64
+			if q, err = r.Read(position_bits); err != nil {
+				return nil, err
+			}
+			coords[axis] = bounds[axis] + dequantizeUnit(q, position_bits)*bounds[axis+3]
+		}
+		vertices[i] = m.AddVertex(coords[0], coords[1], coords[2])
+	}
+	if with_normals {
+		for _, v := range vertices {
+			var qu, qv uint64
+			if qu, err = r.Read(normal_bits); err == nil {
+				qv, err = r.Read(normal_bits)
+			}
+			if err != nil {
+				return nil, err
+			}
+			x, y, z := octDecode(qu, qv, normal_bits)
+			v.SetNormal(&geom.Vec3{x, y, z})
+		}
+	}
+	r.Align()
+
+	previous := int64(0)
+	for i := uint64(0); i < face_count; i++ {
+		var corners [3]mesh.VertexI
+		for j := range corners {
+			var delta uint64
+			if delta, err = r.Uvarint(); err != nil {
+				return nil, err
+			}
+			index := previous + unzigzag(delta)
+			if index < 0 || index >= int64(vertex_count) {
+				return nil, errors.New("Error decoding quantized mesh: invalid index " +
+					strconv.FormatInt(index, 10))
+			}
+			corners[j] = vertices[index]
+			previous = index
+		}
+		m.AddFace(corners[0], corners[1], corners[2])
+	}
+	if r.offset != len(data) {
+		return nil, errors.New("Error decoding quantized mesh: unexpected data at byte " +
+			strconv.Itoa(r.offset))
+	}
+	return
+}
+
+// Write a mesh in the quantized format.
+func Write(m *mesh.Mesh, w io.Writer, opts ...Options) (err error) {
+	data, err := Encode(m, opts...)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(data)
+	return
+}
+
+// Read a mesh in the quantized format.
+func Load(r *io.Reader) (m *mesh.Mesh, err error) {
+	data, err := io.ReadAll(*r)
+	if err != nil {
+		return
+	}
+	return Decode(data)
+}
+
+func sniff(header []byte) bool {
+	return len(header) >= len(magic) && string(header[:len(magic)]) == string(magic)
+}
+
+// Registers the quantized format with the mesh package, for files with the
+// .gmq extension, when this package is imported.
+func init() {
+	mesh.RegisterFormat(&mesh.Format{
+		Name:       "quantized",
+		Extensions: []string{".gmq"},
+		Sniff:      sniff,
+		Read:       func(r io.Reader) (*mesh.Mesh, error) { return Load(&r) },
+		Write:      func(m *mesh.Mesh, w io.Writer) error { return Write(m, w) },
+	})
+}
@@ -0,0 +1,164 @@
+package quantization
+
+import (
+	"github.com/nat-n/geom"
+	"github.com/nat-n/gomesh/mesh"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Returns a UV sphere with normals.
+func testSphere(rings, segments int) *mesh.Mesh {
+	m := mesh.New("sphere")
+	grid := make([][]mesh.VertexI, rings+1)
+	for i := range grid {
+		theta := math.Pi * float64(i) / float64(rings)
+		grid[i] = make([]mesh.VertexI, segments)
+		for j := range grid[i] {
+			phi := 2 * math.Pi * float64(j) / float64(segments)
+			x := math.Sin(theta) * math.Cos(phi)
+			y := math.Sin(theta) * math.Sin(phi)
+			z := math.Cos(theta)
+			v := m.AddVertex(3*x+1, 3*y-2, 3*z)
+			v.SetNormal(&geom.Vec3{x, y, z})
+			grid[i][j] = v
+		}
+	}
+	for i := 0; i < rings; i++ {
+		for j := 0; j < segments; j++ {
+			a, b := grid[i][j], grid[i][(j+1)%segments]
+			c, d := grid[i+1][j], grid[i+1][(j+1)%segments]
+			m.AddFace(a, c, d)
+			m.AddFace(a, d, b)
+		}
+	}
+	return m
+}
+
+type quantizationTestParams struct {
+	options Options
+}
+
+var quantizationTests = []quantizationTestParams{
+	{Options{}},
+	{Options{PositionBits: 8, NormalBits: 6}},
+	{Options{PositionBits: 30, NormalBits: 30}},
+	{Options{PositionBits: 1, NormalBits: 1}},
+	{Options{SkipNormals: true}},
+}
+
+// Tests for Encode and Decode
+
+func TestRoundTripErrorBounds(t *testing.T) {
+	m := testSphere(12, 24)
+	for _, params := range quantizationTests {
+		data, err := Encode(m, params.options)
+		if err != nil {
+			t.Error("For", params.options, "expected no error encoding, got", err)
+			continue
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Error("For", params.options, "expected no error decoding, got", err)
+			continue
+		}
+		if decoded.Name != "sphere" || decoded.Vertices.Len() != m.Vertices.Len() ||
+			decoded.Faces.Len() != m.Faces.Len() {
+			t.Error("For", params.options, "expected", m.Vertices.Len(), "vertices and",
+				m.Faces.Len(), "faces, got", decoded.Vertices.Len(), decoded.Faces.Len())
+			continue
+		}
+		options, _ := params.options.withDefaults()
+		// allow for rounding in dequantization
+		position_error := PositionError(m, options.PositionBits) + 1e-12
+		normal_error := NormalError(options.NormalBits)
+
+		decoded.Vertices.Each(func(v mesh.VertexI) {
+			if params.options.SkipNormals != (v.GetNormal() == nil) {
+				t.Error("For", params.options, "expected normals only if not skipped")
+			}
+		})
+
+		// the bounds hold for every vertex regardless of order, so compare the
+		// nearest decoded vertex to each original
+		m.Vertices.Each(func(v mesh.VertexI) {
+			best, best_distance := mesh.VertexI(nil), math.Inf(1)
+			decoded.Vertices.Each(func(w mesh.VertexI) {
+				d := math.Max(math.Abs(v.GetX()-w.GetX()), math.Max(
+					math.Abs(v.GetY()-w.GetY()), math.Abs(v.GetZ()-w.GetZ())))
+				if d < best_distance {
+					best, best_distance = w, d
+				}
+			})
+			if best_distance > position_error {
+				t.Error("For", params.options, "expected position error within",
+					position_error, "got", best_distance)
+			}
+			if !params.options.SkipNormals && options.PositionBits >= 8 {
+				n, dn := v.GetNormal(), best.GetNormal()
+				diff := n.Subtract(dn)
+				if diff.Magnitude() > normal_error {
+					t.Error("For", params.options, "expected normal error within",
+						normal_error, "got", diff.Magnitude())
+				}
+			}
+		})
+	}
+}
+
+func TestNormalErrorBound(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, bits := range []uint{1, 2, 4, 8, 12, 16} {
+		bound := NormalError(int(bits))
+		for i := 0; i < 10000; i++ {
+			n := geom.Vec3{random.NormFloat64(), random.NormFloat64(), random.NormFloat64()}
+			n = n.Normalized()
+			qu, qv := octEncode(n.X, n.Y, n.Z, bits)
+			x, y, z := octDecode(qu, qv, bits)
+			if d := math.Sqrt(math.Pow(x-n.X, 2) + math.Pow(y-n.Y, 2) +
+				math.Pow(z-n.Z, 2)); d > bound {
+				t.Error("For", bits, "bits expected normal error within", bound,
+					"got", d, "for", n)
+				break
+			}
+		}
+	}
+}
+
+func TestVertexCacheOrder(t *testing.T) {
+	m := testSphere(20, 40)
+	plain := Options{PositionBits: 16}
+	data, _ := Encode(m, plain)
+	// a reordered, delta coded index stream should be well under the 3 bytes
+	// per index a naive varint coding of this mesh would need
+	vertex_bytes := (m.Vertices.Len()*(16*3+10*2) + 7) / 8
+	index_bytes := len(data) - vertex_bytes
+	if index_bytes > m.Faces.Len()*3*3/2 {
+		t.Error("Expected compact index stream, got", index_bytes, "bytes for",
+			m.Faces.Len(), "faces")
+	}
+
+	indices := []int{0, 1, 2, 2, 1, 3, 4, 5, 6, 0, 2, 4}
+	reordered := optimizeVertexCache(indices, 7)
+	seen := make(map[[3]int]bool)
+	for i := 0; i < len(reordered); i += 3 {
+		seen[[3]int{reordered[i], reordered[i+1], reordered[i+2]}] = true
+	}
+	for i := 0; i < len(indices); i += 3 {
+		if !seen[[3]int{indices[i], indices[i+1], indices[i+2]}] {
+			t.Error("Expected reordering to keep triangle", indices[i:i+3])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data, _ := Encode(testSphere(4, 8))
+	for _, corrupt := range [][]byte{
+		nil, []byte("GMQZ"), data[:len(data)/2], append(append([]byte{}, data...), 0),
+	} {
+		if _, err := Decode(corrupt); err == nil {
+			t.Error("Expected error decoding", len(corrupt), "bytes")
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package quantization
+
+import (
+	"math"
+)
+
+// Parameters of Tom Forsyth's "Linear-Speed Vertex Cache Optimisation".
+const (
+	cacheSize         = 32
+	cacheDecayPower   = 1.5
+	lastTriangleScore = 0.75
+	valenceBoostScale = 2.0
+	valenceBoostPower = 0.5
+)
+
+// Scores a vertex by its position in the simulated cache (or -1 if it isn't
+// in it) and the number of triangles still to be output which use it.
+func vertexScore(cache_position, remaining int) float64 {
+	if remaining == 0 {
+		return -1
+	}
+	score := 0.0
+	if cache_position >= 0 {
+		if cache_position < 3 {
+			// the last triangle's vertices are penalised so that strips don't
+			// simply double back on themselves
+			score = lastTriangleScore
+		} else {
+			scaler := 1.0 / (cacheSize - 3)
+			score = math.Pow(1-float64(cache_position-3)*scaler, cacheDecayPower)
+		}
+	}
+	// vertices with few triangles left are favoured to finish them off
+	return score + valenceBoostScale*math.Pow(float64(remaining), -valenceBoostPower)
+}
+
+// Reorders triangles, given as a flat list of vertex indices, so that vertices
+// are reused while they're likely to still be in a GPU's post-transform cache.
+// Triangles keep their winding.
+func optimizeVertexCache(indices []int, vertex_count int) []int {
+	triangle_count := len(indices) / 3
+
+	// the triangles using each vertex, with those still to be output first
+	offsets := make([]int, vertex_count+1)
+	for _, v := range indices {
+		offsets[v+1]++
+	}
+	for v := 0; v < vertex_count; v++ {
+		offsets[v+1] += offsets[v]
+	}
+	remaining := make([]int, vertex_count)
+	vertex_triangles := make([]int, len(indices))
+	for t := 0; t < triangle_count; t++ {
+		for _, v := range indices[t*3 : t*3+3] {
+			vertex_triangles[offsets[v]+remaining[v]] = t
+			remaining[v]++
+		}
+	}
+
+	cache_positions := make([]int, vertex_count)
+	vertex_scores := make([]float64, vertex_count)
+	for v := range cache_positions {
+		cache_positions[v] = -1
+		vertex_scores[v] = vertexScore(-1, remaining[v])
+	}
+	triangle_scores := make([]float64, triangle_count)
+	added := make([]bool, triangle_count)
+	best := -1
+	for t := range triangle_scores {
+		for _, v := range indices[t*3 : t*3+3] {
+			triangle_scores[t] += vertex_scores[v]
+		}
+		if best < 0 || triangle_scores[t] > triangle_scores[best] {
+			best = t
+		}
+	}
+
+	result := make([]int, 0, len(indices))
+	cache := make([]int, 0, cacheSize+3)
+	next_unadded := 0
+	for len(result) < len(indices) {
+		if best < 0 {
+			// none of the cached vertices have triangles left, so carry on from
+			// the next triangle in the original order
+			for added[next_unadded] {
+				next_unadded++
+			}
+			best = next_unadded
+		}
+		t := best
+		added[t] = true
+		corners := indices[t*3 : t*3+3]
+		result = append(result, corners...)
+
+		for _, v := range corners {
+			// remove the triangle from those left for the vertex
+			active := vertex_triangles[offsets[v] : offsets[v]+remaining[v]]
+			for i, other := range active {
+				if other == t {
+					active[i] = active[len(active)-1]
+					active[len(active)-1] = t
+					break
+				}
+			}
+			remaining[v]--
+		}
+
+		// move the triangle's vertices to the front of the cache
+		new_cache := make([]int, 0, cacheSize+3)
+		new_cache = append(new_cache, corners...)
+		for _, v := range cache {
+			if v != corners[0] && v != corners[1] && v != corners[2] {
+				new_cache = append(new_cache, v)
+			}
+		}
+		touched := new_cache
+		cache = new_cache
+		if len(cache) > cacheSize {
+			for _, v := range cache[cacheSize:] {
+				cache_positions[v] = -1
+			}
+			cache = cache[:cacheSize]
+		}
+		for i, v := range cache {
+			cache_positions[v] = i
+		}
+		for _, v := range touched {
+			vertex_scores[v] = vertexScore(cache_positions[v], remaining[v])
+		}
+
+		// the next triangle is the best one using a vertex in the cache
+		best = -1
+		for _, v := range touched {
+			for _, other := range vertex_triangles[offsets[v] : offsets[v]+remaining[v]] {
+				score := 0.0
+				for _, u := range indices[other*3 : other*3+3] {
+					score += vertex_scores[u]
+				}
+				triangle_scores[other] = score
+				if best < 0 || score > triangle_scores[best] {
+					best = other
+				}
+			}
+		}
+	}
+	return result
+}
@@ -1,5 +1,9 @@
 package simplification
 
+import (
+	"math"
+)
+
 type Quadric [10]float64
 
 func (q1 *Quadric) Add(q2 *Quadric) {
@@ -15,42 +19,32 @@ func (q1 *Quadric) Add(q2 *Quadric) {
 	q1[9] += q2[9]
 }
 
-// 0  => 0,  1  => 1,  2  => 2,  3 => 3,
-// 4  => 1,  5  => 4,  6  => 5,  7 => 6,
-// 8  => 2,  9  => 5,  10 => 7, 11 => 8,
-// 12 => 3,  13 => 6,  14 => 8, 15 => 9,
-
-func (q *Quadric) Inverse() (result_ref *Quadric, can_invert bool) {
-	result := Quadric{}
-	result_ref = &result
-	can_invert = true
-	det := q.Determinant()
-	if det == 0 {
-		can_invert = false
+// Returns the position minimising the error of the quadric, by solving
+// A * v = -b for the 3x3 matrix A and vector b making up the quadric, and
+// whether the solution could be found. No solution is given when A is close
+// to singular (such as when the planes are nearly parallel, or nearly meet
+// along a line), as the minimum is then badly defined and may lie far from
+// any of the planes' vertices.
+func (q *Quadric) Optimum() (position [3]float64, ok bool) {
+	det := q.Determinant2(0, 1, 2, 1, 4, 5, 2, 5, 7)
+	// A is positive semi-definite, so its trace bounds its eigenvalues, and
+	// the determinant is the product of the eigenvalues. Relative to the cube
+	// of the trace it's below 1e-6 when the two smaller eigenvalues are below
+	// about 1e-3 of the largest, as for planes within a couple of degrees of
+	// each other, while the planes around a vertex of a finely tessellated
+	// curved surface still give a well defined position.
+	trace := q[0] + q[4] + q[7]
+	if trace <= 0 || math.Abs(det) < 1e-6*trace*trace*trace {
 		return
 	}
-	result[0] = (q[5]*q[8]*q[6] - q[6]*q[7]*q[6] + q[6]*q[5]*q[8] - q[4]*q[8]*q[8] - q[5]*q[5]*q[9] + q[4]*q[7]*q[9]) / det
-	result[1] = (q[3]*q[7]*q[6] - q[2]*q[8]*q[6] - q[3]*q[5]*q[8] + q[1]*q[8]*q[8] + q[2]*q[5]*q[9] - q[1]*q[7]*q[9]) / det
-	result[2] = (q[2]*q[6]*q[6] - q[3]*q[5]*q[6] + q[3]*q[4]*q[8] - q[1]*q[6]*q[8] - q[2]*q[4]*q[9] + q[1]*q[5]*q[9]) / det
-	result[3] = (q[3]*q[5]*q[5] - q[2]*q[6]*q[5] - q[3]*q[4]*q[7] + q[1]*q[6]*q[7] + q[2]*q[4]*q[8] - q[1]*q[5]*q[8]) / det
-	result[4] = (q[2]*q[8]*q[3] - q[3]*q[7]*q[3] + q[3]*q[2]*q[8] - q[0]*q[8]*q[8] - q[2]*q[2]*q[9] + q[0]*q[7]*q[9]) / det
-	result[5] = (q[3]*q[5]*q[3] - q[2]*q[6]*q[3] - q[3]*q[1]*q[8] + q[0]*q[6]*q[8] + q[2]*q[1]*q[9] - q[0]*q[5]*q[9]) / det
-	result[6] = (q[2]*q[6]*q[2] - q[3]*q[5]*q[2] + q[3]*q[1]*q[7] - q[0]*q[6]*q[7] - q[2]*q[1]*q[8] + q[0]*q[5]*q[8]) / det
-	result[7] = (q[1]*q[6]*q[3] - q[3]*q[4]*q[3] + q[3]*q[1]*q[6] - q[0]*q[6]*q[6] - q[1]*q[1]*q[9] + q[0]*q[4]*q[9]) / det
-	result[8] = (q[3]*q[4]*q[2] - q[1]*q[6]*q[2] - q[3]*q[1]*q[5] + q[0]*q[6]*q[5] + q[1]*q[1]*q[8] - q[0]*q[4]*q[8]) / det
-	result[9] = (q[1]*q[5]*q[2] - q[2]*q[4]*q[2] + q[2]*q[1]*q[5] - q[0]*q[5]*q[5] - q[1]*q[1]*q[7] + q[0]*q[4]*q[7]) / det
+	// Cramer's rule, with each column of A replaced by b in turn
+	position[0] = -q.Determinant2(3, 1, 2, 6, 4, 5, 8, 5, 7) / det
+	position[1] = -q.Determinant2(0, 3, 2, 1, 6, 5, 2, 8, 7) / det
+	position[2] = -q.Determinant2(0, 1, 3, 1, 4, 6, 2, 5, 8) / det
+	ok = true
 	return
 }
 
-func (q *Quadric) Determinant() float64 {
-	return q[3]*q[5]*q[5]*q[3] - q[2]*q[6]*q[5]*q[3] - q[3]*q[4]*q[7]*q[3] + q[1]*q[6]*q[7]*q[3] +
-		q[2]*q[4]*q[8]*q[3] - q[1]*q[5]*q[8]*q[3] - q[3]*q[5]*q[2]*q[6] + q[2]*q[6]*q[2]*q[6] +
-		q[3]*q[1]*q[7]*q[6] - q[0]*q[6]*q[7]*q[6] - q[2]*q[1]*q[8]*q[6] + q[0]*q[5]*q[8]*q[6] +
-		q[3]*q[4]*q[2]*q[8] - q[1]*q[6]*q[2]*q[8] - q[3]*q[1]*q[5]*q[8] + q[0]*q[6]*q[5]*q[8] +
-		q[1]*q[1]*q[8]*q[8] - q[0]*q[4]*q[8]*q[8] - q[2]*q[4]*q[2]*q[9] + q[1]*q[5]*q[2]*q[9] +
-		q[2]*q[1]*q[5]*q[9] - q[0]*q[5]*q[5]*q[9] - q[1]*q[1]*q[7]*q[9] + q[0]*q[4]*q[7]*q[9]
-}
-
 func (q *Quadric) VertexError(x, y, z float64) float64 {
 	// v(transpose) * q * v
 	return x*x*q[0] + 2*x*y*q[1] + 2*x*z*q[2] + 2*x*q[3] +
@@ -65,6 +59,7 @@ func (q *Quadric) Clone() *Quadric {
 	return &new_q
 }
 
+// Returns the determinant of the 3x3 matrix of the given elements.
 func (q *Quadric) Determinant2(
 	a11, a12, a13,
 	a21, a22, a23,
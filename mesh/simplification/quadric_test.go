@@ -0,0 +1,79 @@
+package simplification
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns the quadric of the plane ax + by + cz + d = 0.
+func planeQuadric(a, b, c, d float64) *Quadric {
+	return &Quadric{
+		a * a, a * b, a * c, a * d,
+		b * b, b * c, b * d,
+		c * c, c * d,
+		d * d,
+	}
+}
+
+// Tests for Optimum
+
+func TestOptimum(t *testing.T) {
+	type optimumTestParams struct {
+		name     string
+		planes   [][4]float64
+		expected [3]float64
+		ok       bool
+	}
+	s := 1 / math.Sqrt(2)
+	// normals tilted slightly away from the z axis
+	n := 1 / math.Sqrt(1+1e-4)
+	for _, params := range []optimumTestParams{
+		{"corner", [][4]float64{{1, 0, 0, -1}, {0, 1, 0, -2}, {0, 0, 1, -3}}, [3]float64{1, 2, 3}, true},
+		{"slanted corner", [][4]float64{{s, s, 0, 0}, {s, -s, 0, -s}, {0, 0, 1, 1}}, [3]float64{0.5, -0.5, -1}, true},
+		{"plane", [][4]float64{{0, 0, 1, -3}, {0, 0, 1, -3}}, [3]float64{}, false},
+		{"line", [][4]float64{{1, 0, 0, -1}, {0, 1, 0, -2}}, [3]float64{}, false},
+		{"nearly coplanar", [][4]float64{{0, 0, 1, 0}, {0.01 * n, 0, n, -n}, {0, 0.01 * n, n, n}}, [3]float64{}, false},
+		{"nothing", [][4]float64{}, [3]float64{}, false},
+	} {
+		q := &Quadric{}
+		for _, p := range params.planes {
+			q.Add(planeQuadric(p[0], p[1], p[2], p[3]))
+		}
+		result, ok := q.Optimum()
+		if ok != params.ok {
+			t.Error("For", params.name, "expected", params.ok, "got", ok)
+			continue
+		}
+		for i := range result {
+			if math.Abs(result[i]-params.expected[i]) > 1e-9 {
+				t.Error("For", params.name, "expected", params.expected, "got", result)
+				break
+			}
+		}
+		if ok && q.VertexError(result[0], result[1], result[2]) > 1e-9 {
+			t.Error("For", params.name, "expected no error at", result)
+		}
+	}
+}
+
+// Tests for calculateError
+
+func TestCalculateErrorFarOptimum(t *testing.T) {
+	// the planes meet at (100, 0, 0), far beyond the end of the edge
+	q := &Quadric{}
+	for _, p := range [][4]float64{{1, 0, 0, -100}, {0, 1, 0, 0}, {0, 0, 1, 0}} {
+		q.Add(planeQuadric(p[0], p[1], p[2], p[3]))
+	}
+	if _, ok := q.Optimum(); !ok {
+		t.Fatal("Expected the planes to have an optimum")
+	}
+	e := &edge{
+		V1: &vertex{Coords: [3]float64{0, 0, 0}, Q: q},
+		V2: &vertex{Coords: [3]float64{1, 0, 0}, Q: &Quadric{}},
+	}
+	e.calculateError()
+	if e.CollapseTarget != [3]float64{1, 0, 0} {
+		t.Error("Expected collapse to the end of the edge nearest the optimum, got",
+			e.CollapseTarget)
+	}
+}
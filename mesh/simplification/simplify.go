@@ -2,7 +2,6 @@ package simplification
 
 import (
 	"container/heap"
-	"fmt"
 	"github.com/nat-n/gomesh/mesh"
 	"math"
 )
@@ -10,15 +9,16 @@ import (
 import tb "github.com/nat-n/gomesh/triplebuffer"
 
 type vertex struct {
-	Coords     [3]float64
-	Faces      []*face
-	Q          *Quadric
-	Edges      []*edge
-	FinalIndex int
-	Collapsed  bool
+	Source    mesh.VertexI
+	Coords    [3]float64
+	Faces     []*face
+	Q         *Quadric
+	Edges     []*edge
+	Collapsed bool
 }
 
 type face struct {
+	Source    mesh.FaceI
 	Vertices  [3]*vertex
 	Kp        *Quadric
 	Collapsed bool
@@ -72,11 +72,10 @@ func (h *edgeHeap) Fix(indices ...int) {
 // Find and call fix on each of the affected edges,
 // this is inefficient, but not too bad, and I'm not sure how to avoid it
 func (h *edgeHeap) UpdateEdges(affected_edges []*edge) {
-	possible_matches := make([]*edge, 0, len(affected_edges))
+	possible_matches := make([]*edge, len(affected_edges))
 	copy(possible_matches, affected_edges)
-	eh := *h
-	for i, e := range eh {
-		i++
+	for i := 0; i < len(*h) && len(possible_matches) > 0; i++ {
+		e := (*h)[i]
 		for j, possible_match := range possible_matches {
 			if e == possible_match {
 				heap.Fix(h, i)
@@ -90,7 +89,6 @@ func (h *edgeHeap) UpdateEdges(affected_edges []*edge) {
 	}
 }
 
-// Not sure if this is needed
 func (f *face) IncludesVertex(v1 *vertex) bool {
 	for _, v2 := range f.Vertices {
 		if v1 == v2 {
@@ -100,6 +98,23 @@ func (f *face) IncludesVertex(v1 *vertex) bool {
 	return false
 }
 
+// Returns the vertices sharing a face with this vertex, among the faces which
+// haven't been collapsed.
+func (v *vertex) neighbors() map[*vertex]bool {
+	result := make(map[*vertex]bool)
+	for _, f := range v.Faces {
+		if f.Collapsed || !f.IncludesVertex(v) {
+			continue
+		}
+		for _, other := range f.Vertices {
+			if other != v {
+				result[other] = true
+			}
+		}
+	}
+	return result
+}
+
 // Calculate the Optimal collapse location for this edge and the associated
 // error, and update the edge with these values.
 func (e *edge) calculateError() {
@@ -109,49 +124,42 @@ func (e *edge) calculateError() {
 	e.Q.Add(e.V1.Q)
 	e.Q.Add(e.V2.Q)
 
-	det := Q.Determinant()
-	// if det != 0 && false { // BLOCKED
-	e.CollapseTarget[0] = (Q[3]*Q[5]*Q[5] - Q[2]*Q[6]*Q[5] - Q[3]*Q[4]*Q[7] + Q[1]*Q[6]*Q[7] + Q[2]*Q[4]*Q[8] - Q[1]*Q[5]*Q[8]) / det
-	e.CollapseTarget[1] = (Q[2]*Q[6]*Q[2] - Q[3]*Q[5]*Q[2] + Q[3]*Q[1]*Q[7] - Q[0]*Q[6]*Q[7] - Q[2]*Q[1]*Q[8] + Q[0]*Q[5]*Q[8]) / det
-	e.CollapseTarget[2] = (Q[3]*Q[4]*Q[2] - Q[1]*Q[6]*Q[2] - Q[3]*Q[1]*Q[5] + Q[0]*Q[6]*Q[5] + Q[1]*Q[1]*Q[8] - Q[0]*Q[4]*Q[8]) / det
-
-	// } else {
-
-	// Determine which is best, V1, V2 or their midpoint
-	midpoint := [3]float64{
-		(e.V1.Coords[0] + e.V2.Coords[0]) / 2,
-		(e.V1.Coords[1] + e.V2.Coords[1]) / 2,
-		(e.V1.Coords[2] + e.V2.Coords[2]) / 2,
+	// Use the position with the least error if it's well defined and no
+	// further from the middle of the edge than the edge is long
+	if optimum, ok := Q.Optimum(); ok {
+		distance := 0.0
+		for i := range optimum {
+			d := optimum[i] - (e.V1.Coords[i]+e.V2.Coords[i])/2
+			distance += d * d
+		}
+		if math.Sqrt(distance) <= e.Length() {
+			e.CollapseTarget = optimum
+			e.Error = Q.VertexError(optimum[0], optimum[1], optimum[2])
+			return
+		}
 	}
+
+	// Otherwise use the best position along the edge. The error along the edge
+	// is a quadratic function of the distance t from V1, so it's determined by
+	// its value at V1, V2 and their midpoint.
 	v1_error := Q.VertexError(e.V1.Coords[0], e.V1.Coords[1], e.V1.Coords[2])
 	v2_error := Q.VertexError(e.V2.Coords[0], e.V2.Coords[1], e.V2.Coords[2])
-	midpoint_error := Q.VertexError(midpoint[0], midpoint[1], midpoint[2])
-
-	e.Error = Q.VertexError(
-		e.CollapseTarget[0],
-		e.CollapseTarget[1],
-		e.CollapseTarget[2],
+	midpoint_error := Q.VertexError(
+		(e.V1.Coords[0]+e.V2.Coords[0])/2,
+		(e.V1.Coords[1]+e.V2.Coords[1])/2,
+		(e.V1.Coords[2]+e.V2.Coords[2])/2,
 	)
-
-	if e.Error < v1_error && e.Error < v2_error && e.Error < midpoint_error {
-		fmt.Println("THIS NEVER HAPPENS :( ")
-		fmt.Println("The present implementation of the textbook approach is somehow very broken")
-		fmt.Println("in that the resulting vertex locations are all on a line.")
-	} else if v1_error < v2_error {
-		if v1_error < midpoint_error {
-			e.CollapseTarget = e.V1.Coords
-		} else {
-			e.CollapseTarget = midpoint
-		}
-	} else {
-		if v2_error < midpoint_error {
-			e.CollapseTarget = e.V2.Coords
-		} else {
-			e.CollapseTarget = midpoint
-		}
+	a := 2 * (v1_error - 2*midpoint_error + v2_error)
+	b := v2_error - v1_error - a
+	t := 0.0
+	if a > 0 {
+		t = math.Max(0, math.Min(1, -b/(2*a)))
+	} else if v2_error < v1_error {
+		t = 1
+	}
+	for i := range e.CollapseTarget {
+		e.CollapseTarget[i] = e.V1.Coords[i] + t*(e.V2.Coords[i]-e.V1.Coords[i])
 	}
-
-	// }
 
 	e.Error = Q.VertexError(
 		e.CollapseTarget[0],
@@ -160,7 +168,7 @@ func (e *edge) calculateError() {
 	)
 }
 
-func (e *edge) collapse(threshold float64) (did_collapse bool) {
+func (e *edge) collapse(threshold float64, safer_mode bool) (did_collapse bool) {
 	did_collapse = false
 
 	if e.Removed {
@@ -174,54 +182,42 @@ func (e *edge) collapse(threshold float64) (did_collapse bool) {
 	}
 
 	// Skip edges where a neighbor from v1 is also a neighbor of v2
-	// but there's is no face shared by the three vertices.
-	for _, v1_edge := range e.V1.Edges {
-		var v1_other *vertex
-		if v1_edge.V1 == e.V1 {
-			v1_other = e.V2
-		} else {
-			v1_other = e.V1
+	// but there's is no face shared by the three vertices, as collapsing them
+	// would leave the mesh non-manifold.
+	v2_neighbors := e.V2.neighbors()
+	for v1_other := range e.V1.neighbors() {
+		if !v2_neighbors[v1_other] {
+			continue
 		}
-		for _, v2_edge := range e.V1.Edges {
-			var v2_other *vertex
-			if v2_edge.V1 == e.V1 {
-				v2_other = e.V2
-			} else {
-				v2_other = e.V1
+		// check if there is a face shared by all three
+		found_face := false
+		for _, v1_face := range e.V1.Faces {
+			if !v1_face.Collapsed && v1_face.IncludesVertex(e.V1) &&
+				v1_face.IncludesVertex(e.V2) && v1_face.IncludesVertex(v1_other) {
+				found_face = true
 			}
-			if v1_other == v2_other {
-				// check if there is a face shared by all three
-				found_face := false
-				for _, v1_face := range e.V1.Faces {
-					if (e.V1 == v1_face.Vertices[0] || e.V1 == v1_face.Vertices[1] || e.V1 == v1_face.Vertices[2]) &&
-						(e.V2 == v1_face.Vertices[0] || e.V2 == v1_face.Vertices[1] || e.V2 == v1_face.Vertices[2]) &&
-						(v1_other == v1_face.Vertices[0] || v1_other == v1_face.Vertices[1] || v1_other == v1_face.Vertices[2]) {
-						found_face = true
-					}
-				}
-				if !found_face {
-					fmt.Println("skipping super-triangle!")
-
-					// in this case maybe we should actually considering replacing the
-					// three faces with one (depending on distance of center vertex from
-					// the average of the three corner vertices)
+		}
+		if !found_face {
+			// in this case maybe we should actually considering replacing the
+			// three faces with one (depending on distance of center vertex from
+			// the average of the three corner vertices)
 
-					return
-				}
-			}
+			return
 		}
 	}
 
-	// temporary... seems to reduce artifacts
-	for _, v1_edge := range e.V1.Edges {
-		v1_edge.Removed = true
-	}
-	for _, v2_edge := range e.V2.Edges {
-		v2_edge.Removed = true
+	// seems to reduce artifacts
+	if safer_mode {
+		for _, v1_edge := range e.V1.Edges {
+			v1_edge.Removed = true
+		}
+		for _, v2_edge := range e.V2.Edges {
+			v2_edge.Removed = true
+		}
 	}
 
 	// Update V1 to the new location and Q
-	e.V1.Coords[0] = e.CollapseTarget[0]
+	e.V1.Coords = e.CollapseTarget
 	e.V1.Q = e.Q
 
 	// Mark V2 as collapsed
@@ -233,13 +229,12 @@ func (e *edge) collapse(threshold float64) (did_collapse bool) {
 	//  - Update references to V2 to V1
 	//  - Register faces with V1
 	for _, f := range e.V2.Faces {
-		for _, f_edge := range f.Edges {
-			if f_edge == e {
-				f.Collapsed = true
-				break
-			}
+		if f.Collapsed {
+			continue
 		}
-		if !f.Collapsed {
+		if f.IncludesVertex(e.V1) && f.IncludesVertex(e.V2) {
+			f.Collapsed = true
+		} else {
 			if f.Vertices[0] == e.V2 {
 				f.Vertices[0] = e.V1
 			} else if f.Vertices[1] == e.V2 {
@@ -333,6 +328,10 @@ func (f *face) calculateKp() {
 // safer_mode: if true then at most one edge associated with each vertex will be
 // collapsed, this seems to reduce artifacts for equivalent performance, though
 // less can be achieved per invokation.
+// The mesh is simplified in place: the remaining vertices and faces keep their
+// identity and attribute values, while collapsed ones are removed from the
+// mesh. Vertex normals are recalculated, as are the normals of faces which
+// have them.
 func QECD(m *mesh.Mesh, threshold float64, target_face_count int, safer_mode bool) {
 
 	vertices := make([]*vertex, 0)
@@ -340,9 +339,10 @@ func QECD(m *mesh.Mesh, threshold float64, target_face_count int, safer_mode boo
 	edges := &edgeHeap{}
 
 	// build up vertices
-	m.Vertices.Each(func(x, y, z float64) {
+	m.Vertices.Each(func(v mesh.VertexI) {
 		vertices = append(vertices, &vertex{
-			Coords: [3]float64{x, y, z},
+			Source: v,
+			Coords: [3]float64{v.GetX(), v.GetY(), v.GetZ()},
 			Faces:  make([]*face, 0),
 			Q:      &Quadric{},
 			Edges:  make([]*edge, 0),
@@ -351,9 +351,14 @@ func QECD(m *mesh.Mesh, threshold float64, target_face_count int, safer_mode boo
 	// Build up faces and update verts
 	// iterate through faces and collect non-border edges
 	// by counting the occurances of every edge, and keeping those with a count of 2
+	// This assumes vertex indices are accurate
 	edge_occurances := make(map[[2]int][]*face)
-	m.Faces.Each(func(a, b, c int) {
+	m.Faces.Each(func(f mesh.FaceI) {
+		a := f.GetA().GetLocationInMesh(m)
+		b := f.GetB().GetLocationInMesh(m)
+		c := f.GetC().GetLocationInMesh(m)
 		new_face := &face{
+			Source:   f,
 			Vertices: [3]*vertex{vertices[a], vertices[b], vertices[c]},
 		}
 		faces = append(faces, new_face)
@@ -438,7 +443,7 @@ func QECD(m *mesh.Mesh, threshold float64, target_face_count int, safer_mode boo
 	edges_collapse_target := (len(faces) - target_face_count) / 2
 	for len(*edges) > 0 && edges_collapse_target > 0 {
 		lowest_cost_edge := heap.Pop(edges).(*edge)
-		did_collapse := lowest_cost_edge.collapse(threshold)
+		did_collapse := lowest_cost_edge.collapse(threshold, safer_mode)
 		if did_collapse {
 			edges_collapse_target--
 		}
@@ -448,29 +453,57 @@ func QECD(m *mesh.Mesh, threshold float64, target_face_count int, safer_mode boo
 	//
 	// Update the mesh with the changes made to vertices and faces
 	//
-	m.Vertices = tb.NewVertexBuffer()
-	m.Norms = tb.NewVectorBuffer()
-	m.Faces = tb.NewTriangleBuffer()
+	removed_faces := make([]mesh.FaceI, 0)
+	for _, f := range faces {
+		if f.Collapsed ||
+			f.Vertices[0].Collapsed ||
+			f.Vertices[1].Collapsed ||
+			f.Vertices[2].Collapsed {
+			f.Collapsed = true
+			removed_faces = append(removed_faces, f.Source)
+		}
+	}
+	m.RemoveFaces(removed_faces...)
 
-	i := 0
+	// Move the remaining vertices, and point the remaining faces at them
 	for _, v := range vertices {
+		v.Source.RemoveAllFaces()
 		if !v.Collapsed {
-			v.FinalIndex = i
-			m.Vertices.Buffer = append(m.Vertices.Buffer, v.Coords[:]...)
-			i++
+			v.Source.SetX(v.Coords[0])
+			v.Source.SetY(v.Coords[1])
+			v.Source.SetZ(v.Coords[2])
 		}
 	}
-
 	for _, f := range faces {
-		if !(f.Collapsed ||
-			f.Vertices[0].Collapsed ||
-			f.Vertices[1].Collapsed ||
-			f.Vertices[2].Collapsed) {
-			a := f.Vertices[0].FinalIndex
-			b := f.Vertices[1].FinalIndex
-			c := f.Vertices[2].FinalIndex
-			m.Faces.Buffer = append(m.Faces.Buffer, a, b, c)
+		if f.Collapsed {
+			continue
+		}
+		f.Source.SetA(f.Vertices[0].Source)
+		f.Source.SetB(f.Vertices[1].Source)
+		f.Source.SetC(f.Vertices[2].Source)
+		f.Source.EachVertex(func(v mesh.VertexI) { v.AddFace(f.Source) })
+		if f.Source.GetNormal() != nil {
+			t := f.Source.AsTriangle()
+			n := t.Normal()
+			f.Source.SetNormal(&n)
 		}
 	}
 
+	// Remove the collapsed vertices along with their attribute values
+	removed_vertices := make([]mesh.VertexI, 0)
+	for _, v := range vertices {
+		if v.Collapsed {
+			removed_vertices = append(removed_vertices, v.Source)
+		}
+	}
+	m.RemoveVertices(removed_vertices...)
+	m.ReindexVerticesAndFaces()
+
+	m.Vertices.Each(func(v mesh.VertexI) {
+		face_count := 0
+		v.EachFace(func(f mesh.FaceI) { face_count++ })
+		if face_count > 0 {
+			v.CalculateNormal()
+		}
+	})
 }
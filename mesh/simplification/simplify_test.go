@@ -0,0 +1,153 @@
+package simplification
+
+import (
+	"github.com/nat-n/gomesh/mesh"
+	"math"
+	"testing"
+)
+
+import cb "github.com/nat-n/gomesh/cuboid"
+
+// Returns a UV sphere of radius 1 around the origin, with a single vertex at
+// each pole.
+func testSphere(rings, segments int) *mesh.Mesh {
+	m := mesh.New("sphere")
+	north := m.AddVertex(0, 0, 1)
+	grid := make([][]mesh.VertexI, rings-1)
+	for i := range grid {
+		theta := math.Pi * float64(i+1) / float64(rings)
+		grid[i] = make([]mesh.VertexI, segments)
+		for j := range grid[i] {
+			phi := 2 * math.Pi * float64(j) / float64(segments)
+			grid[i][j] = m.AddVertex(math.Sin(theta)*math.Cos(phi),
+				math.Sin(theta)*math.Sin(phi), math.Cos(theta))
+		}
+	}
+	south := m.AddVertex(0, 0, -1)
+	for j := 0; j < segments; j++ {
+		next := (j + 1) % segments
+		m.AddFace(north, grid[0][j], grid[0][next])
+		for i := 0; i+1 < len(grid); i++ {
+			a, b := grid[i][j], grid[i][next]
+			c, d := grid[i+1][j], grid[i+1][next]
+			m.AddFace(a, c, d)
+			m.AddFace(a, d, b)
+		}
+		m.AddFace(south, grid[len(grid)-1][next], grid[len(grid)-1][j])
+	}
+	return m
+}
+
+// Checks that the vertices and faces of a mesh reference each other, that
+// every vertex has a normal, and that every edge is shared by two faces.
+func checkClosedMesh(t *testing.T, name string, m *mesh.Mesh) {
+	m.Vertices.EachWithIndex(func(i int, v mesh.VertexI) {
+		if v.GetLocationInMesh(m) != i {
+			t.Error("For", name, "expected vertex", i, "to be located at", i)
+		}
+		face_count := 0
+		v.EachFace(func(f mesh.FaceI) {
+			face_count++
+			if !f.ReferencesVertex(v) {
+				t.Error("For", name, "expected faces of vertex", i, "to reference it")
+			}
+		})
+		if face_count == 0 {
+			t.Error("For", name, "expected vertex", i, "to have faces")
+		}
+		n := v.GetNormal()
+		if n == nil || math.IsNaN(n.X) || math.IsNaN(n.Y) || math.IsNaN(n.Z) {
+			t.Error("For", name, "expected vertex", i, "to have a normal, got", n)
+		}
+	})
+	m.Faces.EachWithIndex(func(i int, f mesh.FaceI) {
+		if f_mesh, f_i := f.GetMeshLocation(); f_mesh != m || f_i != i {
+			t.Error("For", name, "expected face", i, "to be located at", i)
+		}
+		if f.GetA() == f.GetB() || f.GetB() == f.GetC() || f.GetC() == f.GetA() {
+			t.Error("For", name, "expected face", i, "to have distinct vertices")
+		}
+		f.EachVertex(func(v mesh.VertexI) {
+			if !v.OccursInMesh(m) || !v.ReferencesFace(f) {
+				t.Error("For", name, "expected vertices of face", i, "to be in the mesh and reference it")
+			}
+		})
+	})
+	m.GetEdges().Each(func(e *mesh.Edge) {
+		if len(e.Faces) != 2 {
+			t.Error("For", name, "expected", e.ToString(), "to have two faces, got", len(e.Faces))
+		}
+	})
+}
+
+// Tests for QECD
+
+func TestQECDSphere(t *testing.T) {
+	type sphereTestParams struct {
+		name       string
+		buffered   bool
+		safer_mode bool
+		target     int
+	}
+	for _, params := range []sphereTestParams{
+		{"sphere", false, false, 200},
+		{"sphere in safer mode", false, true, 200},
+		{"buffered sphere", true, false, 100},
+	} {
+		m := testSphere(16, 24)
+		original_count := m.Faces.Len()
+		if params.buffered {
+			m.UseBuffers()
+		}
+		m.Attributes.AddVertexAttribute("height").Set(m.Vertices.Get(0)[0], 1)
+
+		QECD(m, 1, params.target, params.safer_mode)
+		if m.Name != "sphere" {
+			t.Error("For", params.name, "expected the name to be kept, got", m.Name)
+		}
+		if m.Faces.Len() >= original_count || m.Faces.Len() < params.target {
+			t.Error("For", params.name, "expected between", params.target, "and",
+				original_count, "faces, got", m.Faces.Len())
+		}
+		if !params.safer_mode && m.Faces.Len() > params.target+1 {
+			t.Error("For", params.name, "expected to reach", params.target, "faces, got", m.Faces.Len())
+		}
+		if m.Vertices.Len() != m.Faces.Len()/2+2 {
+			t.Error("For", params.name, "expected", m.Faces.Len()/2+2, "vertices, got", m.Vertices.Len())
+		}
+		checkClosedMesh(t, params.name, m)
+		m.Vertices.Each(func(v mesh.VertexI) {
+			if r := v.Magnitude(); r < 0.99 || r > 1.05 {
+				t.Error("For", params.name, "expected vertices near the sphere, got", v.ToString())
+			}
+		})
+		for v := range m.Attributes.GetVertexAttribute("height").Values {
+			if !v.OccursInMesh(m) {
+				t.Error("For", params.name, "expected attribute values of removed vertices to be removed")
+			}
+		}
+	}
+}
+
+func TestQECDCuboid(t *testing.T) {
+	// edges longer than the threshold are kept
+	m := mesh.NewFromCuboid(*cb.New(0, 0, 0, 1, 2, 3))
+	original := m.Clone()
+	QECD(m, 0.5, 0, false)
+	if !m.Equal(original) {
+		t.Error("Expected cuboid with long edges to be unchanged")
+	}
+
+	m = mesh.NewFromCuboid(*cb.New(0, 0, 0, 1, 2, 3))
+	QECD(m, 10, 8, false)
+	if m.Name != "Cuboid" || m.Faces.Len() != 8 || m.Vertices.Len() != 6 {
+		t.Error("Expected 8 faces between 6 vertices, got", m.Faces.Len(), "between", m.Vertices.Len())
+	}
+	checkClosedMesh(t, "cuboid", m)
+	m.Vertices.Each(func(v mesh.VertexI) {
+		if v.GetX() < 0 || v.GetX() > 1 || v.GetY() < 0 || v.GetY() > 2 ||
+			v.GetZ() < 0 || v.GetZ() > 3 {
+			t.Error("Expected vertices within the cuboid, got", v.ToString())
+		}
+	})
+}
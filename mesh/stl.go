@@ -0,0 +1,336 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Options controlling how STL files are read and written.
+type STLOptions struct {
+	// Write ASCII rather than binary STL.
+	ASCII bool
+	// Store the normal of each facet on the corresponding Face.
+	KeepFacetNormals bool
+	// Store the 16-bit attribute word of each binary facet in the face label
+	// attribute named STLAttributeName.
+	KeepAttributes bool
+}
+
+// The name of the face attribute holding the 16-bit attribute word of each
+// facet of a binary STL file, which is read when asked for and always written.
+const STLAttributeName = "stl_attribute"
+
+// Size in bytes of the header, and of each facet record, of a binary STL file.
+const (
+	stlHeaderSize = 80
+	stlFacetSize  = 50
+)
+
+// A single triangle as read from an STL file, before vertices are welded.
+type stlFacet struct {
+	normal    [3]float64
+	corners   [3][3]float64
+	attribute uint16
+}
+
+// Read in STL file as new mesh. Binary and ASCII files are both supported.
+func LoadSTL(stl_path string, opts ...STLOptions) (m *Mesh, err error) {
+	input_file, err := openFile(stl_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	mesh_reader := io.Reader(input_file)
+	m, err = LoadSTLFrom(&mesh_reader, opts...)
+	return
+}
+
+// Read a new mesh from STL data, detecting whether it is binary or ASCII.
+// Corners shared by several facets are welded into a single Vertex.
+func LoadSTLFrom(stl_reader *io.Reader, opts ...STLOptions) (m *Mesh, err error) {
+	options := STLOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	buffered := bufio.NewReader(*stl_reader)
+	var (
+		name   string
+		facets []stlFacet
+	)
+	if isASCIISTL(buffered) {
+		name, facets, err = readASCIISTL(buffered)
+	} else {
+		facets, err = readBinarySTL(buffered)
+	}
+	if err != nil {
+		return
+	}
+
+	m = New(name)
+	var attributes *FaceAttribute
+	if options.KeepAttributes {
+		attributes = m.Attributes.AddFaceAttribute(STLAttributeName, LabelAttribute)
+	}
+	welded := make(map[[3]float64]VertexI)
+	for _, facet := range facets {
+		corners := [3]VertexI{}
+		for i, p := range facet.corners {
+			v, found := welded[p]
+			if !found {
+				v = m.AddVertex(p[0], p[1], p[2])
+				welded[p] = v
+			}
+			corners[i] = v
+		}
+		f := m.AddFace(corners[0], corners[1], corners[2])
+		if options.KeepFacetNormals {
+			f.SetNormal(&geom.Vec3{facet.normal[0], facet.normal[1], facet.normal[2]})
+		}
+		if attributes != nil {
+			attributes.Set(f, float64(facet.attribute))
+		}
+	}
+	return
+}
+
+// A file is taken to be ASCII STL if it begins with "solid" and the first
+// few hundred bytes are printable text mentioning a facet (or the end of the
+// solid). Binary headers are free text, so may also begin with "solid".
+func isASCIISTL(r *bufio.Reader) bool {
+	peeked, _ := r.Peek(512)
+	trimmed := bytes.TrimLeft(peeked, " \t\r\n")
+	if !bytes.HasPrefix(trimmed, []byte("solid")) {
+		return false
+	}
+	for _, b := range peeked {
+		if b > 126 || (b < 32 && b != '\n' && b != '\r' && b != '\t') {
+			return false
+		}
+	}
+	return bytes.Contains(peeked, []byte("facet")) ||
+		bytes.Contains(peeked, []byte("endsolid"))
+}
+
+func readBinarySTL(r io.Reader) (facets []stlFacet, err error) {
+	header := make([]byte, stlHeaderSize+4)
+	if _, err = io.ReadFull(r, header); err != nil {
+		err = errors.New("Error reading binary STL header: " + err.Error())
+		return
+	}
+	count := binary.LittleEndian.Uint32(header[stlHeaderSize:])
+
+	// the count isn't trusted for allocation, as a truncated or corrupt file
+	// would otherwise be able to request gigabytes
+	capacity := uint32(readChunkValues)
+	if count < capacity {
+		capacity = count
+	}
+	facets = make([]stlFacet, 0, capacity)
+	record := make([]byte, stlFacetSize)
+	for i := uint32(0); i < count; i++ {
+		if _, err = io.ReadFull(r, record); err != nil {
+			err = errors.New("Error reading binary STL facet " +
+				strconv.FormatUint(uint64(i), 10) + " of " +
+				strconv.FormatUint(uint64(count), 10) + ": " + err.Error())
+			return
+		}
+		facet := stlFacet{}
+		for j := 0; j < 3; j++ {
+			facet.normal[j] = float64(math.Float32frombits(
+				binary.LittleEndian.Uint32(record[j*4:])))
+		}
+		for c := 0; c < 3; c++ {
+			for j := 0; j < 3; j++ {
+				facet.corners[c][j] = float64(math.Float32frombits(
+					binary.LittleEndian.Uint32(record[12+c*12+j*4:])))
+			}
+		}
+		facet.attribute = binary.LittleEndian.Uint16(record[48:])
+		facets = append(facets, facet)
+	}
+	return
+}
+
+func readASCIISTL(r io.Reader) (name string, facets []stlFacet, err error) {
+	var (
+		line  string
+		words []string
+		facet stlFacet
+	)
+	line_no := 0
+	corner := 0
+	in_facet := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line_no++
+		line = strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		words = strings.Fields(line)
+		switch words[0] {
+		case "solid":
+			name = strings.TrimSpace(strings.TrimPrefix(line, "solid"))
+		case "facet":
+			if in_facet || len(words) != 5 || words[1] != "normal" {
+				err = newParseError("STL", line_no)
+				return
+			}
+			facet = stlFacet{}
+			facet.normal, err = parse3Floats(words[2:])
+			if err != nil {
+				err = newParseError("STL", line_no)
+				return
+			}
+			in_facet = true
+			corner = 0
+		case "vertex":
+			if !in_facet || corner > 2 || len(words) != 4 {
+				err = newParseError("STL", line_no)
+				return
+			}
+			facet.corners[corner], err = parse3Floats(words[1:])
+			if err != nil {
+				err = newParseError("STL", line_no)
+				return
+			}
+			corner++
+		case "endfacet":
+			if !in_facet || corner != 3 {
+				err = newParseError("STL", line_no)
+				return
+			}
+			facets = append(facets, facet)
+			in_facet = false
+		case "outer", "endloop", "endsolid":
+			// nothing to do
+		default:
+			err = newParseError("STL", line_no)
+			return
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// Write mesh to a new STL file, binary unless the ASCII option is given.
+func (m *Mesh) WriteSTL(stl_path string, opts ...STLOptions) (err error) {
+	err = writeFile(stl_path, func(w io.Writer) error {
+		return m.WriteSTLTo(w, opts...)
+	})
+	return
+}
+
+// Write mesh as STL. Facet normals are computed from the geometry of each face.
+func (m *Mesh) WriteSTLTo(stl_writer io.Writer, opts ...STLOptions) (err error) {
+	options := STLOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	buffered := bufio.NewWriter(stl_writer)
+	if options.ASCII {
+		err = m.writeASCIISTL(buffered)
+	} else {
+		err = m.writeBinarySTL(buffered)
+	}
+	if err != nil {
+		return
+	}
+	err = buffered.Flush()
+	return
+}
+
+// Calculate the normal of a face for writing, falling back to a zero vector
+// for degenerate faces.
+func stlFacetNormal(f FaceI) geom.Vec3 {
+	t := f.AsTriangle()
+	n := t.Normal()
+	if math.IsNaN(n.X) || math.IsNaN(n.Y) || math.IsNaN(n.Z) {
+		return geom.Vec3{0, 0, 0}
+	}
+	return n
+}
+
+func (m *Mesh) writeBinarySTL(w io.Writer) (err error) {
+	// The header is free text, but must not begin with "solid" lest it be
+	// mistaken for an ASCII file.
+	header := make([]byte, stlHeaderSize+4)
+	copy(header[:stlHeaderSize], "binary STL written by gomesh: "+m.Name)
+	binary.LittleEndian.PutUint32(header[stlHeaderSize:], uint32(m.Faces.Len()))
+	if _, err = w.Write(header); err != nil {
+		return
+	}
+
+	var attributes *FaceAttribute
+	if m.Attributes != nil {
+		attributes = m.Attributes.GetFaceAttribute(STLAttributeName)
+	}
+	record := make([]byte, stlFacetSize)
+	putVec3 := func(offset int, v geom.Vec3I) {
+		binary.LittleEndian.PutUint32(record[offset:],
+			math.Float32bits(float32(v.GetX())))
+		binary.LittleEndian.PutUint32(record[offset+4:],
+			math.Float32bits(float32(v.GetY())))
+		binary.LittleEndian.PutUint32(record[offset+8:],
+			math.Float32bits(float32(v.GetZ())))
+	}
+	for i := 0; i < m.Faces.Len(); i++ {
+		f := m.Faces.Get(i)[0]
+		n := stlFacetNormal(f)
+		putVec3(0, &n)
+		putVec3(12, f.GetA())
+		putVec3(24, f.GetB())
+		putVec3(36, f.GetC())
+		attribute := uint16(0)
+		if attributes != nil {
+			if value, found := attributes.Get(f); found {
+				attribute = uint16(value[0])
+			}
+		}
+		binary.LittleEndian.PutUint16(record[48:], attribute)
+		if _, err = w.Write(record); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *Mesh) writeASCIISTL(w io.Writer) (err error) {
+	formatVec3 := func(v geom.Vec3I) string {
+		return strconv.FormatFloat(v.GetX(), 'e', -1, 64) + " " +
+			strconv.FormatFloat(v.GetY(), 'e', -1, 64) + " " +
+			strconv.FormatFloat(v.GetZ(), 'e', -1, 64)
+	}
+
+	if _, err = io.WriteString(w, "solid "+m.Name+"\n"); err != nil {
+		return
+	}
+	for i := 0; i < m.Faces.Len(); i++ {
+		f := m.Faces.Get(i)[0]
+		n := stlFacetNormal(f)
+		_, err = io.WriteString(w,
+			"facet normal "+formatVec3(&n)+"\n"+
+				" outer loop\n"+
+				"  vertex "+formatVec3(f.GetA())+"\n"+
+				"  vertex "+formatVec3(f.GetB())+"\n"+
+				"  vertex "+formatVec3(f.GetC())+"\n"+
+				" endloop\n"+
+				"endfacet\n")
+		if err != nil {
+			return
+		}
+	}
+	_, err = io.WriteString(w, "endsolid "+m.Name+"\n")
+	return
+}
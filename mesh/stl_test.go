@@ -0,0 +1,142 @@
+package mesh
+
+import (
+	"bytes"
+	cb "github.com/nat-n/gomesh/cuboid"
+	"io"
+	"strings"
+	"testing"
+)
+
+type stlTestParams struct {
+	input       string
+	options     STLOptions
+	resultVerts int
+	resultFaces int
+	resultName  string
+}
+
+// Tests for LoadSTLFrom
+
+var asciiSTL = `solid tetra
+facet normal 0 0 -1
+ outer loop
+  vertex 0 0 0
+  vertex 0 1 0
+  vertex 1 0 0
+ endloop
+endfacet
+facet normal 0 -1 0
+ outer loop
+  vertex 0 0 0
+  vertex 1 0 0
+  vertex 0 0 1
+ endloop
+endfacet
+facet normal -1 0 0
+ outer loop
+  vertex 0 0 0
+  vertex 0 0 1
+  vertex 0 1 0
+ endloop
+endfacet
+facet normal 0.577 0.577 0.577
+ outer loop
+  vertex 1 0 0
+  vertex 0 1 0
+  vertex 0 0 1
+ endloop
+endfacet
+endsolid tetra
+`
+
+var loadSTLTests = []stlTestParams{
+	{
+		input:       asciiSTL,
+		resultVerts: 4,
+		resultFaces: 4,
+		resultName:  "tetra",
+	},
+	{
+		input:       asciiSTL,
+		options:     STLOptions{KeepFacetNormals: true},
+		resultVerts: 4,
+		resultFaces: 4,
+		resultName:  "tetra",
+	},
+}
+
+func TestLoadSTLFrom(t *testing.T) {
+	for _, params := range loadSTLTests {
+		r := io.Reader(strings.NewReader(params.input))
+		m, err := LoadSTLFrom(&r, params.options)
+		if err != nil {
+			t.Error("For STL input expected no error, got", err)
+			continue
+		}
+		if m.Name != params.resultName ||
+			m.Vertices.Len() != params.resultVerts ||
+			m.Faces.Len() != params.resultFaces {
+			t.Error(
+				"For STL input expected", params.resultName, params.resultVerts,
+				params.resultFaces, "got", m.Name, m.Vertices.Len(), m.Faces.Len(),
+			)
+		}
+		m.Vertices.Each(func(v VertexI) {
+			if len(v.(*Vertex).Faces) != 3 {
+				t.Error("Expected each welded vertex to reference 3 faces, got",
+					len(v.(*Vertex).Faces))
+			}
+		})
+		m.Faces.Each(func(f FaceI) {
+			if params.options.KeepFacetNormals != (f.GetNormal() != nil) {
+				t.Error("Expected facet normals to be kept:",
+					params.options.KeepFacetNormals)
+			}
+		})
+	}
+}
+
+// Tests for WriteSTLTo
+
+func TestWriteSTLRoundTrip(t *testing.T) {
+	for _, ascii := range []bool{false, true} {
+		m := NewFromCuboid(*cb.New(1, 2, 3, 4, 5, 6))
+		m.Attributes.AddFaceAttribute(STLAttributeName, LabelAttribute).Set(
+			m.Faces.Get(3)[0], 42)
+		buf := new(bytes.Buffer)
+		if err := m.WriteSTLTo(buf, STLOptions{ASCII: ascii}); err != nil {
+			t.Error("For ASCII", ascii, "expected no error writing STL, got", err)
+			continue
+		}
+		if !ascii && buf.Len() != stlHeaderSize+4+stlFacetSize*m.Faces.Len() {
+			t.Error("Expected binary STL of", stlHeaderSize+4+stlFacetSize*12,
+				"bytes, got", buf.Len())
+		}
+		r := io.Reader(buf)
+		m2, err := LoadSTLFrom(&r, STLOptions{KeepAttributes: true})
+		if err != nil {
+			t.Error("For ASCII", ascii, "expected no error reading STL, got", err)
+			continue
+		}
+		if m2.Vertices.Len() != 8 || m2.Faces.Len() != 12 {
+			t.Error("For ASCII", ascii, "expected 8 vertices and 12 faces, got",
+				m2.Vertices.Len(), m2.Faces.Len())
+		}
+		attributes := m2.Attributes.GetFaceAttribute(STLAttributeName)
+		if !ascii && (attributes == nil || attributes.Values[m2.Faces.Get(3)[0]] != 42 ||
+			attributes.Values[m2.Faces.Get(2)[0]] != 0) {
+			t.Error("Expected facet attribute words to be kept, got", attributes)
+		}
+	}
+}
+
+func TestLoadTruncatedBinarySTL(t *testing.T) {
+	for _, count := range []string{"\xff\xff\xff\xff", "\x02\x00\x00\x00"} {
+		input := strings.Repeat("\x00", 80) + count + strings.Repeat("\x00", 50)
+		r := io.Reader(strings.NewReader(input))
+		if _, err := LoadSTLFrom(&r, STLOptions{}); err == nil {
+			t.Error("For facet count", []byte(count), "expected an error for a truncated file")
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Options controlling how three.js BufferGeometry JSON is written.
+type ThreeJSOptions struct {
+	// The number of decimal places floats are rounded to, or zero to write
+	// them exactly. Trailing zeros are omitted, so a precision of 3 writes
+	// 0.5 as "0.5" and 1/3 as "0.333".
+	Precision int
+}
+
+type threeJSGeometry struct {
+	Metadata threeJSMetadata `json:"metadata"`
+	Type     string          `json:"type"`
+	Name     string          `json:"name,omitempty"`
+	Data     threeJSData     `json:"data"`
+}
+
+type threeJSMetadata struct {
+	Version   float64 `json:"version"`
+	Type      string  `json:"type"`
+	Generator string  `json:"generator"`
+}
+
+type threeJSData struct {
+	Attributes     map[string]*threeJSAttribute `json:"attributes"`
+	Index          *threeJSAttribute            `json:"index,omitempty"`
+	BoundingSphere *threeJSSphere               `json:"boundingSphere,omitempty"`
+}
+
+type threeJSAttribute struct {
+	ItemSize   int             `json:"itemSize,omitempty"`
+	Type       string          `json:"type"`
+	Array      json.RawMessage `json:"array"`
+	Normalized bool            `json:"normalized,omitempty"`
+}
+
+type threeJSSphere struct {
+	Center [3]float64 `json:"center"`
+	Radius float64    `json:"radius"`
+}
+
+// Rounds the numbers of a comma separated list to the given number of decimal
+// places, dropping trailing zeros.
+func roundCSV(csv string, precision int) string {
+	if csv == "" || precision <= 0 {
+		return csv
+	}
+	values := strings.Split(csv, ",")
+	for i, value := range values {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		rounded := strconv.FormatFloat(f, 'f', precision, 64)
+		rounded = strings.TrimRight(strings.TrimRight(rounded, "0"), ".")
+		if rounded == "-0" {
+			rounded = "0"
+		}
+		values[i] = rounded
+	}
+	return strings.Join(values, ",")
+}
+
+// Returns a copy of the mesh's vertices and faces with each vertex split into
+// one vertex per distinct tex coord of the face corners it's used by, and the
+// tex coord of each of the new vertices, or nil if the mesh has no tex coords.
+func (m *Mesh) splitByTexCoords() (split *Mesh, uvs []*geom.Vec3) {
+	has_tex_coords := false
+	m.Faces.Each(func(f FaceI) {
+		for _, vt := range f.GetTexCoords() {
+			has_tex_coords = has_tex_coords || vt != nil
+		}
+	})
+	if !has_tex_coords {
+		return m, nil
+	}
+
+	type corner struct {
+		v  VertexI
+		vt geom.Vec3
+	}
+	split = New(m.Name)
+	lookup := make(map[corner]VertexI)
+	m.Faces.Each(func(f FaceI) {
+		vts := f.GetTexCoords()
+		var corners [3]VertexI
+		for i, v := range [3]VertexI{f.GetA(), f.GetB(), f.GetC()} {
+			key := corner{v: v}
+			if vts[i] != nil {
+				key.vt = *vts[i]
+			}
+			new_v, found := lookup[key]
+			if !found {
+				new_v = split.AddVertex(v.GetX(), v.GetY(), v.GetZ())
+				new_v.SetNormal(v.GetNormal())
+				lookup[key] = new_v
+				uvs = append(uvs, &geom.Vec3{key.vt.X, key.vt.Y, 0})
+			}
+			corners[i] = new_v
+		}
+		split.AddFace(corners[0], corners[1], corners[2])
+	})
+	return
+}
+
+// Encodes mesh as three.js BufferGeometry JSON, with position, normal (if every
+// vertex has one) and uv (if any face has tex coords) attributes, an index and
+// a bounding sphere. Vertices are split where faces using them have different
+// tex coords, as BufferGeometry attributes are per vertex.
+func (m *Mesh) encodeThreeJS(opts ...ThreeJSOptions) ([]byte, error) {
+	options := ThreeJSOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	split, uvs := m.splitByTexCoords()
+
+	geometry := threeJSGeometry{
+		Metadata: threeJSMetadata{
+			Version: 4.6, Type: "BufferGeometry", Generator: "gomesh",
+		},
+		Type: "BufferGeometry",
+		Name: m.Name,
+		Data: threeJSData{Attributes: make(map[string]*threeJSAttribute)},
+	}
+	array := func(csv string) json.RawMessage {
+		return json.RawMessage("[" + roundCSV(csv, options.Precision) + "]")
+	}
+
+	geometry.Data.Attributes["position"] = &threeJSAttribute{
+		ItemSize: 3, Type: "Float32Array",
+		Array: array(split.Vertices.PositionsAsCSV()),
+	}
+	if normals := split.Vertices.NormalsAsCSV(); normals != "" {
+		geometry.Data.Attributes["normal"] = &threeJSAttribute{
+			ItemSize: 3, Type: "Float32Array", Array: array(normals),
+		}
+	}
+	if uvs != nil {
+		uv_values := make([]string, len(uvs))
+		for i, uv := range uvs {
+			uv_values[i] = strconv.FormatFloat(uv.X, 'f', -1, 64) + "," +
+				strconv.FormatFloat(uv.Y, 'f', -1, 64)
+		}
+		geometry.Data.Attributes["uv"] = &threeJSAttribute{
+			ItemSize: 2, Type: "Float32Array",
+			Array: array(strings.Join(uv_values, ",")),
+		}
+	}
+
+	index_type := "Uint16Array"
+	if split.Vertices.Len() > 65535 {
+		index_type = "Uint32Array"
+	}
+	geometry.Data.Index = &threeJSAttribute{
+		Type: index_type, Array: json.RawMessage("[" + split.Faces.IndicesAsCSV() + "]"),
+	}
+
+	// as computed by three.js, centered on the bounding box
+	if split.Vertices.Len() > 0 {
+		center := split.BoundingBox().Center()
+		radius := 0.0
+		split.Vertices.Each(func(v VertexI) {
+			offset := v.Subtract(&center)
+			radius = math.Max(radius, offset.Magnitude())
+		})
+		geometry.Data.BoundingSphere = &threeJSSphere{
+			Center: [3]float64{center.X, center.Y, center.Z}, Radius: radius,
+		}
+	}
+	return json.Marshal(geometry)
+}
+
+// Encodes mesh as three.js BufferGeometry JSON, with floats written exactly.
+func (m *Mesh) MarshalJSON() ([]byte, error) {
+	return m.encodeThreeJS()
+}
+
+// Decodes three.js BufferGeometry JSON into the mesh, replacing its contents.
+func (m *Mesh) UnmarshalJSON(data []byte) error {
+	decoded, err := decodeThreeJS(data)
+	if err != nil {
+		return err
+	}
+	// move the decoded vertices and faces into this mesh
+	*m = *decoded
+	m.Vertices.Each(func(v VertexI) { v.ForgetLocationInMesh(decoded) })
+	m.ReindexVerticesAndFaces()
+	return nil
+}
+
+// Write mesh as three.js BufferGeometry JSON, as loaded by
+// THREE.BufferGeometryLoader.
+func (m *Mesh) WriteThreeJS(json_writer io.Writer, opts ...ThreeJSOptions) (err error) {
+	data, err := m.encodeThreeJS(opts...)
+	if err != nil {
+		return
+	}
+	_, err = json_writer.Write(data)
+	return
+}
+
+func (m *Mesh) WriteThreeJSFile(output_path string, opts ...ThreeJSOptions) (err error) {
+	err = writeFile(output_path, func(w io.Writer) error {
+		return m.WriteThreeJS(w, opts...)
+	})
+	return
+}
+
+// Decodes the array of a BufferGeometry attribute, checking it has a whole
+// number of items.
+func decodeThreeJSArray(attr *threeJSAttribute, name string, item_size int) (values []float64, err error) {
+	if attr.ItemSize != item_size {
+		err = errors.New("Error reading three.js JSON: " + name +
+			" attribute must have an itemSize of " + strconv.Itoa(item_size))
+		return
+	}
+	if err = json.Unmarshal(attr.Array, &values); err != nil {
+		err = errors.New("Error reading three.js JSON: invalid " + name + " array")
+		return
+	}
+	if len(values)%item_size != 0 {
+		err = errors.New("Error reading three.js JSON: " + name +
+			" array has an incomplete item")
+	}
+	return
+}
+
+func decodeThreeJS(data []byte) (m *Mesh, err error) {
+	geometry := threeJSGeometry{}
+	if err = json.Unmarshal(data, &geometry); err != nil {
+		err = errors.New("Error reading three.js JSON: " + err.Error())
+		return
+	}
+	if geometry.Type != "BufferGeometry" {
+		err = errors.New("Error reading three.js JSON: unsupported geometry type " +
+			geometry.Type)
+		return
+	}
+	position := geometry.Data.Attributes["position"]
+	if position == nil {
+		err = errors.New("Error reading three.js JSON: missing position attribute")
+		return
+	}
+	positions, err := decodeThreeJSArray(position, "position", 3)
+	if err != nil {
+		return
+	}
+	vertex_count := len(positions) / 3
+
+	var normals, uvs []float64
+	if normal := geometry.Data.Attributes["normal"]; normal != nil {
+		if normals, err = decodeThreeJSArray(normal, "normal", 3); err != nil {
+			return
+		}
+	}
+	if uv := geometry.Data.Attributes["uv"]; uv != nil {
+		if uvs, err = decodeThreeJSArray(uv, "uv", 2); err != nil {
+			return
+		}
+	}
+	if (normals != nil && len(normals) != len(positions)) ||
+		(uvs != nil && len(uvs)/2 != vertex_count) {
+		err = errors.New("Error reading three.js JSON: attributes have different lengths")
+		return
+	}
+
+	// non-indexed geometry has a triangle for every three vertices
+	var indices []float64
+	if geometry.Data.Index != nil {
+		if err = json.Unmarshal(geometry.Data.Index.Array, &indices); err != nil {
+			err = errors.New("Error reading three.js JSON: invalid index array")
+			return
+		}
+	} else {
+		indices = make([]float64, vertex_count)
+		for i := range indices {
+			indices[i] = float64(i)
+		}
+	}
+	if len(indices)%3 != 0 {
+		err = errors.New("Error reading three.js JSON: index array has an incomplete triangle")
+		return
+	}
+
+	m = New(geometry.Name)
+	vertices := make([]VertexI, vertex_count)
+	for i := range vertices {
+		vertices[i] = m.AddVertex(positions[i*3], positions[i*3+1], positions[i*3+2])
+		if normals != nil {
+			vertices[i].SetNormal(&geom.Vec3{normals[i*3], normals[i*3+1], normals[i*3+2]})
+		}
+	}
+	for i := 0; i < len(indices); i += 3 {
+		var corners [3]int
+		for j := range corners {
+			corners[j] = int(indices[i+j])
+			if corners[j] < 0 || corners[j] >= vertex_count ||
+				float64(corners[j]) != indices[i+j] {
+				return nil, errors.New("Error reading three.js JSON: invalid index " +
+					strconv.FormatFloat(indices[i+j], 'f', -1, 64))
+			}
+		}
+		f := m.AddFace(vertices[corners[0]], vertices[corners[1]], vertices[corners[2]])
+		if uvs != nil {
+			var vts [3]*geom.Vec3
+			for j, corner := range corners {
+				vts[j] = &geom.Vec3{uvs[corner*2], uvs[corner*2+1], 0}
+			}
+			f.SetTexCoords(vts)
+		}
+	}
+	return
+}
+
+// Read a new mesh from three.js BufferGeometry JSON. Vertices are not merged,
+// so vertices which were split to carry different tex coords remain separate.
+func LoadThreeJS(json_reader *io.Reader) (m *Mesh, err error) {
+	data, err := io.ReadAll(*json_reader)
+	if err != nil {
+		return
+	}
+	return decodeThreeJS(data)
+}
+
+func ReadThreeJSFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	json_reader := io.Reader(input_file)
+	m, err = LoadThreeJS(&json_reader)
+	return
+}
+
+func sniffThreeJS(header []byte) bool {
+	trimmed := bytes.TrimSpace(header)
+	return bytes.HasPrefix(trimmed, []byte("{")) &&
+		bytes.Contains(trimmed, []byte(`"BufferGeometry"`))
+}
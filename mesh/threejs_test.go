@@ -0,0 +1,75 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/nat-n/geom"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Tests for WriteThreeJS and LoadThreeJS
+
+func TestThreeJSRoundTrip(t *testing.T) {
+	m := New("tri")
+	v0 := m.AddVertex(0, 0, 0)
+	v1 := m.AddVertex(1.23456, 0, 0)
+	v2 := m.AddVertex(0, 1.0/3, 0)
+	f := m.AddFace(v0, v1, v2)
+	m.Vertices.Each(func(v VertexI) { v.SetNormal(&geom.Vec3{0, 0, 1}) })
+	f.SetTexCoords([3]*geom.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}})
+
+	buf := new(bytes.Buffer)
+	if err := m.WriteThreeJS(buf, ThreeJSOptions{Precision: 2}); err != nil {
+		t.Fatal("Expected no error writing, got", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		`"type":"BufferGeometry"`, `"name":"tri"`,
+		`"array":[0,0,0,1.23,0,0,0,0.33,0]`, `"index":{"type":"Uint16Array"`,
+		`"uv":{"itemSize":2`, `"boundingSphere"`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Error("Expected output to contain", expected, "got", out)
+		}
+	}
+
+	r := io.Reader(buf)
+	m2, err := LoadThreeJS(&r)
+	if err != nil {
+		t.Fatal("Expected no error reading, got", err)
+	}
+	if m2.Name != "tri" || m2.Vertices.Len() != 3 || m2.Faces.Len() != 1 {
+		t.Fatal("Expected a named triangle, got", m2.Name, m2.Vertices.Len(),
+			m2.Faces.Len())
+	}
+	f2 := m2.Faces.Get(0)[0]
+	if f2.GetB().GetX() != 1.23 || *f2.GetB().GetNormal() != (geom.Vec3{0, 0, 1}) ||
+		*f2.GetTexCoords()[2] != (geom.Vec3{0, 1, 0}) {
+		t.Error("Expected positions, normals and uvs to be preserved")
+	}
+
+	// Mesh can be embedded directly in other JSON
+	data, err := json.Marshal(map[string]*Mesh{"mesh": m})
+	if err != nil {
+		t.Fatal("Expected no error marshalling, got", err)
+	}
+	decoded := map[string]*Mesh{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal("Expected no error unmarshalling, got", err)
+	}
+	if v := decoded["mesh"].Vertices.Get(2)[0]; v.GetY() != 1.0/3 {
+		t.Error("Expected full precision by default, got", v.GetY())
+	}
+}
+
+func TestLoadThreeJSNonIndexed(t *testing.T) {
+	r := io.Reader(strings.NewReader(`{"type":"BufferGeometry","data":{
+		"attributes":{"position":{"itemSize":3,"type":"Float32Array",
+		"array":[0,0,0,1,0,0,0,1,0,1,1,1,2,1,1,1,2,1]}}}}`))
+	m, err := LoadThreeJS(&r)
+	if err != nil || m.Vertices.Len() != 6 || m.Faces.Len() != 2 {
+		t.Error("Expected 6 vertices and 2 faces, got", m, err)
+	}
+}
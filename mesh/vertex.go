@@ -33,12 +33,13 @@ type VertexI interface {
 	Angle(geom.Vec3I) float64
 	LessThan(geom.Vec3I) bool
 	// Vertex methods
-	GetMeshLocation() (Mesh, int)
-	GetLocationInMesh(Mesh) int
-	SetLocationInMesh(Mesh, int)
+	GetMeshLocation() (*Mesh, int)
+	GetLocationInMesh(*Mesh) int
+	SetLocationInMesh(*Mesh, int)
+	ForgetLocationInMesh(*Mesh)
 	ForgetLocationInMeshByName(string)
-	OccursInMesh(Mesh) bool
-	EachMeshLocation(func(Mesh, int))
+	OccursInMesh(*Mesh) bool
+	EachMeshLocation(func(*Mesh, int))
 	CountOccurances() int
 	AddFace(fs ...FaceI) error
 	RemoveFace(FaceI) error
@@ -49,19 +50,28 @@ type VertexI interface {
 	GetNormal() *geom.Vec3
 	SetNormal(*geom.Vec3)
 	CalculateNormal()
+	GetColor() *Color
+	SetColor(*Color)
 	ToString() string
 	Validate() (err error)
 }
 
+// An RGBA color with components in the range [0, 1].
+type Color [4]float64
+
 type Vertex struct {
 	geom.Vec3
 	Faces  []FaceI
 	Normal *geom.Vec3
-	Meshes map[Mesh]int
+	Color  *Color
+	// The location of the vertex in each mesh it occurs in, keyed by the mesh's
+	// pointer so that vertices can be shared between meshes and meshes can be
+	// renamed or modified freely.
+	Meshes map[*Mesh]int
 }
 
-func MakeMeshesMap(m Mesh, i int) map[Mesh]int {
-	result := make(map[Mesh]int)
+func MakeMeshesMap(m *Mesh, i int) map[*Mesh]int {
+	result := make(map[*Mesh]int)
 	result[m] = i
 	return result
 }
@@ -75,7 +85,7 @@ func ConvertVertexSliceToVec3ISlice(input []VertexI) []geom.Vec3I {
 }
 
 // Assumes there is only one mesh, panic's otherwise
-func (v *Vertex) GetMeshLocation() (Mesh, int) {
+func (v *Vertex) GetMeshLocation() (*Mesh, int) {
 	if len(v.Meshes) != 1 {
 		panic("Cannot call GetMeshLocation() on Vertex that doesn't occur in" +
 			" exactly one mesh!")
@@ -86,22 +96,29 @@ func (v *Vertex) GetMeshLocation() (Mesh, int) {
 	panic("Unkown Error looking up Mesh and location in mesh of Vertex")
 }
 
-func (v *Vertex) GetLocationInMesh(m Mesh) int {
+func (v *Vertex) GetLocationInMesh(m *Mesh) int {
 	if v.OccursInMesh(m) {
 		return v.Meshes[m]
 	}
 	panic("No location is set for vertex " + v.ToString() + "in mesh " + m.GetName())
 }
 
-func (v *Vertex) SetLocationInMesh(m Mesh, i int) {
+func (v *Vertex) SetLocationInMesh(m *Mesh, i int) {
+	if v.Meshes == nil {
+		v.Meshes = make(map[*Mesh]int)
+	}
 	v.Meshes[m] = i
 }
 
-func (v *Vertex) OccursInMesh(m Mesh) bool {
+func (v *Vertex) OccursInMesh(m *Mesh) bool {
 	_, result := v.Meshes[m]
 	return result
 }
 
+func (v *Vertex) ForgetLocationInMesh(m *Mesh) {
+	delete(v.Meshes, m)
+}
+
 func (v *Vertex) ForgetLocationInMeshByName(mesh_name string) {
 	for m, _ := range v.Meshes {
 		if m.GetName() == mesh_name {
@@ -110,7 +127,7 @@ func (v *Vertex) ForgetLocationInMeshByName(mesh_name string) {
 	}
 }
 
-func (v *Vertex) EachMeshLocation(cb func(Mesh, int)) {
+func (v *Vertex) EachMeshLocation(cb func(*Mesh, int)) {
 	for m, i := range v.Meshes {
 		cb(m, i)
 	}
@@ -186,6 +203,23 @@ func (v *Vertex) CalculateNormal() {
 	v.Normal = &result
 }
 
+// Returns the average normal of the faces of a vertex, as CalculateNormal
+// would set, without setting it.
+func averageFaceNormal(v VertexI) geom.Vec3 {
+	acc := geom.Vec3{0, 0, 0}
+	face_count := 0
+	v.EachFace(func(f FaceI) {
+		t := f.AsTriangle()
+		n := t.Normal()
+		acc = acc.Add(geom.Vec3I(&n))
+		face_count++
+	})
+	return acc.DivideScalar(float64(face_count))
+}
+
+func (v *Vertex) GetColor() *Color  { return v.Color }
+func (v *Vertex) SetColor(c *Color) { v.Color = c }
+
 func (v *Vertex) ToString() string {
 	return "{Vertex " +
 		strconv.FormatFloat(v.X, 'f', -1, 64) + " " +
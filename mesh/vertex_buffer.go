@@ -0,0 +1,353 @@
+package mesh
+
+import (
+	"github.com/nat-n/geom"
+	"strconv"
+)
+
+import tb "github.com/nat-n/gomesh/triplebuffer"
+
+// A VertexCollection which stores the positions of its vertices contiguously
+// in a triplebuffer.VertexBuffer, in the order of the collection.
+// It can only hold BufferVertex views of its own, which are created with
+// NewVertex (or Mesh.AddVertex), and read and write their positions from the
+// buffer. Faces, normals, colors and mesh locations are kept on the views.
+// Vertices removed from the buffer keep their positions themselves, and can be
+// appended again.
+type VertexBuffer struct {
+	Positions tb.VertexBuffer
+	vertices  []*BufferVertex
+	// face buffers whose triangles index into this buffer
+	faces []*FaceBuffer
+}
+
+func NewVertexBuffer() *VertexBuffer {
+	return &VertexBuffer{Positions: tb.NewVertexBuffer()}
+}
+
+// Appends a new vertex at the given position, and returns it.
+func (vb *VertexBuffer) NewVertex(x, y, z float64) *BufferVertex {
+	v := &BufferVertex{
+		Vertex: Vertex{Faces: make([]FaceI, 0), Meshes: make(map[*Mesh]int)},
+		buffer: vb,
+		owner:  vb,
+		index:  len(vb.vertices),
+	}
+	vb.Positions.Append(x, y, z)
+	vb.vertices = append(vb.vertices, v)
+	return v
+}
+
+// Returns v as one of the buffer's own vertices, or panics.
+func (vb *VertexBuffer) own(v VertexI) *BufferVertex {
+	bv, ok := v.(*BufferVertex)
+	if !ok || (bv.buffer != vb && (bv.buffer != nil || bv.owner != vb)) {
+		panic("VertexBuffer can only hold vertices created by its NewVertex method")
+	}
+	return bv
+}
+
+func (vb *VertexBuffer) Len() int {
+	return len(vb.vertices)
+}
+
+func (vb *VertexBuffer) Get(indices ...int) (r []VertexI) {
+	for _, i := range indices {
+		r = append(r, vb.vertices[i])
+	}
+	return
+}
+
+// Puts the vertex at index i, in place of the vertex there. A vertex which
+// already occurs in the buffer keeps its position at its existing index. The
+// vertex replaced keeps its position itself unless it occurs elsewhere in the
+// buffer, and triangles of face buffers which used index i for it follow it.
+func (vb *VertexBuffer) Update(i int, v VertexI) {
+	bv := vb.own(v)
+	old := vb.vertices[i]
+	if old == bv {
+		return
+	}
+	x, y, z := bv.GetX(), bv.GetY(), bv.GetZ()
+	if old.buffer == vb && old.index == i {
+		moved := make([]int, len(vb.vertices))
+		for j := range moved {
+			moved[j] = j
+		}
+		moved[i] = -1
+		for j, other := range vb.vertices {
+			if other == old && j != i {
+				moved[i] = j
+				break
+			}
+		}
+		if moved[i] >= 0 {
+			old.index = moved[i]
+		} else {
+			old.Vec3 = old.position()
+			old.buffer = nil
+		}
+		for _, fb := range vb.faces {
+			fb.moveVertices(moved)
+		}
+	}
+	vb.vertices[i] = bv
+	vb.Positions.UpdateOne(i, x, y, z)
+	if bv.buffer == nil {
+		bv.buffer, bv.index = vb, i
+	}
+}
+
+func (vb *VertexBuffer) GetAll() []VertexI {
+	r := make([]VertexI, len(vb.vertices), len(vb.vertices))
+	for i, v := range vb.vertices {
+		r[i] = v
+	}
+	return r
+}
+
+// Appends vertices of the buffer again, such as ones which have been removed.
+func (vb *VertexBuffer) Append(vertices ...VertexI) {
+	for _, v := range vertices {
+		bv := vb.own(v)
+		vb.Positions.Append(bv.GetX(), bv.GetY(), bv.GetZ())
+		if bv.buffer == nil {
+			bv.buffer, bv.index = vb, len(vb.vertices)
+		}
+		vb.vertices = append(vb.vertices, bv)
+	}
+}
+
+// Removes the vertices at each index in turn, as VertexSlice does.
+func (vb *VertexBuffer) Remove(indices ...int) {
+	kept := append([]*BufferVertex{}, vb.vertices...)
+	for _, i := range indices {
+		kept = append(kept[:i], kept[i+1:]...)
+	}
+	vb.reindex(kept)
+}
+
+func (vb *VertexBuffer) Filter(cb func(VertexI) bool) {
+	kept := make([]*BufferVertex, 0)
+	for _, v := range vb.vertices {
+		if cb(v) {
+			kept = append(kept, v)
+		}
+	}
+	vb.reindex(kept)
+}
+
+// Rebuilds the buffer to hold the given vertices in order, updating the
+// indices of the vertices and of the triangles of face buffers which use them.
+func (vb *VertexBuffer) reindex(vertices []*BufferVertex) {
+	positions := make([]float64, 0, len(vertices)*3)
+	new_indices := make(map[*BufferVertex]int, len(vertices))
+	for i, v := range vertices {
+		positions = append(positions, v.GetX(), v.GetY(), v.GetZ())
+		if _, found := new_indices[v]; !found {
+			new_indices[v] = i
+		}
+	}
+
+	// where each of the old indices has moved to, or -1 if it was removed
+	moved := make([]int, len(vb.vertices))
+	for i, v := range vb.vertices {
+		if new_index, found := new_indices[v]; found {
+			moved[i] = new_index
+		} else {
+			moved[i] = -1
+			if v.buffer == vb {
+				v.Vec3 = v.position()
+				v.buffer = nil
+			}
+		}
+	}
+	for _, fb := range vb.faces {
+		fb.moveVertices(moved)
+	}
+
+	vb.Positions.Buffer = positions
+	vb.vertices = vertices
+	for v, i := range new_indices {
+		v.index = i
+	}
+}
+
+func (vb *VertexBuffer) Each(cb func(VertexI)) {
+	for _, v := range vb.vertices {
+		cb(v)
+	}
+}
+
+func (vb *VertexBuffer) EachWithIndex(cb func(int, VertexI)) {
+	for i, v := range vb.vertices {
+		cb(i, v)
+	}
+}
+
+func (vb *VertexBuffer) IsEmpty() bool {
+	return len(vb.vertices) == 0
+}
+
+func (vb *VertexBuffer) Average() geom.Vec3 {
+	return (&VertexSlice{vb.GetAll()}).Average()
+}
+
+func (vb *VertexBuffer) ToString() string {
+	return "{VertexBuffer " + vb.Positions.ToString() + "}"
+}
+
+func (vb *VertexBuffer) PositionsAsCSV() string {
+	return (&VertexSlice{vb.GetAll()}).PositionsAsCSV()
+}
+
+func (vb *VertexBuffer) NormalsAsCSV() string {
+	return (&VertexSlice{vb.GetAll()}).NormalsAsCSV()
+}
+
+// A vertex of a VertexBuffer, whose position is stored in the buffer rather
+// than in the embedded Vertex, which holds everything else. Once removed from
+// the buffer, its position is kept in the embedded Vertex instead.
+type BufferVertex struct {
+	Vertex
+	// the buffer holding the position, or nil once removed from it
+	buffer *VertexBuffer
+	owner  *VertexBuffer
+	index  int
+}
+
+// Returns the index of the vertex's position in its buffer, or -1 if it has
+// been removed from the buffer.
+func (v *BufferVertex) BufferIndex() int {
+	if v.buffer == nil {
+		return -1
+	}
+	return v.index
+}
+
+func (v *BufferVertex) position() geom.Vec3 {
+	if v.buffer == nil {
+		return v.Vec3
+	}
+	b := v.buffer.Positions.Buffer[v.index*3:]
+	return geom.Vec3{b[0], b[1], b[2]}
+}
+
+// Returns the x, y and z components of the vertex, in its buffer or in the
+// embedded Vertex.
+func (v *BufferVertex) components() (x, y, z *float64) {
+	if v.buffer == nil {
+		return &v.X, &v.Y, &v.Z
+	}
+	b := v.buffer.Positions.Buffer[v.index*3:]
+	return &b[0], &b[1], &b[2]
+}
+
+func (v *BufferVertex) GetX() float64 { x, _, _ := v.components(); return *x }
+func (v *BufferVertex) GetY() float64 { _, y, _ := v.components(); return *y }
+func (v *BufferVertex) GetZ() float64 { _, _, z := v.components(); return *z }
+
+func (v *BufferVertex) SetX(value float64) { x, _, _ := v.components(); *x = value }
+func (v *BufferVertex) SetY(value float64) { _, y, _ := v.components(); *y = value }
+func (v *BufferVertex) SetZ(value float64) { _, _, z := v.components(); *z = value }
+
+func (v *BufferVertex) Clone() geom.Vec3 { return v.position() }
+
+func (v *BufferVertex) Magnitude() float64 {
+	p := v.position()
+	return p.Magnitude()
+}
+
+func (v *BufferVertex) Normalized() geom.Vec3 {
+	p := v.position()
+	return p.Normalized()
+}
+
+func (v *BufferVertex) Inverse() geom.Vec3 {
+	p := v.position()
+	return p.Inverse()
+}
+
+func (v *BufferVertex) Add(o geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Add(o)
+}
+
+func (v *BufferVertex) Sum(os ...geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Sum(os...)
+}
+
+func (v *BufferVertex) Subtract(o geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Subtract(o)
+}
+
+func (v *BufferVertex) Multiply(o geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Multiply(o)
+}
+
+func (v *BufferVertex) Divide(o geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Divide(o)
+}
+
+func (v *BufferVertex) AddScalar(s float64) geom.Vec3 {
+	p := v.position()
+	return p.AddScalar(s)
+}
+
+func (v *BufferVertex) SubtractScalar(s float64) geom.Vec3 {
+	p := v.position()
+	return p.SubtractScalar(s)
+}
+
+func (v *BufferVertex) MultiplyScalar(s float64) geom.Vec3 {
+	p := v.position()
+	return p.MultiplyScalar(s)
+}
+
+func (v *BufferVertex) DivideScalar(s float64) geom.Vec3 {
+	p := v.position()
+	return p.DivideScalar(s)
+}
+
+func (v *BufferVertex) Mean(os ...geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.Mean(os...)
+}
+
+func (v *BufferVertex) CrossProd(o geom.Vec3I) geom.Vec3 {
+	p := v.position()
+	return p.CrossProd(o)
+}
+
+func (v *BufferVertex) DotProd(o geom.Vec3I) float64 {
+	p := v.position()
+	return p.DotProd(o)
+}
+
+func (v *BufferVertex) Angle(o geom.Vec3I) float64 {
+	p := v.position()
+	return p.Angle(o)
+}
+
+func (v *BufferVertex) LessThan(o geom.Vec3I) bool {
+	p := v.position()
+	return p.LessThan(o)
+}
+
+func (v *BufferVertex) GetLocationInMesh(m *Mesh) int {
+	if v.OccursInMesh(m) {
+		return v.Meshes[m]
+	}
+	panic("No location is set for vertex " + v.ToString() + "in mesh " + m.GetName())
+}
+
+func (v *BufferVertex) ToString() string {
+	return "{Vertex " +
+		strconv.FormatFloat(v.GetX(), 'f', -1, 64) + " " +
+		strconv.FormatFloat(v.GetY(), 'f', -1, 64) + " " +
+		strconv.FormatFloat(v.GetZ(), 'f', -1, 64) + "}"
+}
@@ -0,0 +1,1020 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Options controlling how legacy VTK and XML VTP files are written.
+type VTKOptions struct {
+	// Write the data arrays in binary rather than ASCII.
+	Binary bool
+}
+
+// A named array of per-vertex or per-face values in a VTK file.
+// Vertex and face attributes are written as arrays with as many components as
+// their type has, and label attributes as integer arrays. When reading, arrays
+// are read as attributes of the type with their number of components, or split
+// into an attribute per component if there is none. Corner attributes aren't
+// written.
+type vtkArray struct {
+	Name       string
+	Kind       string // "normals", "colors", "tcoords", or empty for any other data
+	Components int
+	Integer    bool // whether the values are stored as integers
+	Values     []float64
+}
+
+// The byte size of each VTK data type, by its name in XML files.
+var vtkTypeSizes = map[string]int{
+	"Int8": 1, "UInt8": 1, "Int16": 2, "UInt16": 2,
+	"Int32": 4, "UInt32": 4, "Int64": 8, "UInt64": 8,
+	"Float32": 4, "Float64": 8,
+}
+
+// The XML names of the data types used in legacy VTK files.
+var vtkLegacyTypes = map[string]string{
+	"char": "Int8", "unsigned_char": "UInt8",
+	"short": "Int16", "unsigned_short": "UInt16",
+	"int": "Int32", "unsigned_int": "UInt32",
+	"long": "Int64", "unsigned_long": "UInt64",
+	"vtkIdType": "Int32", "vtktypeint32": "Int32", "vtktypeuint32": "UInt32",
+	"vtktypeint64": "Int64", "vtktypeuint64": "UInt64",
+	"float": "Float32", "double": "Float64",
+}
+
+// Decodes binary values of the given (XML) data type.
+func decodeVTKValues(b []byte, data_type string, order binary.ByteOrder) (values []float64, err error) {
+	size, known := vtkTypeSizes[data_type]
+	if !known {
+		err = errors.New("Unsupported VTK data type: " + data_type)
+		return
+	}
+	values = make([]float64, len(b)/size)
+	for i := range values {
+		v := b[i*size : (i+1)*size]
+		switch data_type {
+		case "Int8":
+			values[i] = float64(int8(v[0]))
+		case "UInt8":
+			values[i] = float64(v[0])
+		case "Int16":
+			values[i] = float64(int16(order.Uint16(v)))
+		case "UInt16":
+			values[i] = float64(order.Uint16(v))
+		case "Int32":
+			values[i] = float64(int32(order.Uint32(v)))
+		case "UInt32":
+			values[i] = float64(order.Uint32(v))
+		case "Int64":
+			values[i] = float64(int64(order.Uint64(v)))
+		case "UInt64":
+			values[i] = float64(order.Uint64(v))
+		case "Float32":
+			values[i] = float64(math.Float32frombits(order.Uint32(v)))
+		case "Float64":
+			values[i] = math.Float64frombits(order.Uint64(v))
+		}
+	}
+	return
+}
+
+// Encodes values as binary values of the given (XML) data type, which must be
+// one of those written by gomesh.
+func encodeVTKValues(values []float64, data_type string, order binary.ByteOrder) []byte {
+	size := vtkTypeSizes[data_type]
+	b := make([]byte, len(values)*size)
+	for i, value := range values {
+		v := b[i*size : (i+1)*size]
+		switch data_type {
+		case "UInt8":
+			v[0] = uint8(value)
+		case "Int32":
+			order.PutUint32(v, uint32(int32(value)))
+		case "Int64":
+			order.PutUint64(v, uint64(int64(value)))
+		case "Float64":
+			order.PutUint64(v, math.Float64bits(value))
+		}
+	}
+	return b
+}
+
+// Collects the vertex or face attributes with the given names and types as
+// arrays of count tuples, where value returns the value of attribute a for the
+// i-th vertex or face. Consecutive scalar attributes named after the
+// components of a type, such as "<name>_x", "<name>_y" and "<name>_z", are
+// written as a single array called <name>. Missing values are written as NaN.
+func vtkAttributeArrays(count int, names []string, types []AttributeType, value func(a, i int) ([]float64, bool)) (arrays []*vtkArray) {
+	groups, array_names, _ := groupAttributeComponents(names)
+	for i, group := range groups {
+		scalars := true
+		for _, a := range group {
+			scalars = scalars && types[a] == ScalarAttribute
+		}
+		if len(group) > 1 && !scalars {
+			for _, a := range group {
+				arrays = append(arrays, vtkAttributeArray(count, names[a], types[a],
+					[]int{a}, value))
+			}
+			continue
+		}
+		arrays = append(arrays, vtkAttributeArray(count, array_names[i],
+			types[group[0]], group, value))
+	}
+	return
+}
+
+// Collects one or more attributes as a single array.
+func vtkAttributeArray(count int, name string, t AttributeType, group []int, value func(a, i int) ([]float64, bool)) *vtkArray {
+	components := t.Components()
+	if len(group) > 1 {
+		components = len(group)
+	}
+	arr := &vtkArray{Name: name, Components: components,
+		Integer: t == LabelAttribute && len(group) == 1,
+		Values:  make([]float64, 0, count*components)}
+	for i := 0; i < count; i++ {
+		for _, a := range group {
+			tuple, found := value(a, i)
+			for c := 0; c < components/len(group); c++ {
+				if found && c < len(tuple) {
+					arr.Values = append(arr.Values, tuple[c])
+				} else {
+					arr.Values = append(arr.Values, math.NaN())
+				}
+			}
+		}
+	}
+	return arr
+}
+
+// Returns the type of attribute an array is read as, from its number of
+// components, or false if it has to be split into an attribute per component.
+// VTK doesn't distinguish tangents, so four component arrays are read as
+// colors.
+func vtkAttributeType(arr *vtkArray) (AttributeType, bool) {
+	switch arr.Components {
+	case 1:
+		if arr.Integer {
+			return LabelAttribute, true
+		}
+		return ScalarAttribute, true
+	case 2:
+		return TexCoordAttribute, true
+	case 3:
+		return VectorAttribute, true
+	case 4:
+		return ColorAttribute, true
+	}
+	return ScalarAttribute, false
+}
+
+// The most components an array read from a VTK file can have, so that a
+// corrupt count can't split an empty array into countless attributes.
+const maxVTKComponents = 1 << 10
+
+// Returns the names of the attributes an array with more components than any
+// attribute type is split into.
+func vtkComponentNames(arr *vtkArray) []string {
+	names := make([]string, arr.Components)
+	for i := range names {
+		names[i] = arr.Name + "_" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// Collects the per-vertex data of a mesh to be written to a VTK file.
+// Normals are written if every vertex has one, colors if any vertex has one,
+// and texture coordinates if any face has them.
+func vtkPointArrays(m *Mesh) (arrays []*vtkArray) {
+	count := m.Vertices.Len()
+	has_normals := count > 0
+	has_colors := false
+	m.Vertices.Each(func(v VertexI) {
+		has_normals = has_normals && v.GetNormal() != nil
+		has_colors = has_colors || v.GetColor() != nil
+	})
+	if has_normals {
+		normals := &vtkArray{Name: "Normals", Kind: "normals", Components: 3,
+			Values: make([]float64, 0, count*3)}
+		m.Vertices.Each(func(v VertexI) {
+			n := v.GetNormal()
+			normals.Values = append(normals.Values, n.GetX(), n.GetY(), n.GetZ())
+		})
+		arrays = append(arrays, normals)
+	}
+	if has_colors {
+		colors := &vtkArray{Name: "Colors", Kind: "colors", Components: 4,
+			Values: make([]float64, 0, count*4)}
+		m.Vertices.Each(func(v VertexI) {
+			c := v.GetColor()
+			if c == nil {
+				c = &Color{1, 1, 1, 1}
+			}
+			colors.Values = append(colors.Values, c[:]...)
+		})
+		arrays = append(arrays, colors)
+	}
+	vertices := m.Vertices.GetAll()
+	if tex_coords := vertexTexCoords(vertices, m.Faces); tex_coords != nil {
+		tcoords := &vtkArray{Name: "TCoords", Kind: "tcoords", Components: 2,
+			Values: make([]float64, 0, count*2)}
+		for _, vt := range tex_coords {
+			if vt == nil {
+				vt = &geom.Vec3{}
+			}
+			tcoords.Values = append(tcoords.Values, vt.X, vt.Y)
+		}
+		arrays = append(arrays, tcoords)
+	}
+	if m.Attributes == nil {
+		return
+	}
+
+	names := make([]string, len(m.Attributes.Vertex))
+	types := make([]AttributeType, len(m.Attributes.Vertex))
+	for i, attr := range m.Attributes.Vertex {
+		names[i], types[i] = attr.Name, attr.Type
+	}
+	arrays = append(arrays, vtkAttributeArrays(count, names, types,
+		func(a, i int) ([]float64, bool) {
+			return m.Attributes.Vertex[a].Get(vertices[i])
+		})...)
+	return
+}
+
+// Collects the per-face data of a mesh to be written to a VTK file.
+// Normals are written if every face has one.
+func vtkCellArrays(m *Mesh) (arrays []*vtkArray) {
+	count := m.Faces.Len()
+	has_normals := count > 0
+	m.Faces.Each(func(f FaceI) {
+		has_normals = has_normals && f.GetNormal() != nil
+	})
+	if has_normals {
+		normals := &vtkArray{Name: "Normals", Kind: "normals", Components: 3,
+			Values: make([]float64, 0, count*3)}
+		m.Faces.Each(func(f FaceI) {
+			n := f.GetNormal()
+			normals.Values = append(normals.Values, n.GetX(), n.GetY(), n.GetZ())
+		})
+		arrays = append(arrays, normals)
+	}
+	if m.Attributes == nil {
+		return
+	}
+
+	names := make([]string, len(m.Attributes.Face))
+	types := make([]AttributeType, len(m.Attributes.Face))
+	for i, attr := range m.Attributes.Face {
+		names[i], types[i] = attr.Name, attr.Type
+	}
+	faces := m.Faces.GetAll()
+	arrays = append(arrays, vtkAttributeArrays(count, names, types,
+		func(a, i int) ([]float64, bool) {
+			return m.Attributes.Face[a].Get(faces[i])
+		})...)
+	return
+}
+
+// Returns the point positions and polygon connectivity of a mesh.
+func vtkGeometry(m *Mesh) (points []float64, connectivity []float64) {
+	points = make([]float64, 0, m.Vertices.Len()*3)
+	vert_lookup := make(map[VertexI]int)
+	m.Vertices.EachWithIndex(func(i int, v VertexI) {
+		vert_lookup[v] = i
+		points = append(points, v.GetX(), v.GetY(), v.GetZ())
+	})
+	connectivity = make([]float64, 0, m.Faces.Len()*3)
+	m.Faces.Each(func(f FaceI) {
+		f.EachVertex(func(v VertexI) {
+			connectivity = append(connectivity, float64(vert_lookup[v]))
+		})
+	})
+	return
+}
+
+// The cell types of VTK polydata, in the order cell data is given for them.
+const (
+	vtkVerts = iota
+	vtkLines
+	vtkPolys
+	vtkStrips
+)
+
+// Adds the points and cells read from a VTK file to the mesh, triangulating
+// polygons as a fan and triangle strips in alternating order. Returns the new
+// vertices and the faces created for each cell, in cell data order.
+func buildVTKMesh(m *Mesh, points []float64, cells [4][][]int) (vertices []VertexI, cell_faces [][]FaceI, err error) {
+	vertices = make([]VertexI, len(points)/3)
+	for i := range vertices {
+		vertices[i] = m.AddVertex(points[i*3], points[i*3+1], points[i*3+2])
+	}
+	for cell_type, type_cells := range cells {
+		for _, cell := range type_cells {
+			for _, index := range cell {
+				if index < 0 || index >= len(vertices) {
+					err = errors.New("Error reading VTK cells: reference to undefined point " +
+						strconv.Itoa(index))
+					return
+				}
+			}
+			faces := []FaceI{}
+			switch cell_type {
+			case vtkPolys:
+				for j := 2; j < len(cell); j++ {
+					faces = append(faces, m.AddFace(vertices[cell[0]],
+						vertices[cell[j-1]], vertices[cell[j]]))
+				}
+			case vtkStrips:
+				for j := 2; j < len(cell); j++ {
+					a, b, c := cell[j-2], cell[j-1], cell[j]
+					if a == b || b == c || a == c {
+						continue // degenerate triangles join strips
+					}
+					if j%2 == 1 {
+						a, b = b, a
+					}
+					faces = append(faces, m.AddFace(vertices[a], vertices[b],
+						vertices[c]))
+				}
+			}
+			cell_faces = append(cell_faces, faces)
+		}
+	}
+	return
+}
+
+// Applies an array of per-point values read from a VTK file to the vertices
+// of a mesh.
+func applyVTKPointArray(m *Mesh, vertices []VertexI, arr *vtkArray) error {
+	if arr.Components < 1 || arr.Components > maxVTKComponents {
+		return errors.New("Error reading VTK point data: array " + arr.Name +
+			" has an invalid number of components")
+	}
+	if len(arr.Values) != len(vertices)*arr.Components {
+		return errors.New("Error reading VTK point data: array " + arr.Name +
+			" has the wrong number of values")
+	}
+	if arr.Kind == "normals" && arr.Components == 3 {
+		for i, v := range vertices {
+			v.SetNormal(&geom.Vec3{arr.Values[i*3], arr.Values[i*3+1],
+				arr.Values[i*3+2]})
+		}
+		return nil
+	}
+	if arr.Kind == "colors" && (arr.Components == 3 || arr.Components == 4) {
+		for i, v := range vertices {
+			color := Color{1, 1, 1, 1}
+			copy(color[:], arr.Values[i*arr.Components:(i+1)*arr.Components])
+			v.SetColor(&color)
+		}
+		return nil
+	}
+	if arr.Kind == "tcoords" && arr.Components <= 3 {
+		tex_coords := make([]*geom.Vec3, len(vertices))
+		for i := range vertices {
+			components := [3]float64{}
+			copy(components[:], arr.Values[i*arr.Components:(i+1)*arr.Components])
+			tex_coords[i] = &geom.Vec3{components[0], components[1], components[2]}
+		}
+		setVertexTexCoords(vertices, tex_coords)
+		return nil
+	}
+	if t, typed := vtkAttributeType(arr); typed {
+		attr := m.Attributes.AddVertexAttribute(arr.Name, t)
+		for i, v := range vertices {
+			if value := arr.Values[i*arr.Components : (i+1)*arr.Components]; !math.IsNaN(value[0]) {
+				attr.Set(v, value...)
+			}
+		}
+		return nil
+	}
+	for c, name := range vtkComponentNames(arr) {
+		attr := m.Attributes.AddVertexAttribute(name)
+		for i, v := range vertices {
+			if value := arr.Values[i*arr.Components+c]; !math.IsNaN(value) {
+				attr.Values[v] = value
+			}
+		}
+	}
+	return nil
+}
+
+// Applies an array of per-cell values read from a VTK file to the faces each
+// cell was triangulated into.
+func applyVTKCellArray(m *Mesh, cell_faces [][]FaceI, arr *vtkArray) error {
+	if arr.Components < 1 || arr.Components > maxVTKComponents {
+		return errors.New("Error reading VTK cell data: array " + arr.Name +
+			" has an invalid number of components")
+	}
+	if len(arr.Values) != len(cell_faces)*arr.Components {
+		return errors.New("Error reading VTK cell data: array " + arr.Name +
+			" has the wrong number of values")
+	}
+	if arr.Kind == "normals" && arr.Components == 3 {
+		for i, faces := range cell_faces {
+			for _, f := range faces {
+				f.SetNormal(&geom.Vec3{arr.Values[i*3], arr.Values[i*3+1],
+					arr.Values[i*3+2]})
+			}
+		}
+		return nil
+	}
+	if t, typed := vtkAttributeType(arr); typed {
+		attr := m.Attributes.AddFaceAttribute(arr.Name, t)
+		for i, faces := range cell_faces {
+			if value := arr.Values[i*arr.Components : (i+1)*arr.Components]; !math.IsNaN(value[0]) {
+				for _, f := range faces {
+					attr.Set(f, value...)
+				}
+			}
+		}
+		return nil
+	}
+	for c, name := range vtkComponentNames(arr) {
+		attr := m.Attributes.AddFaceAttribute(name)
+		for i, faces := range cell_faces {
+			if value := arr.Values[i*arr.Components+c]; !math.IsNaN(value) {
+				for _, f := range faces {
+					attr.Values[f] = value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Names in legacy VTK files can't contain whitespace, which is percent encoded.
+var (
+	vtkNameEncoder = strings.NewReplacer("%", "%25", " ", "%20", "\t", "%09")
+	vtkNameDecoder = strings.NewReplacer("%25", "%", "%20", " ", "%09", "\t")
+)
+
+// Reads the keyword lines and data of a legacy VTK file.
+type vtkLegacyReader struct {
+	reader  *bufio.Reader
+	binary  bool
+	line_no int
+}
+
+// Reads the next line, without its line ending.
+func (r *vtkLegacyReader) Line() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	r.line_no++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Returns the words of the next line which isn't blank, skipping metadata.
+func (r *vtkLegacyReader) Fields() (words []string, err error) {
+	for {
+		var line string
+		if line, err = r.Line(); err != nil {
+			return
+		}
+		words = strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "METADATA" {
+			// metadata continues until a blank line
+			for {
+				if line, err = r.Line(); err != nil {
+					return
+				}
+				if strings.TrimSpace(line) == "" {
+					break
+				}
+			}
+			continue
+		}
+		return
+	}
+}
+
+// Skips whitespace, and returns the next word (of up to 64 bytes) without
+// consuming it.
+func (r *vtkLegacyReader) PeekWord() string {
+	for {
+		b, err := r.reader.Peek(1)
+		if err != nil {
+			return ""
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		if b[0] == '\n' {
+			r.line_no++
+		}
+		r.reader.ReadByte()
+	}
+	word := []byte{}
+	for i := 1; ; i++ {
+		b, err := r.reader.Peek(i)
+		if err != nil || i > 64 || b[i-1] == ' ' || b[i-1] == '\t' ||
+			b[i-1] == '\r' || b[i-1] == '\n' {
+			return string(word)
+		}
+		word = b
+	}
+}
+
+// Reads count tuples of the given number of components of the given legacy
+// data type. Values are read a chunk at a time, so a count larger than the
+// data in the file results in a ParseError rather than a huge allocation.
+func (r *vtkLegacyReader) Values(count, components int, legacy_type string) (values []float64, err error) {
+	data_type, known := vtkLegacyTypes[legacy_type]
+	total, valid := readValueCount(count, components)
+	if !known || !valid {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+	values = make([]float64, 0, readChunkSize(total))
+	if r.binary {
+		size := vtkTypeSizes[data_type]
+		for len(values) < total {
+			b := make([]byte, readChunkSize(total-len(values))*size)
+			if _, err = io.ReadFull(r.reader, b); err != nil {
+				return nil, &ParseError{Format: "VTK", Line: r.line_no, Err: io.ErrUnexpectedEOF}
+			}
+			var chunk []float64
+			if chunk, err = decodeVTKValues(b, data_type, binary.BigEndian); err != nil {
+				return
+			}
+			values = append(values, chunk...)
+		}
+		return
+	}
+
+	for len(values) < total {
+		word := r.PeekWord()
+		if word == "" {
+			return nil, &ParseError{Format: "VTK", Line: r.line_no, Err: io.ErrUnexpectedEOF}
+		}
+		r.reader.Discard(len(word))
+		var value float64
+		if value, err = strconv.ParseFloat(word, 64); err != nil {
+			err = newParseError("VTK", r.line_no)
+			return
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Reads the cells following a VERTICES, LINES, POLYGONS or TRIANGLE_STRIPS
+// keyword, in either the classic layout or the OFFSETS and CONNECTIVITY layout
+// introduced in version 5.1.
+func (r *vtkLegacyReader) Cells(words []string) (cells [][]int, err error) {
+	if len(words) != 3 {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+	count, cErr := strconv.Atoi(words[1])
+	size, sErr := strconv.Atoi(words[2])
+	if cErr != nil || sErr != nil || count < 0 || size < 0 {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+
+	if r.PeekWord() == "OFFSETS" {
+		var offsets, connectivity []float64
+		if words, err = r.Fields(); err != nil || len(words) != 2 {
+			return nil, newParseError("VTK", r.line_no)
+		}
+		if offsets, err = r.Values(count, 1, words[1]); err != nil {
+			return
+		}
+		if words, err = r.Fields(); err != nil || len(words) != 2 ||
+			words[0] != "CONNECTIVITY" {
+			return nil, newParseError("VTK", r.line_no)
+		}
+		if connectivity, err = r.Values(size, 1, words[1]); err != nil {
+			return
+		}
+		for i := 1; i < len(offsets); i++ {
+			start, end := int(offsets[i-1]), int(offsets[i])
+			if start < 0 || end < start || end > len(connectivity) {
+				return nil, newParseError("VTK", r.line_no)
+			}
+			cells = append(cells, floatsToInts(connectivity[start:end]))
+		}
+		return
+	}
+
+	values, err := r.Values(size, 1, "int")
+	if err != nil {
+		return
+	}
+	for i := 0; len(cells) < count; {
+		if i >= len(values) {
+			return nil, newParseError("VTK", r.line_no)
+		}
+		n := int(values[i])
+		if n < 0 || i+1+n > len(values) {
+			return nil, newParseError("VTK", r.line_no)
+		}
+		cells = append(cells, floatsToInts(values[i+1:i+1+n]))
+		i += 1 + n
+	}
+	return
+}
+
+func floatsToInts(values []float64) []int {
+	ints := make([]int, len(values))
+	for i, value := range values {
+		ints[i] = int(value)
+	}
+	return ints
+}
+
+// Read a new mesh from a legacy VTK file containing POLYDATA, in ASCII or
+// binary. Polygons and triangle strips become faces, while vertices and lines
+// are ignored. Point and cell data named Normals (or given as NORMALS), and
+// point COLOR_SCALARS and TEXTURE_COORDINATES, are read as normals, colors and
+// the texture coordinates of faces, and all other scalar, vector, tensor and
+// field data arrays as vertex or face attributes.
+func LoadVTK(vtk_reader *io.Reader) (m *Mesh, err error) {
+	r := &vtkLegacyReader{reader: bufio.NewReader(*vtk_reader)}
+	line, err := r.Line()
+	if err != nil || !strings.HasPrefix(line, "# vtk DataFile") {
+		err = errors.New("Error parsing VTK file: missing VTK header")
+		return
+	}
+	title, err := r.Line()
+	if err != nil {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+	words, err := r.Fields()
+	if err != nil || len(words) != 1 || (words[0] != "ASCII" && words[0] != "BINARY") {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+	r.binary = words[0] == "BINARY"
+	words, err = r.Fields()
+	if err != nil || len(words) != 2 || words[0] != "DATASET" {
+		err = newParseError("VTK", r.line_no)
+		return
+	}
+	if words[1] != "POLYDATA" {
+		err = errors.New("Error parsing VTK file: unsupported dataset type " +
+			words[1] + ", only POLYDATA can be read")
+		return
+	}
+
+	var (
+		points      []float64
+		cells       [4][][]int
+		point_data  []*vtkArray
+		cell_data   []*vtkArray
+		association *[]*vtkArray
+		data_count  int
+	)
+	cellTypes := map[string]int{
+		"VERTICES": vtkVerts, "LINES": vtkLines,
+		"POLYGONS": vtkPolys, "TRIANGLE_STRIPS": vtkStrips,
+	}
+	// Reads an array of data_count tuples of the given size, adding it to the
+	// current point or cell data.
+	readArray := func(name, kind string, components int, legacy_type string) error {
+		values, err := r.Values(data_count, components, legacy_type)
+		if err != nil {
+			return err
+		}
+		if kind == "colors" && r.binary {
+			for i := range values {
+				values[i] /= 255
+			}
+		}
+		if association != nil {
+			*association = append(*association, &vtkArray{
+				Name: vtkNameDecoder.Replace(name), Kind: kind,
+				Components: components, Values: values,
+				Integer: strings.Contains(vtkLegacyTypes[legacy_type], "Int"),
+			})
+		}
+		return nil
+	}
+
+	for {
+		words, err = r.Fields()
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		keyword := strings.ToUpper(words[0])
+		if cell_type, is_cells := cellTypes[keyword]; is_cells {
+			var type_cells [][]int
+			if type_cells, err = r.Cells(words); err != nil {
+				return
+			}
+			cells[cell_type] = append(cells[cell_type], type_cells...)
+			continue
+		}
+
+		switch keyword {
+		case "POINTS":
+			var count int
+			if len(words) != 3 {
+				err = newParseError("VTK", r.line_no)
+			} else if count, err = strconv.Atoi(words[1]); err != nil {
+				err = newParseError("VTK", r.line_no)
+			} else {
+				points, err = r.Values(count, 3, words[2])
+			}
+		case "POINT_DATA", "CELL_DATA":
+			if len(words) != 2 {
+				err = newParseError("VTK", r.line_no)
+			} else if data_count, err = strconv.Atoi(words[1]); err != nil {
+				err = newParseError("VTK", r.line_no)
+			} else if keyword == "POINT_DATA" {
+				association = &point_data
+			} else {
+				association = &cell_data
+			}
+		case "SCALARS":
+			components := 1
+			if len(words) == 4 {
+				components, err = strconv.Atoi(words[3])
+			}
+			if err != nil || len(words) < 3 || len(words) > 4 ||
+				components < 1 || components > 4 {
+				err = newParseError("VTK", r.line_no)
+				break
+			}
+			// the lookup table is optional in ASCII files
+			if r.binary || r.PeekWord() == "LOOKUP_TABLE" {
+				if _, err = r.Fields(); err != nil {
+					break
+				}
+			}
+			err = readArray(words[1], "", components, words[2])
+		case "COLOR_SCALARS":
+			components := 0
+			if len(words) == 3 {
+				components, err = strconv.Atoi(words[2])
+			}
+			if err != nil || len(words) != 3 || components < 1 || components > 4 {
+				err = newParseError("VTK", r.line_no)
+				break
+			}
+			data_type := "float"
+			if r.binary {
+				data_type = "unsigned_char"
+			}
+			kind := "colors"
+			if association == &cell_data {
+				kind = ""
+			}
+			err = readArray(words[1], kind, components, data_type)
+		case "VECTORS", "NORMALS", "TENSORS":
+			if len(words) != 3 {
+				err = newParseError("VTK", r.line_no)
+				break
+			}
+			kind := ""
+			if keyword == "NORMALS" {
+				kind = "normals"
+			}
+			components := 3
+			if keyword == "TENSORS" {
+				components = 9
+			}
+			err = readArray(words[1], kind, components, words[2])
+		case "TEXTURE_COORDINATES":
+			components := 0
+			if len(words) == 4 {
+				components, err = strconv.Atoi(words[2])
+			}
+			if err != nil || len(words) != 4 || components < 1 || components > 3 {
+				err = newParseError("VTK", r.line_no)
+				break
+			}
+			err = readArray(words[1], "tcoords", components, words[3])
+		case "LOOKUP_TABLE":
+			var size int
+			if len(words) != 3 {
+				err = newParseError("VTK", r.line_no)
+			} else if size, err = strconv.Atoi(words[2]); err != nil {
+				err = newParseError("VTK", r.line_no)
+			} else if r.binary {
+				if bytes, valid := readValueCount(size, 4); !valid {
+					err = newParseError("VTK", r.line_no)
+				} else {
+					_, err = r.reader.Discard(bytes)
+				}
+			} else {
+				_, err = r.Values(size, 4, "float")
+			}
+		case "FIELD":
+			var array_count int
+			if len(words) != 3 {
+				err = newParseError("VTK", r.line_no)
+				break
+			} else if array_count, err = strconv.Atoi(words[2]); err != nil {
+				err = newParseError("VTK", r.line_no)
+				break
+			}
+			for i := 0; i < array_count && err == nil; i++ {
+				var components, count int
+				if words, err = r.Fields(); err != nil {
+					break
+				}
+				if len(words) != 4 {
+					err = newParseError("VTK", r.line_no)
+					break
+				}
+				components, err = strconv.Atoi(words[1])
+				if err == nil {
+					count, err = strconv.Atoi(words[2])
+				}
+				if err != nil || components < 1 || components > maxVTKComponents ||
+					(association != nil && count != data_count) {
+					err = newParseError("VTK", r.line_no)
+					break
+				}
+				if association == nil {
+					// field data of the whole dataset is skipped
+					_, err = r.Values(count, components, words[3])
+				} else {
+					err = readArray(words[0], "", components, words[3])
+				}
+			}
+		default:
+			err = newParseError("VTK", r.line_no)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+	}
+
+	m = New(title)
+	vertices, cell_faces, err := buildVTKMesh(m, points, cells)
+	if err != nil {
+		return nil, err
+	}
+	for _, arr := range point_data {
+		if err = applyVTKPointArray(m, vertices, arr); err != nil {
+			return nil, err
+		}
+	}
+	for _, arr := range cell_data {
+		if err = applyVTKCellArray(m, cell_faces, arr); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func ReadVTKFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	vtk_reader := io.Reader(input_file)
+	m, err = LoadVTK(&vtk_reader)
+	return
+}
+
+// Writes the keyword lines and data of a legacy VTK file.
+type vtkLegacyWriter struct {
+	writer *bufio.Writer
+	binary bool
+}
+
+func (w *vtkLegacyWriter) Line(line string) {
+	w.writer.WriteString(line + "\n")
+}
+
+// Writes values of the given legacy data type, as lines of the given number of
+// values in ASCII files.
+func (w *vtkLegacyWriter) Values(values []float64, legacy_type string, per_line int) {
+	if w.binary {
+		w.writer.Write(encodeVTKValues(values, vtkLegacyTypes[legacy_type],
+			binary.BigEndian))
+		w.writer.WriteByte('\n')
+		return
+	}
+	for i, value := range values {
+		w.writer.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		if (i+1)%per_line == 0 || i == len(values)-1 {
+			w.writer.WriteByte('\n')
+		} else {
+			w.writer.WriteByte(' ')
+		}
+	}
+}
+
+// Writes point or cell data arrays.
+func (w *vtkLegacyWriter) Arrays(arrays []*vtkArray) {
+	for _, arr := range arrays {
+		name := vtkNameEncoder.Replace(arr.Name)
+		switch {
+		case arr.Kind == "normals":
+			w.Line("NORMALS " + name + " double")
+			w.Values(arr.Values, "double", 3)
+		case arr.Kind == "tcoords":
+			w.Line("TEXTURE_COORDINATES " + name + " " +
+				strconv.Itoa(arr.Components) + " double")
+			w.Values(arr.Values, "double", arr.Components)
+		case arr.Kind == "colors":
+			w.Line("COLOR_SCALARS " + name + " " + strconv.Itoa(arr.Components))
+			if w.binary {
+				bytes := make([]float64, len(arr.Values))
+				for i, value := range arr.Values {
+					bytes[i] = math.Floor(math.Max(0, math.Min(1, value))*255 + 0.5)
+				}
+				w.Values(bytes, "unsigned_char", arr.Components)
+			} else {
+				w.Values(arr.Values, "double", arr.Components)
+			}
+		case arr.Components == 3:
+			w.Line("VECTORS " + name + " double")
+			w.Values(arr.Values, "double", 3)
+		case arr.Integer:
+			w.Line("SCALARS " + name + " int " + strconv.Itoa(arr.Components))
+			w.Line("LOOKUP_TABLE default")
+			w.Values(arr.Values, "int", arr.Components)
+		default:
+			w.Line("SCALARS " + name + " double " + strconv.Itoa(arr.Components))
+			w.Line("LOOKUP_TABLE default")
+			w.Values(arr.Values, "double", arr.Components)
+		}
+	}
+}
+
+// Write mesh as a legacy VTK POLYDATA file, in ASCII unless the options ask
+// for binary. The mesh's name is used as the title, and its normals, colors,
+// texture coordinates and attributes are written as point and cell data.
+func (m *Mesh) WriteVTK(vtk_writer io.Writer, opts ...VTKOptions) (err error) {
+	options := VTKOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	w := &vtkLegacyWriter{writer: bufio.NewWriter(vtk_writer), binary: options.Binary}
+
+	w.Line("# vtk DataFile Version 3.0")
+	w.Line(strings.Replace(m.Name, "\n", " ", -1))
+	if options.Binary {
+		w.Line("BINARY")
+	} else {
+		w.Line("ASCII")
+	}
+	w.Line("DATASET POLYDATA")
+
+	points, connectivity := vtkGeometry(m)
+	w.Line("POINTS " + strconv.Itoa(m.Vertices.Len()) + " double")
+	w.Values(points, "double", 3)
+
+	face_count := m.Faces.Len()
+	polygons := make([]float64, 0, face_count*4)
+	for i := 0; i < face_count; i++ {
+		polygons = append(polygons, 3)
+		polygons = append(polygons, connectivity[i*3:i*3+3]...)
+	}
+	w.Line("POLYGONS " + strconv.Itoa(face_count) + " " + strconv.Itoa(face_count*4))
+	w.Values(polygons, "int", 4)
+
+	if point_arrays := vtkPointArrays(m); len(point_arrays) > 0 {
+		w.Line("POINT_DATA " + strconv.Itoa(m.Vertices.Len()))
+		w.Arrays(point_arrays)
+	}
+	if cell_arrays := vtkCellArrays(m); len(cell_arrays) > 0 {
+		w.Line("CELL_DATA " + strconv.Itoa(face_count))
+		w.Arrays(cell_arrays)
+	}
+	err = w.writer.Flush()
+	return
+}
+
+func (m *Mesh) WriteVTKFile(output_path string, opts ...VTKOptions) (err error) {
+	err = writeFile(output_path, func(w io.Writer) error {
+		return m.WriteVTK(w, opts...)
+	})
+	return
+}
+
+func sniffVTK(header []byte) bool {
+	return strings.HasPrefix(string(header), "# vtk DataFile")
+}
@@ -0,0 +1,220 @@
+package mesh
+
+import (
+	"bytes"
+	"github.com/nat-n/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Tests for LoadVTK, WriteVTK, LoadVTP and WriteVTP
+
+// Returns a quad with normals, colors, texture coordinates, and scalar and
+// vector attributes.
+func vtkTestMesh() *Mesh {
+	m := New("quad")
+	v0 := m.AddVertex(0, 0, 0)
+	v1 := m.AddVertex(1, 0, 0)
+	v2 := m.AddVertex(1, 1, 0)
+	v3 := m.AddVertex(0, 1, 0)
+	f0 := m.AddFace(v0, v1, v2)
+	f1 := m.AddFace(v0, v2, v3)
+	for i, v := range m.Vertices.GetAll() {
+		v.SetNormal(&geom.Vec3{0, 0, 1})
+		v.SetColor(&Color{float64(i) / 3, 0, 1, 1})
+	}
+	m.Faces.Each(func(f FaceI) {
+		f.SetTexCoords([3]*geom.Vec3{
+			&geom.Vec3{f.GetA().GetX(), f.GetA().GetY(), 0},
+			&geom.Vec3{f.GetB().GetX(), f.GetB().GetY(), 0},
+			&geom.Vec3{f.GetC().GetX(), f.GetC().GetY(), 0},
+		})
+	})
+	curvature := m.Attributes.AddVertexAttribute("mean curvature")
+	curvature.Values[v0] = 0.5
+	curvature.Values[v2] = -2
+	for i, name := range []string{"flow_x", "flow_y", "flow_z"} {
+		m.Attributes.AddVertexAttribute(name).Values[v1] = float64(i + 1)
+	}
+	thickness := m.Attributes.AddFaceAttribute("thickness")
+	thickness.Values[f0] = 0.25
+	thickness.Values[f1] = 4
+	return m
+}
+
+func TestVTKRoundTrip(t *testing.T) {
+	type codec struct {
+		name  string
+		write func(*Mesh, io.Writer) error
+		load  func(*io.Reader) (*Mesh, error)
+	}
+	codecs := []codec{
+		{"vtk ascii", func(m *Mesh, w io.Writer) error { return m.WriteVTK(w) }, LoadVTK},
+		{"vtk binary", func(m *Mesh, w io.Writer) error {
+			return m.WriteVTK(w, VTKOptions{Binary: true})
+		}, LoadVTK},
+		{"vtp ascii", func(m *Mesh, w io.Writer) error { return m.WriteVTP(w) }, LoadVTP},
+		{"vtp binary", func(m *Mesh, w io.Writer) error {
+			return m.WriteVTP(w, VTKOptions{Binary: true})
+		}, LoadVTP},
+	}
+	for _, c := range codecs {
+		buf := new(bytes.Buffer)
+		if err := c.write(vtkTestMesh(), buf); err != nil {
+			t.Error("For", c.name, "expected no error writing, got", err)
+			continue
+		}
+		r := io.Reader(buf)
+		m, err := c.load(&r)
+		if err != nil {
+			t.Error("For", c.name, "expected no error reading, got", err)
+			continue
+		}
+		if m.Vertices.Len() != 4 || m.Faces.Len() != 2 {
+			t.Error("For", c.name, "expected 4 vertices and 2 faces, got",
+				m.Vertices.Len(), m.Faces.Len())
+			continue
+		}
+		vs := m.Vertices.GetAll()
+		if *vs[3].GetNormal() != (geom.Vec3{0, 0, 1}) {
+			t.Error("For", c.name, "expected normals, got", vs[3].GetNormal())
+		}
+		if col := vs[3].GetColor(); col == nil || math.Abs(col[0]-1) > 0.01 || col[2] != 1 {
+			t.Error("For", c.name, "expected colors, got", col)
+		}
+		if vt := m.Faces.Get(1)[0].GetTexCoords()[2]; vt == nil || *vt != (geom.Vec3{0, 1, 0}) {
+			t.Error("For", c.name, "expected texture coordinates, got", vt)
+		}
+		if len(m.Attributes.Vertex) != 2 {
+			t.Error("For", c.name, "expected only the curvature and flow attributes, got",
+				len(m.Attributes.Vertex))
+		}
+		curvature := m.Attributes.GetVertexAttribute("mean curvature")
+		if curvature == nil || curvature.Values[vs[2]] != -2 {
+			t.Error("For", c.name, "expected curvature attribute, got", curvature)
+		} else if _, found := curvature.Values[vs[1]]; found {
+			t.Error("For", c.name, "expected missing values to stay missing")
+		}
+		flow := m.Attributes.GetVertexAttribute("flow")
+		if flow == nil || flow.Type != VectorAttribute || flow.Vectors[vs[1]][2] != 3 {
+			t.Error("For", c.name, "expected vector attribute, got", flow)
+		} else if _, found := flow.Get(vs[0]); found {
+			t.Error("For", c.name, "expected missing vectors to stay missing")
+		}
+		thickness := m.Attributes.GetFaceAttribute("thickness")
+		if thickness == nil || thickness.Values[m.Faces.Get(1)[0]] != 4 {
+			t.Error("For", c.name, "expected thickness attribute, got", thickness)
+		}
+	}
+}
+
+var legacyVTK = `# vtk DataFile Version 5.1
+strip and polygon
+ASCII
+DATASET POLYDATA
+POINTS 5 float
+0 0 0 1 0 0 0 1 0
+1 1 0 2 1 0
+METADATA
+INFORMATION 0
+
+LINES 2 2
+OFFSETS vtktypeint64
+0 2
+CONNECTIVITY vtktypeint64
+0 4
+TRIANGLE_STRIPS 2 4
+OFFSETS vtktypeint64
+0 4
+CONNECTIVITY vtktypeint64
+0 1 2 3
+POLYGONS 2 3
+OFFSETS vtktypeint64
+0 3
+CONNECTIVITY vtktypeint64
+1 4 3
+CELL_DATA 3
+FIELD FieldData 1
+label 1 3 int
+7 8 9
+POINT_DATA 5
+SCALARS height float
+LOOKUP_TABLE default
+0 0 0 0 1
+`
+
+func TestLoadVTK(t *testing.T) {
+	r := io.Reader(strings.NewReader(legacyVTK))
+	m, err := LoadVTK(&r)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if m.Name != "strip and polygon" || m.Vertices.Len() != 5 || m.Faces.Len() != 3 {
+		t.Fatal("Expected 5 vertices and 3 faces, got", m.Name,
+			m.Vertices.Len(), m.Faces.Len())
+	}
+	// cell data is ordered lines, polygons, strips
+	label := m.Attributes.GetFaceAttribute("label")
+	faces := m.Faces.GetAll()
+	if label == nil || label.Values[faces[0]] != 8 || label.Values[faces[1]] != 9 ||
+		label.Values[faces[2]] != 9 {
+		t.Error("Expected labels of polygon and strip, got", label)
+	}
+	// strips alternate winding
+	if faces[2].GetA() != m.Vertices.Get(2)[0] || faces[2].GetB() != m.Vertices.Get(1)[0] {
+		t.Error("Expected second strip triangle to be flipped")
+	}
+	height := m.Attributes.GetVertexAttribute("height")
+	if height == nil || height.Values[m.Vertices.Get(4)[0]] != 1 {
+		t.Error("Expected height attribute, got", height)
+	}
+}
+
+func TestLoadVTKBadCounts(t *testing.T) {
+	header := "# vtk DataFile Version 3.0\nbad\n"
+	for _, input := range []string{
+		header + "BINARY\nDATASET POLYDATA\nPOINTS 2305843009213693952 float\n\x00\x00",
+		header + "BINARY\nDATASET POLYDATA\nPOINTS 1000000 float\n\x00\x00\x00\x00",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 100000000 float\n0 0 0\n",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS -1 float\n",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 1 float\n0 0 0\n" +
+			"FIELD FieldData 1\nbig 4611686018427387904 4 float\n0\n",
+		// huge component counts of arrays with no values
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 0 float\nPOINT_DATA 0\n" +
+			"SCALARS a float 1099511627776\n",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 0 float\nPOINT_DATA 0\n" +
+			"COLOR_SCALARS a 1099511627776\n",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 0 float\nPOINT_DATA 0\n" +
+			"TEXTURE_COORDINATES a 1099511627776 float\n",
+		header + "ASCII\nDATASET POLYDATA\nPOINTS 0 float\nPOINT_DATA 0\n" +
+			"FIELD FieldData 1\na 1099511627776 0 float\n",
+	} {
+		r := io.Reader(strings.NewReader(input))
+		_, err := LoadVTK(&r)
+		if _, ok := err.(*ParseError); !ok {
+			t.Error("For", strconv.Quote(input), "expected a ParseError, got", err)
+		}
+	}
+}
+
+func TestLoadVTPHugeComponents(t *testing.T) {
+	vtp := `<VTKFile type="PolyData" version="0.1">
+  <PolyData>
+    <Piece NumberOfPoints="0">
+      <PointData>
+        <DataArray type="Float32" Name="a" NumberOfComponents="1099511627776" format="ascii"></DataArray>
+      </PointData>
+      <Points>
+        <DataArray type="Float32" NumberOfComponents="3" format="ascii"></DataArray>
+      </Points>
+    </Piece>
+  </PolyData>
+</VTKFile>`
+	r := io.Reader(strings.NewReader(vtp))
+	if _, err := LoadVTP(&r); err == nil {
+		t.Error("Expected an error for an array with too many components")
+	}
+}
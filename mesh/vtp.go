@@ -0,0 +1,396 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type vtpFile struct {
+	XMLName    xml.Name   `xml:"VTKFile"`
+	Type       string     `xml:"type,attr"`
+	ByteOrder  string     `xml:"byte_order,attr"`
+	HeaderType string     `xml:"header_type,attr"`
+	Compressor string     `xml:"compressor,attr"`
+	Pieces     []vtpPiece `xml:"PolyData>Piece"`
+}
+
+type vtpPiece struct {
+	NumberOfPoints int     `xml:"NumberOfPoints,attr"`
+	PointData      vtpData `xml:"PointData"`
+	CellData       vtpData `xml:"CellData"`
+	Points         vtpData `xml:"Points"`
+	Verts          vtpData `xml:"Verts"`
+	Lines          vtpData `xml:"Lines"`
+	Polys          vtpData `xml:"Polys"`
+	Strips         vtpData `xml:"Strips"`
+}
+
+type vtpData struct {
+	Normals string         `xml:"Normals,attr"`
+	TCoords string         `xml:"TCoords,attr"`
+	Arrays  []vtpDataArray `xml:"DataArray"`
+}
+
+type vtpDataArray struct {
+	Type               string `xml:"type,attr"`
+	Name               string `xml:"Name,attr"`
+	NumberOfComponents int    `xml:"NumberOfComponents,attr"`
+	Format             string `xml:"format,attr"`
+	Data               string `xml:",chardata"`
+}
+
+// Returns the array with the given name, or nil.
+func (d *vtpData) Get(name string) *vtpDataArray {
+	for i := range d.Arrays {
+		if d.Arrays[i].Name == name {
+			return &d.Arrays[i]
+		}
+	}
+	return nil
+}
+
+// Decodes the values of an inline ASCII or binary data array.
+func (f *vtpFile) values(arr *vtpDataArray) (values []float64, err error) {
+	if _, known := vtkTypeSizes[arr.Type]; !known {
+		err = errors.New("Error reading VTP file: unsupported data type " + arr.Type)
+		return
+	}
+	switch arr.Format {
+	case "ascii":
+		words := strings.Fields(arr.Data)
+		values = make([]float64, len(words))
+		for i, word := range words {
+			if values[i], err = strconv.ParseFloat(word, 64); err != nil {
+				err = errors.New("Error reading VTP file: invalid value in array " +
+					arr.Name)
+				return
+			}
+		}
+		return
+	case "binary":
+		var order binary.ByteOrder = binary.LittleEndian
+		if f.ByteOrder == "BigEndian" {
+			order = binary.BigEndian
+		}
+		header_size := 4
+		if f.HeaderType == "UInt64" {
+			header_size = 8
+		}
+		data := strings.Join(strings.Fields(arr.Data), "")
+		decoded, decodeErr := base64.StdEncoding.DecodeString(data)
+		if decodeErr != nil {
+			// some writers encode the header separately from the data
+			header_chars := (header_size + 2) / 3 * 4
+			if len(data) < header_chars {
+				return nil, decodeErr
+			}
+			header, headerErr := base64.StdEncoding.DecodeString(data[:header_chars])
+			body, bodyErr := base64.StdEncoding.DecodeString(data[header_chars:])
+			if headerErr != nil || bodyErr != nil {
+				return nil, decodeErr
+			}
+			decoded = append(header[:header_size], body...)
+		}
+		if len(decoded) < header_size {
+			err = errors.New("Error reading VTP file: truncated array " + arr.Name)
+			return
+		}
+		var size uint64
+		if header_size == 8 {
+			size = order.Uint64(decoded)
+		} else {
+			size = uint64(order.Uint32(decoded))
+		}
+		decoded = decoded[header_size:]
+		if size > uint64(len(decoded)) {
+			err = errors.New("Error reading VTP file: truncated array " + arr.Name)
+			return
+		}
+		return decodeVTKValues(decoded[:size], arr.Type, order)
+	}
+	err = errors.New("Error reading VTP file: unsupported array format " +
+		arr.Format + ", only inline ascii and binary arrays can be read")
+	return
+}
+
+// Decodes the cells of a Verts, Lines, Polys or Strips element.
+func (f *vtpFile) cells(d *vtpData) (cells [][]int, err error) {
+	if len(d.Arrays) == 0 {
+		return
+	}
+	connectivity_array, offsets_array := d.Get("connectivity"), d.Get("offsets")
+	if connectivity_array == nil || offsets_array == nil {
+		err = errors.New("Error reading VTP file: cells without connectivity or offsets")
+		return
+	}
+	connectivity, err := f.values(connectivity_array)
+	if err != nil {
+		return
+	}
+	offsets, err := f.values(offsets_array)
+	if err != nil {
+		return
+	}
+	start := 0
+	for _, offset := range offsets {
+		end := int(offset)
+		if end < start || end > len(connectivity) {
+			err = errors.New("Error reading VTP file: invalid cell offsets")
+			return
+		}
+		cells = append(cells, floatsToInts(connectivity[start:end]))
+		start = end
+	}
+	return
+}
+
+// Decodes point or cell data arrays.
+func (f *vtpFile) arrays(d *vtpData, is_points bool) (arrays []*vtkArray, err error) {
+	for i := range d.Arrays {
+		arr := &d.Arrays[i]
+		values, err := f.values(arr)
+		if err != nil {
+			return nil, err
+		}
+		components := arr.NumberOfComponents
+		if components == 0 {
+			components = 1
+		}
+		kind := ""
+		if arr.Name == d.Normals || (d.Normals == "" && arr.Name == "Normals") {
+			kind = "normals"
+		} else if is_points && d.TCoords != "" && arr.Name == d.TCoords {
+			kind = "tcoords"
+		} else if is_points && arr.Name == "Colors" {
+			kind = "colors"
+			if arr.Type == "UInt8" {
+				for j := range values {
+					values[j] /= 255
+				}
+			}
+		}
+		arrays = append(arrays, &vtkArray{Name: arr.Name, Kind: kind,
+			Components: components, Values: values,
+			Integer: strings.Contains(arr.Type, "Int")})
+	}
+	return
+}
+
+// Read a new mesh from an XML VTK PolyData (.vtp) file with inline ASCII or
+// binary (uncompressed) data arrays. All pieces are read into the one mesh.
+// Polygons and triangle strips become faces, while vertices and lines are
+// ignored. Point and cell data arrays named Normals (or marked as the normals)
+// are read as normals, point data named Colors as colors, point data marked as
+// the texture coordinates as those of faces, and all others as vertex or face
+// attributes.
+func LoadVTP(vtp_reader *io.Reader) (m *Mesh, err error) {
+	f := &vtpFile{}
+	if err = xml.NewDecoder(*vtp_reader).Decode(f); err != nil {
+		err = errors.New("Error reading VTP file: " + err.Error())
+		return
+	}
+	if f.Type != "PolyData" {
+		err = errors.New("Error reading VTP file: unsupported dataset type " +
+			f.Type + ", only PolyData can be read")
+		return
+	}
+	if f.Compressor != "" {
+		err = errors.New("Error reading VTP file: compressed data is not supported")
+		return
+	}
+
+	m = New("")
+	for i := range f.Pieces {
+		piece := &f.Pieces[i]
+		var points []float64
+		if len(piece.Points.Arrays) > 0 {
+			if points, err = f.values(&piece.Points.Arrays[0]); err != nil {
+				return nil, err
+			}
+		}
+		if len(points) != piece.NumberOfPoints*3 {
+			return nil, errors.New("Error reading VTP file: expected " +
+				strconv.Itoa(piece.NumberOfPoints) + " points")
+		}
+		var cells [4][][]int
+		for cell_type, d := range []*vtpData{
+			&piece.Verts, &piece.Lines, &piece.Polys, &piece.Strips,
+		} {
+			if cells[cell_type], err = f.cells(d); err != nil {
+				return nil, err
+			}
+		}
+
+		vertices, cell_faces, err := buildVTKMesh(m, points, cells)
+		if err != nil {
+			return nil, err
+		}
+		point_data, err := f.arrays(&piece.PointData, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, arr := range point_data {
+			if err = applyVTKPointArray(m, vertices, arr); err != nil {
+				return nil, err
+			}
+		}
+		cell_data, err := f.arrays(&piece.CellData, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, arr := range cell_data {
+			if err = applyVTKCellArray(m, cell_faces, arr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+func ReadVTPFile(input_path string) (m *Mesh, err error) {
+	input_file, err := openFile(input_path)
+	if err != nil {
+		return
+	}
+	defer input_file.Close()
+
+	vtp_reader := io.Reader(input_file)
+	m, err = LoadVTP(&vtp_reader)
+	return
+}
+
+// Writes inline data arrays of an XML VTK file.
+type vtpWriter struct {
+	writer *bufio.Writer
+	binary bool
+}
+
+func (w *vtpWriter) Line(line string) {
+	w.writer.WriteString(line + "\n")
+}
+
+// Writes a DataArray element of the given type, name (which may be empty) and
+// number of components.
+func (w *vtpWriter) DataArray(values []float64, data_type, name string, components int) {
+	format := "ascii"
+	if w.binary {
+		format = "binary"
+	}
+	element := `<DataArray type="` + data_type + `"`
+	if name != "" {
+		element += ` Name="` + xmlEscape(name) + `"`
+	}
+	if components > 1 {
+		element += ` NumberOfComponents="` + strconv.Itoa(components) + `"`
+	}
+	w.Line(element + ` format="` + format + `">`)
+
+	if w.binary {
+		data := encodeVTKValues(values, data_type, binary.LittleEndian)
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint64(header, uint64(len(data)))
+		w.Line(base64.StdEncoding.EncodeToString(append(header, data...)))
+	} else {
+		per_line := components
+		if per_line < 3 {
+			per_line = 3
+		}
+		for i, value := range values {
+			w.writer.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+			if (i+1)%per_line == 0 || i == len(values)-1 {
+				w.writer.WriteByte('\n')
+			} else {
+				w.writer.WriteByte(' ')
+			}
+		}
+	}
+	w.Line("</DataArray>")
+}
+
+// Writes point or cell data arrays in a PointData or CellData element.
+func (w *vtpWriter) Arrays(element string, arrays []*vtkArray) {
+	if len(arrays) == 0 {
+		return
+	}
+	start := "<" + element
+	for _, arr := range arrays {
+		if arr.Kind == "normals" {
+			start += ` Normals="` + xmlEscape(arr.Name) + `"`
+		} else if arr.Kind == "tcoords" {
+			start += ` TCoords="` + xmlEscape(arr.Name) + `"`
+		}
+	}
+	w.Line(start + ">")
+	for _, arr := range arrays {
+		if arr.Integer {
+			w.DataArray(arr.Values, "Int32", arr.Name, arr.Components)
+		} else {
+			w.DataArray(arr.Values, "Float64", arr.Name, arr.Components)
+		}
+	}
+	w.Line("</" + element + ">")
+}
+
+func xmlEscape(s string) string {
+	escaped := new(strings.Builder)
+	xml.EscapeText(escaped, []byte(s))
+	return escaped.String()
+}
+
+// Write mesh as an XML VTK PolyData (.vtp) file, with ASCII data arrays unless
+// the options ask for binary. The mesh's normals, colors, texture coordinates
+// and attributes are written as point and cell data.
+func (m *Mesh) WriteVTP(vtp_writer io.Writer, opts ...VTKOptions) (err error) {
+	options := VTKOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	w := &vtpWriter{writer: bufio.NewWriter(vtp_writer), binary: options.Binary}
+
+	points, connectivity := vtkGeometry(m)
+	face_count := m.Faces.Len()
+	offsets := make([]float64, face_count)
+	for i := range offsets {
+		offsets[i] = float64((i + 1) * 3)
+	}
+
+	w.Line(`<?xml version="1.0"?>`)
+	w.Line(`<VTKFile type="PolyData" version="1.0" byte_order="LittleEndian" ` +
+		`header_type="UInt64">`)
+	w.Line("<PolyData>")
+	w.Line(`<Piece NumberOfPoints="` + strconv.Itoa(m.Vertices.Len()) +
+		`" NumberOfVerts="0" NumberOfLines="0" NumberOfStrips="0" ` +
+		`NumberOfPolys="` + strconv.Itoa(face_count) + `">`)
+	w.Arrays("PointData", vtkPointArrays(m))
+	w.Arrays("CellData", vtkCellArrays(m))
+	w.Line("<Points>")
+	w.DataArray(points, "Float64", "Points", 3)
+	w.Line("</Points>")
+	w.Line("<Polys>")
+	w.DataArray(connectivity, "Int64", "connectivity", 1)
+	w.DataArray(offsets, "Int64", "offsets", 1)
+	w.Line("</Polys>")
+	w.Line("</Piece>")
+	w.Line("</PolyData>")
+	w.Line("</VTKFile>")
+	err = w.writer.Flush()
+	return
+}
+
+func (m *Mesh) WriteVTPFile(output_path string, opts ...VTKOptions) (err error) {
+	err = writeFile(output_path, func(w io.Writer) error {
+		return m.WriteVTP(w, opts...)
+	})
+	return
+}
+
+func sniffVTP(header []byte) bool {
+	s := string(header)
+	return strings.Contains(s, "<VTKFile") && strings.Contains(s, `"PolyData"`)
+}